@@ -9,6 +9,8 @@ import (
 
 var JWTSecretKey = os.Getenv("JWT_SECRET")
 
+var MailSMTPPassword = os.Getenv("MAIL_SMTP_PASSWORD")
+
 var CONFIG = ReadConfig()
 
 const configFileName string = "config.json"
@@ -18,11 +20,75 @@ type TRepoConfig struct {
 	CollName string `json:"coll_name"`
 }
 
+// TJWTKeyConfig is one signing key. A key without private_key_file is kept for verification only,
+// which is how a retired key keeps validating its tokens during rotation.
+type TJWTKeyConfig struct {
+	KeyID          string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	PrivateKeyFile string `json:"private_key_file"`
+	PublicKeyFile  string `json:"public_key_file"`
+}
+
+type TJWTConfig struct {
+	ActiveKeyID string          `json:"active_kid"`
+	Keys        []TJWTKeyConfig `json:"keys"`
+}
+
+// TLoginGuardConfig controls brute-force protection on login.
+// After MaxAttempts failures inside AttemptWindow a key is locked for BaseLockout seconds,
+// doubling with every further failure up to MaxLockout. Store is "mongo" or "memory".
+type TLoginGuardConfig struct {
+	MaxAttempts   int    `json:"max_attempts"`
+	AttemptWindow int64  `json:"attempt_window"`
+	BaseLockout   int64  `json:"base_lockout"`
+	MaxLockout    int64  `json:"max_lockout"`
+	Store         string `json:"store"`
+}
+
+// TTOTPConfig RequiredForAdmin forces ADMINISTRATOR accounts to enroll TOTP before they can log in
+type TTOTPConfig struct {
+	Issuer           string `json:"issuer"`
+	RequiredForAdmin bool   `json:"required_for_admin"`
+}
+
+// TMailConfig Driver is "smtp", or "file" to append mails to FilePath for local testing, they are logged when
+// FilePath is empty. AppURL is the front end base url the links in the mails point to.
+type TMailConfig struct {
+	Driver       string `json:"driver"`
+	From         string `json:"from"`
+	AppURL       string `json:"app_url"`
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     string `json:"smtp_port"`
+	SMTPUsername string `json:"smtp_username"`
+	FilePath     string `json:"file_path"`
+}
+
+// TScheduleConfig Timezone is the IANA zone working hours are written in, MaxSlotRangeDays caps a slot query.
+// RescheduleNotice is the seconds a timed booking can still be moved before it starts, 0 allows any time.
+type TScheduleConfig struct {
+	Timezone         string `json:"timezone"`
+	MaxSlotRangeDays int    `json:"max_slot_range_days"`
+	RescheduleNotice int64  `json:"reschedule_notice"`
+}
+
+// TConfig LegacyStatusCodes answers every error with 200 like before, for clients that can't send the compat header.
+// TrustedProxies are the proxies whose X-Forwarded-For is believed for the client ip, none by default.
 type TConfig struct {
-	ServiceHost  string                 `json:"service_host"`
-	ServicePort  string                 `json:"service_port"`
-	Repositories map[string]TRepoConfig `json:"repositories"`
-	MongoURL     string                 `json:"mongo_url"`
+	ServiceHost       string                 `json:"service_host"`
+	ServicePort       string                 `json:"service_port"`
+	Repositories      map[string]TRepoConfig `json:"repositories"`
+	MongoURL          string                 `json:"mongo_url"`
+	AccessTokenTTL    int64                  `json:"access_token_ttl"`
+	RefreshTokenTTL   int64                  `json:"refresh_token_ttl"`
+	VerifyEmailTTL    int64                  `json:"verify_email_ttl"`
+	ResetPasswordTTL  int64                  `json:"reset_password_ttl"`
+	JWT               TJWTConfig             `json:"jwt"`
+	LoginGuard        TLoginGuardConfig      `json:"login_guard"`
+	TOTP              TTOTPConfig            `json:"totp"`
+	Mail              TMailConfig            `json:"mail"`
+	Schedule          TScheduleConfig        `json:"schedule"`
+	LegacyStatusCodes bool                   `json:"legacy_status_codes"`
+	TrustedProxies    []string               `json:"trusted_proxies"`
 }
 
 func ReadConfig() TConfig {
@@ -44,5 +110,48 @@ func ReadConfig() TConfig {
 		logrus.Error(err)
 	}
 
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = 900
+	}
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = 1209600
+	}
+	if config.VerifyEmailTTL <= 0 {
+		config.VerifyEmailTTL = 86400
+	}
+	if config.ResetPasswordTTL <= 0 {
+		config.ResetPasswordTTL = 3600
+	}
+	if config.Mail.Driver == "" {
+		config.Mail.Driver = "file"
+	}
+	if config.Mail.AppURL == "" {
+		config.Mail.AppURL = "http://localhost:3000"
+	}
+	if config.TOTP.Issuer == "" {
+		config.TOTP.Issuer = "Hospital"
+	}
+	if config.Schedule.Timezone == "" {
+		config.Schedule.Timezone = "UTC"
+	}
+	if config.Schedule.MaxSlotRangeDays <= 0 {
+		config.Schedule.MaxSlotRangeDays = 31
+	}
+	if config.Schedule.RescheduleNotice < 0 {
+		config.Schedule.RescheduleNotice = 0
+	}
+	if config.LoginGuard.MaxAttempts <= 0 {
+		config.LoginGuard.MaxAttempts = 5
+	}
+	if config.LoginGuard.AttemptWindow <= 0 {
+		config.LoginGuard.AttemptWindow = 900
+	}
+	if config.LoginGuard.BaseLockout <= 0 {
+		config.LoginGuard.BaseLockout = 30
+	}
+	if config.LoginGuard.MaxLockout <= 0 {
+		config.LoginGuard.MaxLockout = 3600
+	}
+
 	return config
 }
@@ -1,10 +1,9 @@
 package controller
 
 import (
-	"errors"
-
 	"github.com/agustadewa/hospital-backend/entity"
 	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
 	"github.com/agustadewa/hospital-backend/service"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -12,18 +11,22 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func NewAdminController(client *mongo.Client) *adminController {
+func NewAdminController(client *mongo.Client, repos repository.Repositories) *adminController {
 	return &adminController{
-		MongoClient:    client,
-		AdminService:   service.NewAdminService(client),
-		PatientService: service.NewPatientService(client),
+		MongoClient:        client,
+		AdminService:       service.NewAdminService(client, repos),
+		PatientService:     service.NewPatientService(client, repos),
+		AppointmentService: service.NewAppointmentService(client, repos),
+		ScheduleService:    service.NewScheduleService(client, repos),
 	}
 }
 
 type adminController struct {
-	MongoClient    *mongo.Client
-	AdminService   *service.Admin
-	PatientService *service.Patient
+	MongoClient        *mongo.Client
+	AdminService       *service.Admin
+	PatientService     *service.Patient
+	AppointmentService *service.Appointment
+	ScheduleService    *service.Schedule
 }
 
 func (ctrl *adminController) GetAccount(c *gin.Context) {
@@ -38,71 +41,117 @@ func (ctrl *adminController) GetAccount(c *gin.Context) {
 
 	accountId := paramObj.Get("account_id")
 
-	selfAccountID := c.GetHeader("Account-Id")
-	isAdmin, err := ctrl.AdminService.IsAdmin(ctx, selfAccountID)
-	if err != nil || !isAdmin {
-		logrus.Error(err)
-		helper.Unauthorized(c, errors.New("not admin"))
-		return
-	}
-
 	var result entity.TAccount
 	if err := ctrl.AdminService.GetAccount(ctx, accountId, &result); err != nil {
-		if err == mongo.ErrNoDocuments {
-			logrus.Error("CGetAccount.GetAccount.NoDocuments.", err)
-			helper.BadRequest(c, errors.New("not found"))
-			return
-		} else {
-			logrus.Error(err)
-			helper.BadRequest(c, err)
-			return
-		}
+		logrus.Error("CGetAccount.GetAccount.", err)
+		helper.Fail(c, err)
+		return
 	}
 
 	helper.Ok(c, result)
 }
 
-func (ctrl *adminController) CreateAccount(c *gin.Context) {
+func (ctrl *adminController) GetManyAccount(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	var reqBody entity.TCreateAccountReq
-	if err := helper.ParseKindAndBody(c, "account#create", &reqBody); err != nil {
+	var reqBody entity.TGetManyAccountReq
+	if err := helper.ParseKindAndBody(c, "account#getmany", &reqBody); err != nil {
 		logrus.Error(err)
 		helper.BadRequest(c, err)
 		return
 	}
 
-	selfAccountID := c.GetHeader("Account-Id")
-	isAdmin, err := ctrl.AdminService.IsAdmin(ctx, selfAccountID)
-	if err != nil || !isAdmin {
+	var result []entity.TAccount
+	page, err := ctrl.AdminService.GetManyAccount(ctx, reqBody, &result)
+	if err != nil {
+		logrus.Error("CGetManyAccount.GetManyAccount.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TListRes{Items: result, TListPage: page})
+}
+
+func (ctrl *adminController) CreateAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TCreateAccountReq
+	if err := helper.ParseKindAndBody(c, "account#create", &reqBody); err != nil {
 		logrus.Error(err)
-		helper.Unauthorized(c, errors.New("not admin"))
+		helper.BadRequest(c, err)
 		return
 	}
 
 	isExists, err := ctrl.AdminService.CheckAccountByEmailAndUsername(ctx, reqBody.Email, reqBody.Username)
 	if err != nil {
-		logrus.Error("CCreateAccount.CheckAccountByEmailAndUsername", err)
-		helper.BadRequest(c, err)
+		logrus.Error("CCreateAccount.CheckAccountByEmailAndUsername.", err)
+		helper.Fail(c, err)
 		return
 	}
 
 	if isExists {
 		logrus.Info("CCreateAccount.CheckAccountByEmailAndUsername.Exists")
-		helper.BadRequest(c, errors.New("already exists"))
+		helper.Fail(c, service.ErrAccountExists)
 		return
 	}
 
 	newOID := primitive.NewObjectID().Hex()
 	if err := ctrl.AdminService.CreateAccount(ctx, newOID, reqBody); err != nil {
-		logrus.Info("CCreateAccount.CreateAccount.")
-		helper.BadRequest(c, errors.New("can't create account"))
+		logrus.Error("CCreateAccount.CreateAccount.", err)
+		helper.Fail(c, err)
 		return
 	}
 
 	helper.Ok(c, entity.TCreateAccountRes{AccountID: newOID})
 }
 
+func (ctrl *adminController) UpdateAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "account_id")
+	if err != nil {
+		logrus.Error("CAdmin.UpdateAccount.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	accountId := paramObj.Get("account_id")
+
+	var reqBody entity.TUpdateAccountReq
+	if err := helper.ParseKindAndBody(c, "account#update", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	if err := ctrl.AdminService.UpdateAccount(ctx, accountId, reqBody); err != nil {
+		logrus.Error("CUpdateAccount.UpdateAccount.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *adminController) UnlockAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "account_id")
+	if err != nil {
+		logrus.Error("CAdmin.UnlockAccount.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	if err := ctrl.AdminService.UnlockAccount(ctx, paramObj.Get("account_id")); err != nil {
+		logrus.Error("CUnlockAccount.UnlockAccount.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
 // ++++++++++++++++++ DOCTOR +++++++++++++++++++
 
 func (ctrl *adminController) GetDoctor(c *gin.Context) {
@@ -117,25 +166,11 @@ func (ctrl *adminController) GetDoctor(c *gin.Context) {
 
 	doctorId := paramObj.Get("doctor_id")
 
-	selfAccountID := c.GetHeader("Account-Id")
-	isAdmin, err := ctrl.AdminService.IsAdmin(ctx, selfAccountID)
-	if err != nil || !isAdmin {
-		logrus.Error(err)
-		helper.Unauthorized(c, errors.New("not admin"))
-		return
-	}
-
 	var result entity.TDoctor
 	if err := ctrl.AdminService.GetDoctor(ctx, doctorId, &result); err != nil {
-		if err == mongo.ErrNoDocuments {
-			logrus.Error("CGetDoctor.GetDoctor.NoDocuments.", err)
-			helper.BadRequest(c, errors.New("not found"))
-			return
-		} else {
-			logrus.Error(err)
-			helper.BadRequest(c, err)
-			return
-		}
+		logrus.Error("CGetDoctor.GetDoctor.", err)
+		helper.Fail(c, err)
+		return
 	}
 
 	helper.Ok(c, result)
@@ -152,19 +187,14 @@ func (ctrl *adminController) GetManyDoctor(c *gin.Context) {
 	}
 
 	var result []entity.TDoctor
-	if err := ctrl.AdminService.GetManyDoctorByName(ctx, reqBody.Keyword, &result); err != nil {
-		if err == mongo.ErrNoDocuments {
-			logrus.Error("CGetDoctor.GetDoctor.NoDocuments.", err)
-			helper.BadRequest(c, errors.New("not found"))
-			return
-		} else {
-			logrus.Error(err)
-			helper.BadRequest(c, err)
-			return
-		}
+	page, err := ctrl.AdminService.GetManyDoctor(ctx, reqBody, &result)
+	if err != nil {
+		logrus.Error("CGetManyDoctor.GetManyDoctor.", err)
+		helper.Fail(c, err)
+		return
 	}
 
-	helper.Ok(c, result)
+	helper.Ok(c, entity.TListRes{Items: result, TListPage: page})
 }
 
 func (ctrl *adminController) CreateDoctor(c *gin.Context) {
@@ -177,37 +207,57 @@ func (ctrl *adminController) CreateDoctor(c *gin.Context) {
 		return
 	}
 
-	selfAccountID := c.GetHeader("Account-Id")
-	isAdmin, err := ctrl.AdminService.IsAdmin(ctx, selfAccountID)
-	if err != nil || !isAdmin {
-		logrus.Error(err)
-		helper.Unauthorized(c, errors.New("not admin"))
-		return
-	}
-
 	isExists, err := ctrl.AdminService.CheckDoctorByName(ctx, reqBody.FirstName, reqBody.LastName)
 	if err != nil {
-		logrus.Error("CCreateDoctor.CheckDoctorName", err)
-		helper.BadRequest(c, err)
+		logrus.Error("CCreateDoctor.CheckDoctorName.", err)
+		helper.Fail(c, err)
 		return
 	}
 
 	if isExists {
 		logrus.Info("CCreateDoctor.CheckDoctorName.Exists")
-		helper.BadRequest(c, errors.New("already exists"))
+		helper.Fail(c, service.ErrDoctorExists)
 		return
 	}
 
 	newOID := primitive.NewObjectID().Hex()
 	if err := ctrl.AdminService.CreateDoctor(ctx, newOID, reqBody); err != nil {
-		logrus.Info("CCreateDoctor.CreateDoctor.")
-		helper.BadRequest(c, errors.New("can't create doctor"))
+		logrus.Error("CCreateDoctor.CreateDoctor.", err)
+		helper.Fail(c, err)
 		return
 	}
 
 	helper.Ok(c, entity.TCreateDoctorRes{DoctorID: newOID})
 }
 
+func (ctrl *adminController) UpdateDoctor(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "doctor_id")
+	if err != nil {
+		logrus.Error("CAdmin.UpdateDoctor.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	doctorId := paramObj.Get("doctor_id")
+
+	var reqBody entity.TUpdateDoctorReq
+	if err := helper.ParseKindAndBody(c, "doctor#update", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	if err := ctrl.AdminService.UpdateDoctor(ctx, doctorId, reqBody); err != nil {
+		logrus.Error("CUpdateDoctor.UpdateDoctor.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
 func (ctrl *adminController) DeleteDoctor(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -220,25 +270,146 @@ func (ctrl *adminController) DeleteDoctor(c *gin.Context) {
 
 	doctorId := paramObj.Get("doctor_id")
 
-	selfAccountID := c.GetHeader("Account-Id")
-	isAdmin, err := ctrl.AdminService.IsAdmin(ctx, selfAccountID)
-	if err != nil || !isAdmin {
+	if err := ctrl.AdminService.DeleteDoctor(ctx, doctorId); err != nil {
+		logrus.Error("CDeleteDoctor.DeleteDoctor.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *adminController) SetWorkingSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "doctor_id")
+	if err != nil {
+		logrus.Error("CAdmin.SetWorkingSchedule.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	doctorId := paramObj.Get("doctor_id")
+
+	var reqBody entity.TSetScheduleReq
+	if err := helper.ParseKindAndBody(c, "schedule#set", &reqBody); err != nil {
 		logrus.Error(err)
-		helper.Unauthorized(c, errors.New("not admin"))
+		helper.BadRequest(c, err)
 		return
 	}
 
-	if err := ctrl.AdminService.DeleteDoctor(ctx, doctorId); err != nil {
-		if err == mongo.ErrNoDocuments {
-			logrus.Error("CDeleteDoctor.DeleteDoctor.NotFound.", err)
-			helper.BadRequest(c, errors.New("not found"))
-			return
-
-		} else {
-			logrus.Error(err)
-			helper.BadRequest(c, err)
-			return
-		}
+	if err := ctrl.ScheduleService.SetSchedule(ctx, doctorId, reqBody); err != nil {
+		logrus.Error("CAdmin.SetWorkingSchedule.SetSchedule.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *adminController) GetWorkingSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "doctor_id")
+	if err != nil {
+		logrus.Error("CAdmin.GetWorkingSchedule.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	doctorId := paramObj.Get("doctor_id")
+
+	var result entity.TWorkingSchedule
+	if err := ctrl.ScheduleService.GetSchedule(ctx, doctorId, &result); err != nil {
+		logrus.Error("CAdmin.GetWorkingSchedule.GetSchedule.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+// ++++++++++++++++++ APPOINTMENT +++++++++++++++++++
+
+func (ctrl *adminController) GetAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CAdmin.GetAppointment.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+
+	var result entity.TAppointment
+	if err := ctrl.AppointmentService.GetAppointment(ctx, appointmentId, &result); err != nil {
+		logrus.Error("CGetAppointment.GetAppointment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *adminController) GetManyAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TGetManyAppointmentReq
+	if err := helper.ParseKindAndBody(c, "appointment#getmany", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	var result []entity.TAppointment
+	page, err := ctrl.AppointmentService.GetManyAppointment(ctx, reqBody, &result)
+	if err != nil {
+		logrus.Error("CGetManyAppointment.GetManyAppointment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TListRes{Items: result, TListPage: page})
+}
+
+func (ctrl *adminController) CreateAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TCreateAppointmentReq
+	if err := helper.ParseKindAndBody(c, "appointment#create", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	newOID := primitive.NewObjectID().Hex()
+	if err := ctrl.AppointmentService.CreateAppointment(ctx, newOID, reqBody); err != nil {
+		logrus.Error("CCreateAppointment.CreateAppointment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TCreateAppointmentRes{AppointmentID: newOID})
+}
+
+func (ctrl *adminController) DeleteAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CAdmin.DeleteAppointment.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+
+	if err := ctrl.AppointmentService.DeleteAppointment(ctx, appointmentId); err != nil {
+		logrus.Error("CDeleteAppointment.DeleteAppointment.", err)
+		helper.Fail(c, err)
+		return
 	}
 
 	helper.Ok(c, nil)
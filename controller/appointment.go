@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/agustadewa/hospital-backend/service"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func NewAppointmentController(client *mongo.Client, repos repository.Repositories) *appointmentController {
+	return &appointmentController{
+		MongoClient:        client,
+		AppointmentService: service.NewAppointmentService(client, repos),
+		ScheduleService:    service.NewScheduleService(client, repos),
+	}
+}
+
+type appointmentController struct {
+	MongoClient        *mongo.Client
+	AppointmentService *service.Appointment
+	ScheduleService    *service.Schedule
+}
+
+func (ctrl *appointmentController) GetManyAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TGetManyAppointmentReq
+	if err := helper.ParseKindAndBody(c, "appointment#getmany", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	selfAccountID := helper.GetAccountID(c)
+
+	var appointments []entity.TAppointment
+	page, err := ctrl.AppointmentService.GetManyAppointment(ctx, reqBody, &appointments)
+	if err != nil {
+		logrus.Error("CAppointment.GetManyAppointment.GetManyAppointment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	result := make([]entity.TAppointmentRes, 0, len(appointments))
+	for _, appointment := range appointments {
+		result = append(result, ctrl.AppointmentService.ToPatientView(appointment, selfAccountID))
+	}
+
+	helper.Ok(c, entity.TListRes{Items: result, TListPage: page})
+}
+
+// GetSlots lists the free slots of a doctor, booked slots that still have a seat included
+func (ctrl *appointmentController) GetSlots(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TGetSlotsReq
+	if err := helper.ParseKindAndBody(c, "slot#getmany", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	result, err := ctrl.ScheduleService.GetSlots(ctx, reqBody)
+	if err != nil {
+		logrus.Error("CAppointment.GetSlots.GetSlots.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
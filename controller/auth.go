@@ -2,9 +2,11 @@ package controller
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/agustadewa/hospital-backend/entity"
 	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
 	"github.com/agustadewa/hospital-backend/service"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -12,12 +14,12 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func NewAuthController(mongoClient *mongo.Client) *auth {
+func NewAuthController(mongoClient *mongo.Client, repos repository.Repositories) *auth {
 	return &auth{
 		MongoClient:    mongoClient,
-		AdminService:   service.NewAdminService(mongoClient),
-		PatientService: service.NewPatientService(mongoClient),
-		AuthService:    service.NewAuthService(mongoClient),
+		AdminService:   service.NewAdminService(mongoClient, repos),
+		PatientService: service.NewPatientService(mongoClient, repos),
+		AuthService:    service.NewAuthService(mongoClient, repos),
 	}
 }
 
@@ -28,6 +30,11 @@ type auth struct {
 	AuthService    *service.Auth
 }
 
+// JWKS publishes the token verification keys in the standard format, other services read it as is
+func JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, service.GetJWKS())
+}
+
 func (ctrl *auth) CheckAuthentication(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -45,15 +52,22 @@ func (ctrl *auth) CheckAuthentication(c *gin.Context) {
 		return
 	}
 
-	if token.Claims.AccountID == "" {
+	if token.Claims.AccountID == "" || token.Claims.Purpose != "" {
 		logrus.Error("CCheckAuthentication.AccountIDIsMissing.")
 		helper.Unauthorized(c, errors.New("bad token"))
 		return
 	}
 
+	isActive, err := ctrl.AuthService.IsSessionActive(ctx, token.Claims.SessionID)
+	if err != nil || !isActive {
+		logrus.Error("CCheckAuthentication.IsSessionActive.", err)
+		helper.Unauthorized(c, errors.New("session revoked"))
+		return
+	}
+
 	if err = ctrl.AdminService.GetAccount(ctx, token.Claims.AccountID, &entity.TAccount{}); err != nil {
 		logrus.Error("CCheckAuthentication.GetAccount.", err)
-		helper.Unauthorized(c, err)
+		helper.Unauthorized(c, errors.New("bad token"))
 		return
 	}
 
@@ -70,30 +84,195 @@ func (ctrl *auth) Login(c *gin.Context) {
 		return
 	}
 
+	if reqBody.GetIdentifier() == "" {
+		logrus.Info("CLogin.IdentifierIsMissing")
+		helper.BadRequest(c, errors.New("identifier required"))
+		return
+	}
+
 	var account entity.TAccount
-	isMatch, err := ctrl.AuthService.MatchAndGetAccount(ctx, reqBody.Email, reqBody.Password, &account)
+	isMatch, err := ctrl.AuthService.MatchAndGetAccount(ctx, reqBody.GetIdentifier(), reqBody.Password, c.ClientIP(), &account)
 	if err != nil {
 		logrus.Error("CLogin.MatchAndGetAccount.", err)
-		helper.BadRequest(c, err)
+		helper.Fail(c, err)
 		return
 	}
 
 	if !isMatch {
 		logrus.Info("CLogin.INVALID")
-		helper.BadRequest(c, errors.New("invalid"))
+		helper.Fail(c, service.ErrInvalidCredentials)
+		return
+	}
+
+	result, err := ctrl.AuthService.BeginLogin(ctx, account)
+	if err != nil {
+		logrus.Error("CLogin.BeginLogin.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *auth) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.VerifyEmailReq
+	if err := helper.ParseKindAndBody(c, "auth#verifyemail", &reqBody); err != nil {
+		logrus.Error("CVerifyEmail.ParseKindAndBody.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	if err := ctrl.AuthService.VerifyEmail(ctx, reqBody.Token); err != nil {
+		logrus.Error("CVerifyEmail.VerifyEmail.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *auth) ResendVerification(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if err := ctrl.AuthService.SendVerificationEmail(ctx, helper.GetAccountID(c)); err != nil {
+		logrus.Error("CResendVerification.SendVerificationEmail.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *auth) ForgotPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.ForgotPasswordReq
+	if err := helper.ParseKindAndBody(c, "auth#forgotpassword", &reqBody); err != nil {
+		logrus.Error("CForgotPassword.ParseKindAndBody.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	if err := ctrl.AuthService.ForgotPassword(ctx, reqBody.Email); err != nil {
+		logrus.Error("CForgotPassword.ForgotPassword.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *auth) ResetPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.ResetPasswordReq
+	if err := helper.ParseKindAndBody(c, "auth#resetpassword", &reqBody); err != nil {
+		logrus.Error("CResetPassword.ParseKindAndBody.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	if err := ctrl.AuthService.ResetPassword(ctx, reqBody.Token, reqBody.Password); err != nil {
+		logrus.Error("CResetPassword.ResetPassword.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *auth) LoginTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TOTPLoginReq
+	if err := helper.ParseKindAndBody(c, "auth#logintotp", &reqBody); err != nil {
+		logrus.Error("CLoginTOTP.ParseKindAndBody.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	result, err := ctrl.AuthService.CompleteTOTPLogin(ctx, reqBody.MFAToken, reqBody.Code)
+	if err != nil {
+		logrus.Error("CLoginTOTP.CompleteTOTPLogin.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *auth) LoginTOTPEnroll(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TOTPEnrollLoginReq
+	if err := helper.ParseKindAndBody(c, "auth#logintotpenroll", &reqBody); err != nil {
+		logrus.Error("CLoginTOTPEnroll.ParseKindAndBody.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	result, err := ctrl.AuthService.BeginTOTPLoginEnrollment(ctx, reqBody.MFAToken)
+	if err != nil {
+		logrus.Error("CLoginTOTPEnroll.BeginTOTPLoginEnrollment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *auth) EnrollTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	result, err := ctrl.AuthService.BeginTOTPEnrollment(ctx, helper.GetAccountID(c))
+	if err != nil {
+		logrus.Error("CEnrollTOTP.BeginTOTPEnrollment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *auth) ConfirmTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TOTPConfirmReq
+	if err := helper.ParseKindAndBody(c, "auth#confirmtotp", &reqBody); err != nil {
+		logrus.Error("CConfirmTOTP.ParseKindAndBody.", err)
+		helper.BadRequest(c, err)
 		return
 	}
 
-	accessToken, err := ctrl.AuthService.CreateAccessToken(account.AccountID, 3600)
+	recoveryCodes, err := ctrl.AuthService.ConfirmTOTPEnrollment(ctx, helper.GetAccountID(c), reqBody.Code)
 	if err != nil {
-		logrus.Error("CLogin.CreateAccessToken.", err)
+		logrus.Error("CConfirmTOTP.ConfirmTOTPEnrollment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TOTPConfirmRes{RecoveryCodes: recoveryCodes})
+}
+
+func (ctrl *auth) DisableTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TOTPDisableReq
+	if err := helper.ParseKindAndBody(c, "auth#disabletotp", &reqBody); err != nil {
+		logrus.Error("CDisableTOTP.ParseKindAndBody.", err)
 		helper.BadRequest(c, err)
 		return
 	}
 
-	helper.Ok(c, entity.LoginRes{
-		Authorization: accessToken,
-	})
+	if err := ctrl.AuthService.DisableTOTP(ctx, helper.GetAccountID(c), reqBody); err != nil {
+		logrus.Error("CDisableTOTP.DisableTOTP.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
 }
 
 func (ctrl *auth) Register(c *gin.Context) {
@@ -109,33 +288,68 @@ func (ctrl *auth) Register(c *gin.Context) {
 	// Check existing account
 	isExists, err := ctrl.AdminService.CheckAccountByEmailAndUsername(ctx, reqBody.Email, reqBody.Username)
 	if err != nil {
-		logrus.Error("CCreateAccount.CheckAccountByEmailAndUsername", err)
-		helper.BadRequest(c, err)
+		logrus.Error("CCreateAccount.CheckAccountByEmailAndUsername.", err)
+		helper.Fail(c, err)
 		return
 	}
 	if isExists {
 		logrus.Info("CCreateAccount.CheckAccountByEmailAndUsername.Exists")
-		helper.BadRequest(c, errors.New("already exists"))
+		helper.Fail(c, service.ErrAccountExists)
 		return
 	}
 
 	// Create patient account
 	newOID := primitive.NewObjectID().Hex()
 	if err := ctrl.PatientService.CreateAccount(ctx, newOID, reqBody); err != nil {
-		logrus.Info("CCreateAccount.CreateAccount.")
-		helper.BadRequest(c, errors.New("can't create account"))
+		logrus.Error("CCreateAccount.CreateAccount.", err)
+		helper.Fail(c, err)
 		return
 	}
 
+	// A mail failure must not fail the registration, the link can be requested again
+	if err := ctrl.AuthService.SendVerificationEmail(ctx, newOID); err != nil {
+		logrus.Error("CAuth.Register.SendVerificationEmail.", err)
+	}
+
 	// Create Token
-	accessToken, err := ctrl.AuthService.CreateAccessToken(newOID, 3600)
+	result, err := ctrl.AuthService.CreateSession(ctx, newOID)
 	if err != nil {
-		logrus.Error("CAuth.Register.CreateAccessToken.", err)
+		logrus.Error("CAuth.Register.CreateSession.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *auth) Refresh(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.RefreshReq
+	if err := helper.ParseKindAndBody(c, "auth#refresh", &reqBody); err != nil {
+		logrus.Error("CRefresh.ParseKindAndBody.", err)
 		helper.BadRequest(c, err)
 		return
 	}
 
-	helper.Ok(c, entity.LoginRes{
-		Authorization: accessToken,
-	})
+	result, err := ctrl.AuthService.Refresh(ctx, reqBody.RefreshToken)
+	if err != nil {
+		logrus.Error("CRefresh.Refresh.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *auth) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if err := ctrl.AuthService.Logout(ctx, helper.GetSessionID(c)); err != nil {
+		logrus.Error("CLogout.Logout.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
 }
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/agustadewa/hospital-backend/service"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func NewDoctorController(client *mongo.Client, repos repository.Repositories) *doctorController {
+	return &doctorController{
+		MongoClient:     client,
+		DoctorService:   service.NewDoctorService(client, repos),
+		VitalsService:   service.NewVitalsService(client, repos),
+		ScheduleService: service.NewScheduleService(client, repos),
+		QueueService:    service.NewQueueService(client, repos),
+	}
+}
+
+type doctorController struct {
+	MongoClient     *mongo.Client
+	DoctorService   *service.Doctor
+	VitalsService   *service.Vitals
+	ScheduleService *service.Schedule
+	QueueService    *service.Queue
+}
+
+func (ctrl *doctorController) GetSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	doctorId, err := ctrl.DoctorService.GetLinkedDoctorID(ctx, helper.GetAccountID(c))
+	if err != nil {
+		logrus.Error("CDoctor.GetSchedule.GetLinkedDoctorID.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	var result []entity.TAppointment
+	if err := ctrl.DoctorService.GetSchedule(ctx, doctorId, &result); err != nil {
+		logrus.Error("CDoctor.GetSchedule.GetSchedule.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+// GetWorkingSchedule returns the weekly hours and exceptions of the linked doctor
+func (ctrl *doctorController) GetWorkingSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	doctorId, err := ctrl.DoctorService.GetLinkedDoctorID(ctx, helper.GetAccountID(c))
+	if err != nil {
+		logrus.Error("CDoctor.GetWorkingSchedule.GetLinkedDoctorID.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	var result entity.TWorkingSchedule
+	if err := ctrl.ScheduleService.GetSchedule(ctx, doctorId, &result); err != nil {
+		logrus.Error("CDoctor.GetWorkingSchedule.GetSchedule.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *doctorController) GetPatients(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	doctorId, err := ctrl.DoctorService.GetLinkedDoctorID(ctx, helper.GetAccountID(c))
+	if err != nil {
+		logrus.Error("CDoctor.GetPatients.GetLinkedDoctorID.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	var result []entity.TAccount
+	if err := ctrl.DoctorService.GetPatients(ctx, doctorId, &result); err != nil {
+		logrus.Error("CDoctor.GetPatients.GetPatients.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *doctorController) GetPatientVitals(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "account_id")
+	if err != nil {
+		logrus.Error("CDoctor.GetPatientVitals.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	accountId := paramObj.Get("account_id")
+
+	doctorId, err := ctrl.DoctorService.GetLinkedDoctorID(ctx, helper.GetAccountID(c))
+	if err != nil {
+		logrus.Error("CDoctor.GetPatientVitals.GetLinkedDoctorID.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	// Doctors only see vitals of their own patients
+	isPatient, err := ctrl.DoctorService.IsDoctorPatient(ctx, doctorId, accountId)
+	if err != nil {
+		logrus.Error("CDoctor.GetPatientVitals.IsDoctorPatient.", err)
+		helper.Fail(c, err)
+		return
+	}
+	if !isPatient {
+		logrus.Info("CDoctor.GetPatientVitals.NotDoctorPatient")
+		helper.Forbidden(c, errors.New("not your patient"))
+		return
+	}
+
+	var result []entity.TVitals
+	if err := ctrl.VitalsService.GetVitalsByPatient(ctx, accountId, &result); err != nil {
+		logrus.Error("CDoctor.GetPatientVitals.GetVitalsByPatient.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+// UpdateVisitStatus starts or completes the visit of a patient on one of the doctor's appointments
+func (ctrl *doctorController) UpdateVisitStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id", "account_id")
+	if err != nil {
+		logrus.Error("CDoctor.UpdateVisitStatus.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	accountId := paramObj.Get("account_id")
+
+	var reqBody entity.TUpdateStatusReq
+	if err := helper.ParseKindAndBody(c, "appointment#status", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	selfAccountID := helper.GetAccountID(c)
+
+	doctorId, err := ctrl.DoctorService.GetLinkedDoctorID(ctx, selfAccountID)
+	if err != nil {
+		logrus.Error("CDoctor.UpdateVisitStatus.GetLinkedDoctorID.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	if err := ctrl.DoctorService.UpdateVisitStatus(ctx, doctorId, appointmentId, accountId, selfAccountID, reqBody); err != nil {
+		logrus.Error("CDoctor.UpdateVisitStatus.UpdateVisitStatus.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *doctorController) GetQueue(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	doctorId, err := ctrl.DoctorService.GetLinkedDoctorID(ctx, helper.GetAccountID(c))
+	if err != nil {
+		logrus.Error("CDoctor.GetQueue.GetLinkedDoctorID.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	var result entity.TQueue
+	if err := ctrl.QueueService.GetQueue(ctx, doctorId, &result); err != nil {
+		logrus.Error("CDoctor.GetQueue.GetQueue.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+// CallNext calls the next waiting number of the doctor's own queue
+func (ctrl *doctorController) CallNext(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	doctorId, err := ctrl.DoctorService.GetLinkedDoctorID(ctx, helper.GetAccountID(c))
+	if err != nil {
+		logrus.Error("CDoctor.CallNext.GetLinkedDoctorID.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	result, err := ctrl.QueueService.CallNext(ctx, doctorId)
+	if err != nil {
+		logrus.Error("CDoctor.CallNext.CallNext.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/agustadewa/hospital-backend/service"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func NewNurseController(client *mongo.Client, repos repository.Repositories) *nurseController {
+	return &nurseController{
+		MongoClient:   client,
+		VitalsService: service.NewVitalsService(client, repos),
+	}
+}
+
+type nurseController struct {
+	MongoClient   *mongo.Client
+	VitalsService *service.Vitals
+}
+
+func (ctrl *nurseController) CreateVitals(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TCreateVitalsReq
+	if err := helper.ParseKindAndBody(c, "vitals#create", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	newOID := primitive.NewObjectID().Hex()
+	if err := ctrl.VitalsService.RecordVitals(ctx, newOID, helper.GetAccountID(c), reqBody); err != nil {
+		logrus.Error("CNurse.CreateVitals.RecordVitals.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TCreateVitalsRes{VitalsID: newOID})
+}
+
+func (ctrl *nurseController) GetPatientVitals(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "account_id")
+	if err != nil {
+		logrus.Error("CNurse.GetPatientVitals.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	var result []entity.TVitals
+	if err := ctrl.VitalsService.GetVitalsByPatient(ctx, paramObj.Get("account_id"), &result); err != nil {
+		logrus.Error("CNurse.GetPatientVitals.GetVitalsByPatient.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
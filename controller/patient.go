@@ -1 +1,253 @@
 package controller
+
+import (
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/agustadewa/hospital-backend/service"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func NewPatientController(client *mongo.Client, repos repository.Repositories) *patientController {
+	return &patientController{
+		MongoClient:        client,
+		PatientService:     service.NewPatientService(client, repos),
+		AppointmentService: service.NewAppointmentService(client, repos),
+		ScheduleService:    service.NewScheduleService(client, repos),
+	}
+}
+
+// Every handler is scoped to the account id middleware.HeaderVerifier puts on the gin context,
+// a patient can never address another patient's data.
+type patientController struct {
+	MongoClient        *mongo.Client
+	PatientService     *service.Patient
+	AppointmentService *service.Appointment
+	ScheduleService    *service.Schedule
+}
+
+func (ctrl *patientController) GetProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	selfAccountID := helper.GetAccountID(c)
+
+	var result entity.TAccount
+	if err := ctrl.PatientService.GetAccount(ctx, selfAccountID, &result); err != nil {
+		logrus.Error("CGetProfile.GetAccount.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *patientController) UpdateProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TUpdateAccountReq
+	if err := helper.ParseKindAndBody(c, "patient#updateprofile", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	selfAccountID := helper.GetAccountID(c)
+
+	if err := ctrl.PatientService.UpdateProfile(ctx, selfAccountID, reqBody); err != nil {
+		logrus.Error("CPatient.UpdateProfile.UpdateProfile.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *patientController) GetAppointments(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	selfAccountID := helper.GetAccountID(c)
+
+	var appointments []entity.TAppointment
+	if err := ctrl.AppointmentService.GetManyAppointmentByPatient(ctx, selfAccountID, &appointments); err != nil {
+		logrus.Error("CPatient.GetAppointments.GetManyAppointmentByPatient.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	result := make([]entity.TAppointmentRes, 0, len(appointments))
+	for _, appointment := range appointments {
+		result = append(result, ctrl.AppointmentService.ToPatientView(appointment, selfAccountID))
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *patientController) BookAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CPatient.BookAppointment.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	selfAccountID := helper.GetAccountID(c)
+
+	if err := ctrl.AppointmentService.Book(ctx, appointmentId, selfAccountID, selfAccountID); err != nil {
+		logrus.Error("CPatient.BookAppointment.Book.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+// BookSlot books the patient on a slot, the first booking of a slot creates its appointment
+func (ctrl *patientController) BookSlot(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TBookSlotReq
+	if err := helper.ParseKindAndBody(c, "slot#book", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	selfAccountID := helper.GetAccountID(c)
+
+	appointmentId, err := ctrl.ScheduleService.BookSlot(ctx, primitive.NewObjectID().Hex(), selfAccountID, selfAccountID, reqBody)
+	if err != nil {
+		logrus.Error("CPatient.BookSlot.BookSlot.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TBookSlotRes{AppointmentID: appointmentId})
+}
+
+func (ctrl *patientController) CancelAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CPatient.CancelAppointment.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	selfAccountID := helper.GetAccountID(c)
+
+	if err := ctrl.AppointmentService.Cancel(ctx, appointmentId, selfAccountID, selfAccountID); err != nil {
+		logrus.Error("CPatient.CancelAppointment.Cancel.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+// Reschedule moves the patient's booking to another appointment or slot, the original is kept on failure
+func (ctrl *patientController) Reschedule(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CPatient.Reschedule.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+
+	var reqBody entity.TRescheduleReq
+	if err := helper.ParseKindAndBody(c, "appointment#reschedule", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	selfAccountID := helper.GetAccountID(c)
+
+	toAppointmentId, err := ctrl.ScheduleService.Reschedule(ctx, appointmentId, primitive.NewObjectID().Hex(), selfAccountID, selfAccountID, reqBody)
+	if err != nil {
+		logrus.Error("CPatient.Reschedule.Reschedule.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TRescheduleRes{AppointmentID: toAppointmentId})
+}
+
+// JoinWaitlist queues the patient on a full appointment, they get the next free seat in turn
+func (ctrl *patientController) JoinWaitlist(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CPatient.JoinWaitlist.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	selfAccountID := helper.GetAccountID(c)
+
+	if err := ctrl.AppointmentService.JoinWaitlist(ctx, appointmentId, selfAccountID); err != nil {
+		logrus.Error("CPatient.JoinWaitlist.JoinWaitlist.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *patientController) LeaveWaitlist(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CPatient.LeaveWaitlist.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	selfAccountID := helper.GetAccountID(c)
+
+	if err := ctrl.AppointmentService.LeaveWaitlist(ctx, appointmentId, selfAccountID); err != nil {
+		logrus.Error("CPatient.LeaveWaitlist.LeaveWaitlist.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *patientController) GetWaitlistPosition(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CPatient.GetWaitlistPosition.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	selfAccountID := helper.GetAccountID(c)
+
+	result, err := ctrl.AppointmentService.GetWaitlistPosition(ctx, appointmentId, selfAccountID)
+	if err != nil {
+		logrus.Error("CPatient.GetWaitlistPosition.GetWaitlistPosition.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
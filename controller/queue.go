@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/agustadewa/hospital-backend/service"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// queueHeartbeat keeps idle board streams from being closed by proxies
+const queueHeartbeat = 15 * time.Second
+
+func NewQueueController(client *mongo.Client, repos repository.Repositories) *queueController {
+	return &queueController{
+		MongoClient:  client,
+		QueueService: service.NewQueueService(client, repos),
+	}
+}
+
+// The board routes are public, waiting room displays can't log in and boards carry no patient data.
+type queueController struct {
+	MongoClient  *mongo.Client
+	QueueService *service.Queue
+}
+
+func (ctrl *queueController) GetBoard(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "doctor_id")
+	if err != nil {
+		logrus.Error("CQueue.GetBoard.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	result, err := ctrl.QueueService.GetBoard(ctx, paramObj.Get("doctor_id"))
+	if err != nil {
+		logrus.Error("CQueue.GetBoard.GetBoard.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+// StreamBoard sends the board of the doctor as a "queue" Server-Sent Event on connect and after every change
+func (ctrl *queueController) StreamBoard(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "doctor_id")
+	if err != nil {
+		logrus.Error("CQueue.StreamBoard.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	doctorId := paramObj.Get("doctor_id")
+
+	// Subscribe before reading so no change falls between the first board and the stream
+	updates, unsubscribe := ctrl.QueueService.Subscribe(doctorId)
+	defer unsubscribe()
+
+	board, err := ctrl.QueueService.GetBoard(ctx, doctorId)
+	if err != nil {
+		logrus.Error("CQueue.StreamBoard.GetBoard.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(queueHeartbeat)
+	defer heartbeat.Stop()
+
+	c.SSEvent("queue", board)
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case board := <-updates:
+			c.SSEvent("queue", board)
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				logrus.Info("CQueue.StreamBoard.Ping.", err)
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/agustadewa/hospital-backend/service"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func NewReceptionController(client *mongo.Client, repos repository.Repositories) *receptionController {
+	return &receptionController{
+		MongoClient:        client,
+		PatientService:     service.NewPatientService(client, repos),
+		AppointmentService: service.NewAppointmentService(client, repos),
+		ScheduleService:    service.NewScheduleService(client, repos),
+		QueueService:       service.NewQueueService(client, repos),
+	}
+}
+
+// Receptionists manage bookings on behalf of patients, they can't touch accounts.
+type receptionController struct {
+	MongoClient        *mongo.Client
+	PatientService     *service.Patient
+	AppointmentService *service.Appointment
+	ScheduleService    *service.Schedule
+	QueueService       *service.Queue
+}
+
+func (ctrl *receptionController) GetManyAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TGetManyAppointmentReq
+	if err := helper.ParseKindAndBody(c, "appointment#getmany", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	var result []entity.TAppointment
+	page, err := ctrl.AppointmentService.GetManyAppointment(ctx, reqBody, &result)
+	if err != nil {
+		logrus.Error("CReception.GetManyAppointment.GetManyAppointment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TListRes{Items: result, TListPage: page})
+}
+
+func (ctrl *receptionController) BookAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id", "account_id")
+	if err != nil {
+		logrus.Error("CReception.BookAppointment.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	accountId := paramObj.Get("account_id")
+
+	if err := ctrl.PatientService.CheckIsPatient(ctx, accountId); err != nil {
+		logrus.Info("CReception.BookAppointment.CheckIsPatient.", err)
+		if err == service.ErrNotPatient || entity.IsNotFound(err) {
+			err = service.ErrPatientNotFound
+		}
+		helper.Fail(c, err)
+		return
+	}
+
+	if err := ctrl.AppointmentService.Book(ctx, appointmentId, accountId, helper.GetAccountID(c)); err != nil {
+		logrus.Error("CReception.BookAppointment.Book.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *receptionController) BookSlot(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "account_id")
+	if err != nil {
+		logrus.Error("CReception.BookSlot.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	accountId := paramObj.Get("account_id")
+
+	var reqBody entity.TBookSlotReq
+	if err := helper.ParseKindAndBody(c, "slot#book", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	if err := ctrl.PatientService.CheckIsPatient(ctx, accountId); err != nil {
+		logrus.Info("CReception.BookSlot.CheckIsPatient.", err)
+		if err == service.ErrNotPatient || entity.IsNotFound(err) {
+			err = service.ErrPatientNotFound
+		}
+		helper.Fail(c, err)
+		return
+	}
+
+	appointmentId, err := ctrl.ScheduleService.BookSlot(ctx, primitive.NewObjectID().Hex(), accountId, helper.GetAccountID(c), reqBody)
+	if err != nil {
+		logrus.Error("CReception.BookSlot.BookSlot.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TBookSlotRes{AppointmentID: appointmentId})
+}
+
+func (ctrl *receptionController) CancelAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id", "account_id")
+	if err != nil {
+		logrus.Error("CReception.CancelAppointment.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	accountId := paramObj.Get("account_id")
+
+	if err := ctrl.AppointmentService.Cancel(ctx, appointmentId, accountId, helper.GetAccountID(c)); err != nil {
+		logrus.Error("CReception.CancelAppointment.Cancel.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+func (ctrl *receptionController) Reschedule(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id", "account_id")
+	if err != nil {
+		logrus.Error("CReception.Reschedule.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	accountId := paramObj.Get("account_id")
+
+	var reqBody entity.TRescheduleReq
+	if err := helper.ParseKindAndBody(c, "appointment#reschedule", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	toAppointmentId, err := ctrl.ScheduleService.Reschedule(ctx, appointmentId, primitive.NewObjectID().Hex(), accountId, helper.GetAccountID(c), reqBody)
+	if err != nil {
+		logrus.Error("CReception.Reschedule.Reschedule.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TRescheduleRes{AppointmentID: toAppointmentId})
+}
+
+// GetAppointment returns the appointment with the status of every patient and its history
+func (ctrl *receptionController) GetAppointment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id")
+	if err != nil {
+		logrus.Error("CReception.GetAppointment.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+
+	var result entity.TAppointment
+	if err := ctrl.AppointmentService.GetAppointment(ctx, appointmentId, &result); err != nil {
+		logrus.Error("CReception.GetAppointment.GetAppointment.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *receptionController) UpdateStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "appointment_id", "account_id")
+	if err != nil {
+		logrus.Error("CReception.UpdateStatus.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	appointmentId := paramObj.Get("appointment_id")
+	accountId := paramObj.Get("account_id")
+
+	var reqBody entity.TUpdateStatusReq
+	if err := helper.ParseKindAndBody(c, "appointment#status", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	if err := ctrl.AppointmentService.UpdateStatus(ctx, appointmentId, accountId, helper.GetAccountID(c), reqBody); err != nil {
+		logrus.Error("CReception.UpdateStatus.UpdateStatus.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, nil)
+}
+
+// IssueQueue hands a booked patient or a walk-in the next number of the doctor's queue today
+func (ctrl *receptionController) IssueQueue(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var reqBody entity.TIssueQueueReq
+	if err := helper.ParseKindAndBody(c, "queue#issue", &reqBody); err != nil {
+		logrus.Error(err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	number, err := ctrl.QueueService.IssueTicket(ctx, reqBody)
+	if err != nil {
+		logrus.Error("CReception.IssueQueue.IssueTicket.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, entity.TIssueQueueRes{Number: number})
+}
+
+func (ctrl *receptionController) GetQueue(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "doctor_id")
+	if err != nil {
+		logrus.Error("CReception.GetQueue.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	var result entity.TQueue
+	if err := ctrl.QueueService.GetQueue(ctx, paramObj.Get("doctor_id"), &result); err != nil {
+		logrus.Error("CReception.GetQueue.GetQueue.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
+
+func (ctrl *receptionController) CallNext(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	paramObj, err := helper.HandleParam(c, "doctor_id")
+	if err != nil {
+		logrus.Error("CReception.CallNext.", err)
+		helper.BadRequest(c, err)
+		return
+	}
+
+	result, err := ctrl.QueueService.CallNext(ctx, paramObj.Get("doctor_id"))
+	if err != nil {
+		logrus.Error("CReception.CallNext.CallNext.", err)
+		helper.Fail(c, err)
+		return
+	}
+
+	helper.Ok(c, result)
+}
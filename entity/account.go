@@ -5,8 +5,12 @@ type TAccountRole string
 const (
 	PATIENT       TAccountRole = "PATIENT"
 	ADMINISTRATOR TAccountRole = "ADMINISTRATOR"
+	DOCTOR        TAccountRole = "DOCTOR"
+	NURSE         TAccountRole = "NURSE"
+	RECEPTIONIST  TAccountRole = "RECEPTIONIST"
 )
 
+// TAccount DoctorID links a DOCTOR account to its TDoctor record
 type TAccount struct {
 	AccountID string       `bson:"account_id" json:"account_id"`
 	Role      TAccountRole `bson:"role" json:"role"`
@@ -15,23 +19,59 @@ type TAccount struct {
 	Age       uint8        `bson:"age" json:"age"`
 	Email     string       `bson:"email" json:"email"`
 	Username  string       `bson:"username" json:"username"`
-	Password  string       `bson:"password" json:"password"`
+	Password  string       `bson:"password" json:"-"`
+	DoctorID  string       `bson:"doctor_id,omitempty" json:"doctor_id,omitempty"`
+
+	EmailVerified bool `bson:"email_verified" json:"email_verified"`
+
+	TOTPEnabled        bool     `bson:"totp_enabled" json:"totp_enabled"`
+	TOTPSecret         string   `bson:"totp_secret,omitempty" json:"-"`
+	TOTPPendingSecret  string   `bson:"totp_pending_secret,omitempty" json:"-"`
+	TOTPLastStep       int64    `bson:"totp_last_step,omitempty" json:"-"`
+	RecoveryCodeHashes []string `bson:"recovery_code_hashes,omitempty" json:"-"`
 }
 
-// type TUpdateAccount struct {
-// 	FirstName *string       `bson:"first_name,omitempty" json:"first_name,omitempty"`
-// 	LastName  *string       `bson:"last_name,omitempty" json:"last_name,omitempty"`
-// 	Age       *uint8        `bson:"age,omitempty" json:"age,omitempty"`
-// 	Password  *string       `bson:"password,omitempty" json:"password,omitempty"`
-// }
+type TUpdateAccount struct {
+	FirstName *string `bson:"first_name,omitempty" json:"first_name,omitempty"`
+	LastName  *string `bson:"last_name,omitempty" json:"last_name,omitempty"`
+	Age       *uint8  `bson:"age,omitempty" json:"age,omitempty"`
+	Email     *string `bson:"email,omitempty" json:"email,omitempty"`
+	Username  *string `bson:"username,omitempty" json:"username,omitempty"`
+	Password  *string `bson:"password,omitempty" json:"password,omitempty"`
+
+	EmailVerified *bool `bson:"email_verified,omitempty" json:"email_verified,omitempty"`
+}
 
+// TCreateAccountReq Role and DoctorID are only honoured on admin created accounts, Role defaults to ADMINISTRATOR
 type TCreateAccountReq struct {
-	FirstName string `json:"first_name" binding:"required"`
-	LastName  string `json:"last_name" binding:"required"`
-	Age       uint8  `json:"age" binding:"required"`
-	Email     string `json:"email" binding:"required"`
-	Username  string `json:"username" binding:"required"`
-	Password  string `json:"password" binding:"required"`
+	FirstName string       `json:"first_name" binding:"required"`
+	LastName  string       `json:"last_name" binding:"required"`
+	Age       uint8        `json:"age" binding:"required"`
+	Email     string       `json:"email" binding:"required"`
+	Username  string       `json:"username" binding:"required"`
+	Password  string       `json:"password" binding:"required"`
+	Role      TAccountRole `json:"role,omitempty"`
+	DoctorID  string       `json:"doctor_id,omitempty"`
+}
+
+// TUpdateAccountReq is a partial update, nil fields are left untouched.
+// CurrentPassword is required when the account owner changes their own password.
+type TUpdateAccountReq struct {
+	FirstName       *string `json:"first_name,omitempty"`
+	LastName        *string `json:"last_name,omitempty"`
+	Age             *uint8  `json:"age,omitempty"`
+	Email           *string `json:"email,omitempty"`
+	Username        *string `json:"username,omitempty"`
+	Password        *string `json:"password,omitempty"`
+	CurrentPassword *string `json:"current_password,omitempty"`
+}
+
+// TGetManyAccountReq Keyword matches the start of a word in the name, the email or the username.
+// An empty Role lists every role.
+type TGetManyAccountReq struct {
+	TListReq
+	Keyword string       `json:"keyword,omitempty"`
+	Role    TAccountRole `json:"role,omitempty"`
 }
 
 // ++++++++++++ RESPONSE +++++++++++++
@@ -1,11 +1,81 @@
 package entity
 
+import "time"
+
+// TAppointmentStatus is where a booked patient is in the visit, every patient of an appointment has their own
+type TAppointmentStatus string
+
+const (
+	REQUESTED   TAppointmentStatus = "requested"
+	CONFIRMED   TAppointmentStatus = "confirmed"
+	CHECKED_IN  TAppointmentStatus = "checked_in"
+	IN_PROGRESS TAppointmentStatus = "in_progress"
+	COMPLETED   TAppointmentStatus = "completed"
+	CANCELLED   TAppointmentStatus = "cancelled"
+	NO_SHOW     TAppointmentStatus = "no_show"
+	RESCHEDULED TAppointmentStatus = "rescheduled"
+)
+
+// TAppointment StartAt and EndAt are set on timed appointments, booked slots and sessions created with a time.
+// Sessions created before schedules existed have none.
+// PatientStatus is keyed by account id and keeps cancelled patients, who are no longer in PatientAccountIDs.
+// A booked patient without a status was booked before statuses existed and counts as REQUESTED.
+// Waitlist is first come first served, its head takes the next seat that opens.
 type TAppointment struct {
-	AppointmentID     string   `bson:"appointment_id" json:"appointment_id"`
-	DoctorID          string   `bson:"doctor_id" json:"doctor_id"`
-	PatientAccountIDs []string `bson:"patient_account_id" json:"patient_account_i_ds"`
-	Description       string   `bson:"description" json:"description"`
-	MaxAppointment    uint8    `bson:"max_appointment" json:"max_appointment"`
+	AppointmentID     string                        `bson:"appointment_id" json:"appointment_id"`
+	DoctorID          string                        `bson:"doctor_id" json:"doctor_id"`
+	PatientAccountIDs []string                      `bson:"patient_account_id" json:"patient_account_i_ds"`
+	Description       string                        `bson:"description" json:"description"`
+	MaxAppointment    uint8                         `bson:"max_appointment" json:"max_appointment"`
+	StartAt           *time.Time                    `bson:"start_at,omitempty" json:"start_at,omitempty"`
+	EndAt             *time.Time                    `bson:"end_at,omitempty" json:"end_at,omitempty"`
+	PatientStatus     map[string]TAppointmentStatus `bson:"patient_status,omitempty" json:"patient_status,omitempty"`
+	History           []TStatusChange               `bson:"history,omitempty" json:"history,omitempty"`
+	Waitlist          []TWaitlistEntry              `bson:"waitlist,omitempty" json:"waitlist,omitempty"`
+}
+
+// StatusOf returns the status of accountId, empty when the patient never booked
+func (a TAppointment) StatusOf(accountId string) TAppointmentStatus {
+	if status, ok := a.PatientStatus[accountId]; ok {
+		return status
+	}
+
+	for _, id := range a.PatientAccountIDs {
+		if id == accountId {
+			return REQUESTED
+		}
+	}
+
+	return ""
+}
+
+// WaitlistPosition returns the place of accountId on the waitlist starting at 1, 0 when not waiting
+func (a TAppointment) WaitlistPosition(accountId string) int {
+	for i, entry := range a.Waitlist {
+		if entry.AccountID == accountId {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+type TWaitlistEntry struct {
+	AccountID string    `bson:"account_id" json:"account_id"`
+	JoinedAt  time.Time `bson:"joined_at" json:"joined_at"`
+}
+
+// TStatusChange is one entry of the appointment history. AccountID is the patient whose status changed,
+// ChangedBy the account that changed it. FromStatus is empty on a booking.
+// RelatedAppointmentID is the other side of a reschedule, the target on the original and the original on the target.
+type TStatusChange struct {
+	AccountID            string             `bson:"account_id" json:"account_id"`
+	FromStatus           TAppointmentStatus `bson:"from_status,omitempty" json:"from_status,omitempty"`
+	ToStatus             TAppointmentStatus `bson:"to_status" json:"to_status"`
+	ChangedBy            string             `bson:"changed_by" json:"changed_by"`
+	ChangedAt            time.Time          `bson:"changed_at" json:"changed_at"`
+	Note                 string             `bson:"note,omitempty" json:"note,omitempty"`
+	RelatedAppointmentID string             `bson:"related_appointment_id,omitempty" json:"related_appointment_id,omitempty"`
 }
 
 type TUpdateAppointment struct {
@@ -14,3 +84,60 @@ type TUpdateAppointment struct {
 	Description       *string   `bson:"description,omitempty" json:"description,omitempty"`
 	MaxAppointment    *uint8    `bson:"max_appointment,omitempty" json:"max_appointment,omitempty"`
 }
+
+// TCreateAppointmentReq StartAt and EndAt are optional, but both or neither
+type TCreateAppointmentReq struct {
+	DoctorID       string     `json:"doctor_id" binding:"required"`
+	Description    string     `json:"description"`
+	MaxAppointment uint8      `json:"max_appointment" binding:"required"`
+	StartAt        *time.Time `json:"start_at,omitempty"`
+	EndAt          *time.Time `json:"end_at,omitempty"`
+}
+
+type TUpdateStatusReq struct {
+	Status TAppointmentStatus `json:"status" binding:"required"`
+	Note   string             `json:"note"`
+}
+
+// TRescheduleReq moves a booking to ToAppointmentID, or to the slot of DoctorID starting at StartAt
+type TRescheduleReq struct {
+	ToAppointmentID string     `json:"to_appointment_id"`
+	DoctorID        string     `json:"doctor_id"`
+	StartAt         *time.Time `json:"start_at"`
+	Note            string     `json:"note"`
+}
+
+type TGetManyAppointmentReq struct {
+	TListReq
+	DoctorID string `json:"doctor_id" binding:"required"`
+}
+
+// ++++++++++++ RESPONSE ++++++++++++
+
+type TCreateAppointmentRes struct {
+	AppointmentID string `json:"appointment_id"`
+}
+
+// TAppointmentRes is the patient facing view of an appointment, it hides other patients' account ids
+type TAppointmentRes struct {
+	AppointmentID    string             `json:"appointment_id"`
+	DoctorID         string             `json:"doctor_id"`
+	Description      string             `json:"description"`
+	MaxAppointment   uint8              `json:"max_appointment"`
+	StartAt          *time.Time         `json:"start_at,omitempty"`
+	EndAt            *time.Time         `json:"end_at,omitempty"`
+	BookedCount      int                `json:"booked_count"`
+	IsBooked         bool               `json:"is_booked"`
+	Status           TAppointmentStatus `json:"status,omitempty"`
+	WaitlistPosition int                `json:"waitlist_position,omitempty"`
+}
+
+type TRescheduleRes struct {
+	AppointmentID string `json:"appointment_id"`
+}
+
+// TWaitlistRes Position starts at 1, Length counts everybody waiting
+type TWaitlistRes struct {
+	Position int `json:"position"`
+	Length   int `json:"length"`
+}
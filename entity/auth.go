@@ -1,12 +1,63 @@
 package entity
 
+// LoginReq Identifier is an email or a username. Email is still read for older clients.
 type LoginReq struct {
-	Email    string `json:"email" binding:"required"`
+	Identifier string `json:"identifier"`
+	Email      string `json:"email"`
+	Password   string `json:"password" binding:"required"`
+}
+
+func (r LoginReq) GetIdentifier() string {
+	if r.Identifier != "" {
+		return r.Identifier
+	}
+
+	return r.Email
+}
+
+type RefreshReq struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TOTPLoginReq completes a two-step login, Code is a TOTP code or a recovery code
+type TOTPLoginReq struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TOTPEnrollLoginReq struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type TOTPConfirmReq struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPDisableReq struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+// MetaToken TokenID and Email are only set on purpose tokens, the jti makes them single use
 type MetaToken struct {
 	AccountID     string `json:"aid"`
+	SessionID     string `json:"sid"`
+	Purpose       string `json:"pur"`
+	TokenID       string `json:"jti"`
+	Email         string `json:"eml"`
 	ExpiredAt     int64  `json:"exp"`
 	IssuedAt      int64  `json:"iat"`
 	Authorization bool   `json:"aut"`
@@ -18,6 +69,23 @@ type AccessToken struct {
 
 // +++++++++++++ RESPONSE +++++++++++++++
 
+// LoginRes either carries the token pair, or MFARequired with an MFAToken for the second step.
+// MFAEnrollRequired tells the client to enroll TOTP through /auth/login/totp/enroll first.
 type LoginRes struct {
-	Authorization string `json:"authorization"`
+	Authorization     string   `json:"authorization,omitempty"`
+	RefreshToken      string   `json:"refresh_token,omitempty"`
+	ExpiresIn         int64    `json:"expires_in,omitempty"`
+	MFARequired       bool     `json:"mfa_required,omitempty"`
+	MFAEnrollRequired bool     `json:"mfa_enroll_required,omitempty"`
+	MFAToken          string   `json:"mfa_token,omitempty"`
+	RecoveryCodes     []string `json:"recovery_codes,omitempty"`
+}
+
+type TOTPEnrollRes struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TOTPConfirmRes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
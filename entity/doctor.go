@@ -1,18 +1,82 @@
 package entity
 
+import "strings"
+
+// TDoctor SearchWords holds the lowercased words of the names and specialty, kept by the service on every
+// write so a word prefix search can run on its index
 type TDoctor struct {
-	DoctorID  string `bson:"doctor_id" json:"doctor_id"`
-	FirstName string `bson:"first_name" json:"first_name"`
-	LastName  string `bson:"last_name" json:"last_name"`
+	DoctorID      string   `bson:"doctor_id" json:"doctor_id"`
+	FirstName     string   `bson:"first_name" json:"first_name"`
+	LastName      string   `bson:"last_name" json:"last_name"`
+	Specialty     string   `bson:"specialty" json:"specialty"`
+	Department    string   `bson:"department" json:"department"`
+	LicenseNumber string   `bson:"license_number" json:"license_number"`
+	Phone         string   `bson:"phone" json:"phone"`
+	Bio           string   `bson:"bio" json:"bio"`
+	IsActive      bool     `bson:"is_active" json:"is_active"`
+	SearchWords   []string `bson:"search_words" json:"-"`
+}
+
+// ComputeSearchWords returns the distinct lowercased words of the names and specialty
+func (d TDoctor) ComputeSearchWords() []string {
+	words := []string{}
+	for _, word := range strings.Fields(strings.ToLower(d.FirstName + " " + d.LastName + " " + d.Specialty)) {
+		isKnown := false
+		for _, known := range words {
+			if known == word {
+				isKnown = true
+				break
+			}
+		}
+		if !isKnown {
+			words = append(words, word)
+		}
+	}
+
+	return words
+}
+
+type TUpdateDoctor struct {
+	FirstName     *string   `bson:"first_name,omitempty" json:"first_name,omitempty"`
+	LastName      *string   `bson:"last_name,omitempty" json:"last_name,omitempty"`
+	Specialty     *string   `bson:"specialty,omitempty" json:"specialty,omitempty"`
+	Department    *string   `bson:"department,omitempty" json:"department,omitempty"`
+	LicenseNumber *string   `bson:"license_number,omitempty" json:"license_number,omitempty"`
+	Phone         *string   `bson:"phone,omitempty" json:"phone,omitempty"`
+	Bio           *string   `bson:"bio,omitempty" json:"bio,omitempty"`
+	IsActive      *bool     `bson:"is_active,omitempty" json:"is_active,omitempty"`
+	SearchWords   *[]string `bson:"search_words,omitempty" json:"-"`
 }
 
 type TCreateDoctorReq struct {
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Specialty     string `json:"specialty"`
+	Department    string `json:"department"`
+	LicenseNumber string `json:"license_number"`
+	Phone         string `json:"phone"`
+	Bio           string `json:"bio"`
+	IsActive      *bool  `json:"is_active,omitempty"`
+}
+
+type TUpdateDoctorReq struct {
+	FirstName     *string `json:"first_name,omitempty"`
+	LastName      *string `json:"last_name,omitempty"`
+	Specialty     *string `json:"specialty,omitempty"`
+	Department    *string `json:"department,omitempty"`
+	LicenseNumber *string `json:"license_number,omitempty"`
+	Phone         *string `json:"phone,omitempty"`
+	Bio           *string `json:"bio,omitempty"`
+	IsActive      *bool   `json:"is_active,omitempty"`
 }
 
+// TGetManyDoctorReq filters are combined with AND, empty fields are ignored
 type TGetManyDoctorReq struct {
-	Keyword string `json:"keyword"`
+	TListReq
+	Keyword    string `json:"keyword"`
+	Specialty  string `json:"specialty"`
+	Department string `json:"department"`
+	IsActive   *bool  `json:"is_active,omitempty"`
 }
 
 // ++++++++++++ RESPONSE ++++++++++++
@@ -0,0 +1,83 @@
+package entity
+
+import "errors"
+
+type TErrorKind string
+
+const (
+	ErrKindBadRequest      TErrorKind = "BAD_REQUEST"
+	ErrKindUnauthorized    TErrorKind = "UNAUTHORIZED"
+	ErrKindForbidden       TErrorKind = "FORBIDDEN"
+	ErrKindNotFound        TErrorKind = "NOT_FOUND"
+	ErrKindConflict        TErrorKind = "CONFLICT"
+	ErrKindValidation      TErrorKind = "VALIDATION"
+	ErrKindTooManyRequests TErrorKind = "TOO_MANY_REQUESTS"
+	ErrKindInternal        TErrorKind = "INTERNAL"
+)
+
+// TError is a domain error. Message is safe to show to clients, Cause is only ever logged.
+// Sentinels are shared pointers, so both err == ErrX and errors.Is keep working.
+type TError struct {
+	Kind    TErrorKind
+	Message string
+	Cause   error
+}
+
+func (e *TError) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+
+	return e.Message
+}
+
+func (e *TError) Unwrap() error {
+	return e.Cause
+}
+
+func NewBadRequestError(message string) *TError {
+	return &TError{Kind: ErrKindBadRequest, Message: message}
+}
+
+func NewUnauthorizedError(message string) *TError {
+	return &TError{Kind: ErrKindUnauthorized, Message: message}
+}
+
+func NewForbiddenError(message string) *TError {
+	return &TError{Kind: ErrKindForbidden, Message: message}
+}
+
+func NewNotFoundError(message string) *TError {
+	return &TError{Kind: ErrKindNotFound, Message: message}
+}
+
+func NewConflictError(message string) *TError {
+	return &TError{Kind: ErrKindConflict, Message: message}
+}
+
+func NewValidationError(message string) *TError {
+	return &TError{Kind: ErrKindValidation, Message: message}
+}
+
+func NewTooManyRequestsError(message string) *TError {
+	return &TError{Kind: ErrKindTooManyRequests, Message: message}
+}
+
+// NewInternalError hides cause behind a generic message
+func NewInternalError(cause error) *TError {
+	return &TError{Kind: ErrKindInternal, Message: "internal error", Cause: cause}
+}
+
+// ErrorKind returns the kind of the first TError in the chain, anything else is internal
+func ErrorKind(err error) TErrorKind {
+	var domainErr *TError
+	if errors.As(err, &domainErr) {
+		return domainErr.Kind
+	}
+
+	return ErrKindInternal
+}
+
+func IsNotFound(err error) bool {
+	return err != nil && ErrorKind(err) == ErrKindNotFound
+}
@@ -0,0 +1,17 @@
+package entity
+
+// TJWK is a public key in RFC 7517 format, only the members used by RSA and OKP keys are listed
+type TJWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type TJWKS struct {
+	Keys []TJWK `json:"keys"`
+}
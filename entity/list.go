@@ -0,0 +1,23 @@
+package entity
+
+// TListReq is embedded in every getmany request. Cursor is the next_cursor of the previous page and
+// only works with the same filters and sort, SortOrder is "asc" (default) or "desc".
+type TListReq struct {
+	Cursor    string `json:"cursor,omitempty"`
+	PageSize  int    `json:"page_size,omitempty"`
+	SortBy    string `json:"sort_by,omitempty"`
+	SortOrder string `json:"sort_order,omitempty"`
+}
+
+// TListPage NextCursor is empty on the last page, Total counts every match of the filters
+type TListPage struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int64  `json:"total"`
+}
+
+// ++++++++++++ RESPONSE ++++++++++++
+
+type TListRes struct {
+	Items interface{} `json:"items"`
+	TListPage
+}
@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// TLoginAttempt counts failed logins for one key, e.g. "ip:10.0.0.1" or "account:<account_id>"
+type TLoginAttempt struct {
+	Key           string    `bson:"key" json:"key"`
+	FailureCount  int       `bson:"failure_count" json:"failure_count"`
+	LastFailureAt time.Time `bson:"last_failure_at" json:"last_failure_at"`
+	LockedUntil   time.Time `bson:"locked_until" json:"locked_until"`
+}
@@ -0,0 +1,61 @@
+package entity
+
+type TPermission string
+
+const (
+	ACCOUNT_READ      TPermission = "account:read"
+	ACCOUNT_WRITE     TPermission = "account:write"
+	DOCTOR_READ       TPermission = "doctor:read"
+	DOCTOR_WRITE      TPermission = "doctor:write"
+	APPOINTMENT_READ  TPermission = "appointment:read"
+	APPOINTMENT_WRITE TPermission = "appointment:write"
+	APPOINTMENT_BOOK  TPermission = "appointment:book"
+	BOOKING_MANAGE    TPermission = "booking:manage"
+	SCHEDULE_READ     TPermission = "schedule:read"
+	VISIT_WRITE       TPermission = "visit:write"
+	VITALS_READ       TPermission = "vitals:read"
+	VITALS_WRITE      TPermission = "vitals:write"
+)
+
+// RolePermissions lists what each role may do, routes declare the permission they need
+var RolePermissions = map[TAccountRole][]TPermission{
+	PATIENT: {
+		DOCTOR_READ,
+		APPOINTMENT_READ,
+		APPOINTMENT_BOOK,
+	},
+	DOCTOR: {
+		DOCTOR_READ,
+		APPOINTMENT_READ,
+		SCHEDULE_READ,
+		VISIT_WRITE,
+		VITALS_READ,
+	},
+	NURSE: {
+		DOCTOR_READ,
+		APPOINTMENT_READ,
+		VITALS_READ,
+		VITALS_WRITE,
+	},
+	RECEPTIONIST: {
+		DOCTOR_READ,
+		APPOINTMENT_READ,
+		BOOKING_MANAGE,
+	},
+	ADMINISTRATOR: {
+		ACCOUNT_READ,
+		ACCOUNT_WRITE,
+		DOCTOR_READ,
+		DOCTOR_WRITE,
+		APPOINTMENT_READ,
+		APPOINTMENT_WRITE,
+		BOOKING_MANAGE,
+		VITALS_READ,
+	},
+}
+
+// IsValidRole reports whether role is one of the known account roles
+func IsValidRole(role TAccountRole) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
@@ -0,0 +1,57 @@
+package entity
+
+import "time"
+
+type TQueueTicketStatus string
+
+const (
+	QUEUE_WAITING TQueueTicketStatus = "waiting"
+	QUEUE_CALLED  TQueueTicketStatus = "called"
+	QUEUE_DONE    TQueueTicketStatus = "done"
+)
+
+// TQueueTicket is one number handed out at the desk. Booked patients carry their AccountID and
+// AppointmentID, walk-ins only a Name.
+type TQueueTicket struct {
+	Number        int                `bson:"number" json:"number"`
+	AccountID     string             `bson:"account_id,omitempty" json:"account_id,omitempty"`
+	AppointmentID string             `bson:"appointment_id,omitempty" json:"appointment_id,omitempty"`
+	Name          string             `bson:"name,omitempty" json:"name,omitempty"`
+	Status        TQueueTicketStatus `bson:"status" json:"status"`
+	IssuedAt      time.Time          `bson:"issued_at" json:"issued_at"`
+	CalledAt      *time.Time         `bson:"called_at,omitempty" json:"called_at,omitempty"`
+}
+
+// TQueue is the queue of one doctor on one clinic day, Date is "2006-01-02" in the clinic timezone.
+// CurrentNumber is the number being served, 0 before the first call.
+type TQueue struct {
+	DoctorID      string         `bson:"doctor_id" json:"doctor_id"`
+	Date          string         `bson:"date" json:"date"`
+	LastNumber    int            `bson:"last_number" json:"last_number"`
+	CurrentNumber int            `bson:"current_number" json:"current_number"`
+	Tickets       []TQueueTicket `bson:"tickets" json:"tickets"`
+	UpdatedAt     time.Time      `bson:"updated_at" json:"updated_at"`
+}
+
+// TIssueQueueReq needs AppointmentID and AccountID for a booked patient, or Name for a walk-in
+type TIssueQueueReq struct {
+	DoctorID      string `json:"doctor_id" binding:"required"`
+	AppointmentID string `json:"appointment_id"`
+	AccountID     string `json:"account_id"`
+	Name          string `json:"name"`
+}
+
+// ++++++++++++ RESPONSE ++++++++++++
+
+type TIssueQueueRes struct {
+	Number int `json:"number"`
+}
+
+// TQueueBoard is what the waiting room display shows, it carries no patient data
+type TQueueBoard struct {
+	DoctorID      string `json:"doctor_id"`
+	Date          string `json:"date"`
+	CurrentNumber int    `json:"current_number"`
+	LastNumber    int    `json:"last_number"`
+	WaitingCount  int    `json:"waiting_count"`
+}
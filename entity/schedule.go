@@ -0,0 +1,66 @@
+package entity
+
+import "time"
+
+// TWorkingHours is one weekly block of a doctor, StartTime and EndTime are "15:04" in the clinic timezone.
+// Weekday is 0 for Sunday up to 6 for Saturday.
+type TWorkingHours struct {
+	Weekday   time.Weekday `bson:"weekday" json:"weekday"`
+	StartTime string       `bson:"start_time" json:"start_time"`
+	EndTime   string       `bson:"end_time" json:"end_time"`
+}
+
+// TScheduleException closes the schedule between StartAt and EndAt, a holiday or a leave.
+// No slot overlapping it is generated.
+type TScheduleException struct {
+	StartAt time.Time `bson:"start_at" json:"start_at"`
+	EndAt   time.Time `bson:"end_at" json:"end_at"`
+	Reason  string    `bson:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// TWorkingSchedule is the weekly template slots are generated from. Every slot lasts SlotMinutes
+// and takes up to MaxPerSlot patients.
+type TWorkingSchedule struct {
+	DoctorID    string               `bson:"doctor_id" json:"doctor_id"`
+	SlotMinutes int                  `bson:"slot_minutes" json:"slot_minutes"`
+	MaxPerSlot  uint8                `bson:"max_per_slot" json:"max_per_slot"`
+	WeeklyHours []TWorkingHours      `bson:"weekly_hours" json:"weekly_hours"`
+	Exceptions  []TScheduleException `bson:"exceptions" json:"exceptions"`
+	UpdatedAt   time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+type TSetScheduleReq struct {
+	SlotMinutes int                  `json:"slot_minutes" binding:"required"`
+	MaxPerSlot  uint8                `json:"max_per_slot" binding:"required"`
+	WeeklyHours []TWorkingHours      `json:"weekly_hours" binding:"required"`
+	Exceptions  []TScheduleException `json:"exceptions"`
+}
+
+// TGetSlotsReq From and To bound the slot start times, the range is limited by schedule.max_slot_range_days
+type TGetSlotsReq struct {
+	DoctorID string    `json:"doctor_id" binding:"required"`
+	From     time.Time `json:"from" binding:"required"`
+	To       time.Time `json:"to" binding:"required"`
+}
+
+// TBookSlotReq StartAt must be the start of a free slot of the doctor
+type TBookSlotReq struct {
+	DoctorID string    `json:"doctor_id" binding:"required"`
+	StartAt  time.Time `json:"start_at" binding:"required"`
+}
+
+// ++++++++++++ RESPONSE ++++++++++++
+
+// TSlot AppointmentID is set once somebody booked the slot
+type TSlot struct {
+	DoctorID      string    `json:"doctor_id"`
+	StartAt       time.Time `json:"start_at"`
+	EndAt         time.Time `json:"end_at"`
+	Capacity      uint8     `json:"capacity"`
+	BookedCount   int       `json:"booked_count"`
+	AppointmentID string    `json:"appointment_id,omitempty"`
+}
+
+type TBookSlotRes struct {
+	AppointmentID string `json:"appointment_id"`
+}
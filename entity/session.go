@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// TSession is one refresh token family. Every refresh rotates RefreshTokenHash and keeps the
+// previous hash in UsedTokenHashes, presenting a used token again revokes the whole family.
+type TSession struct {
+	SessionID        string    `bson:"session_id" json:"session_id"`
+	AccountID        string    `bson:"account_id" json:"account_id"`
+	RefreshTokenHash string    `bson:"refresh_token_hash" json:"-"`
+	UsedTokenHashes  []string  `bson:"used_token_hashes" json:"-"`
+	IsRevoked        bool      `bson:"is_revoked" json:"is_revoked"`
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+	RefreshedAt      time.Time `bson:"refreshed_at" json:"refreshed_at"`
+	ExpiredAt        time.Time `bson:"expired_at" json:"expired_at"`
+}
@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// TUsedToken records a spent single use token by its jti, ExpiredAt is kept so old records can be purged
+type TUsedToken struct {
+	TokenID   string    `bson:"_id" json:"token_id"`
+	Purpose   string    `bson:"purpose" json:"purpose"`
+	AccountID string    `bson:"account_id" json:"account_id"`
+	UsedAt    time.Time `bson:"used_at" json:"used_at"`
+	ExpiredAt time.Time `bson:"expired_at" json:"expired_at"`
+}
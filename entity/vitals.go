@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+type TVitals struct {
+	VitalsID         string    `bson:"vitals_id" json:"vitals_id"`
+	PatientAccountID string    `bson:"patient_account_id" json:"patient_account_id"`
+	AppointmentID    string    `bson:"appointment_id,omitempty" json:"appointment_id,omitempty"`
+	RecordedBy       string    `bson:"recorded_by" json:"recorded_by"`
+	RecordedAt       time.Time `bson:"recorded_at" json:"recorded_at"`
+	BodyTemperature  float64   `bson:"body_temperature,omitempty" json:"body_temperature,omitempty"`
+	HeartRate        uint16    `bson:"heart_rate,omitempty" json:"heart_rate,omitempty"`
+	RespiratoryRate  uint16    `bson:"respiratory_rate,omitempty" json:"respiratory_rate,omitempty"`
+	SystolicBP       uint16    `bson:"systolic_bp,omitempty" json:"systolic_bp,omitempty"`
+	DiastolicBP      uint16    `bson:"diastolic_bp,omitempty" json:"diastolic_bp,omitempty"`
+	OxygenSaturation float64   `bson:"oxygen_saturation,omitempty" json:"oxygen_saturation,omitempty"`
+	Weight           float64   `bson:"weight,omitempty" json:"weight,omitempty"`
+	Height           float64   `bson:"height,omitempty" json:"height,omitempty"`
+	Note             string    `bson:"note,omitempty" json:"note,omitempty"`
+}
+
+type TCreateVitalsReq struct {
+	PatientAccountID string  `json:"patient_account_id" binding:"required"`
+	AppointmentID    string  `json:"appointment_id,omitempty"`
+	BodyTemperature  float64 `json:"body_temperature,omitempty"`
+	HeartRate        uint16  `json:"heart_rate,omitempty"`
+	RespiratoryRate  uint16  `json:"respiratory_rate,omitempty"`
+	SystolicBP       uint16  `json:"systolic_bp,omitempty"`
+	DiastolicBP      uint16  `json:"diastolic_bp,omitempty"`
+	OxygenSaturation float64 `json:"oxygen_saturation,omitempty"`
+	Weight           float64 `json:"weight,omitempty"`
+	Height           float64 `json:"height,omitempty"`
+	Note             string  `json:"note,omitempty"`
+}
+
+// ++++++++++++ RESPONSE ++++++++++++
+
+type TCreateVitalsRes struct {
+	VitalsID string `json:"vitals_id"`
+}
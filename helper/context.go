@@ -0,0 +1,48 @@
+package helper
+
+import (
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/gin-gonic/gin"
+)
+
+// Keys set on the gin context by middleware.HeaderVerifier.
+// They live on the context instead of request headers so a client can never spoof them.
+const (
+	ContextAccountID   = "account_id"
+	ContextAccountRole = "account_role"
+	ContextSessionID   = "session_id"
+)
+
+func SetAccount(c *gin.Context, accountId string, role entity.TAccountRole) {
+	c.Set(ContextAccountID, accountId)
+	c.Set(ContextAccountRole, role)
+}
+
+func SetSessionID(c *gin.Context, sessionId string) {
+	c.Set(ContextSessionID, sessionId)
+}
+
+func GetSessionID(c *gin.Context) string {
+	return c.GetString(ContextSessionID)
+}
+
+func GetAccountID(c *gin.Context) string {
+	return c.GetString(ContextAccountID)
+}
+
+func GetAccountRole(c *gin.Context) entity.TAccountRole {
+	role, _ := c.Get(ContextAccountRole)
+	accountRole, _ := role.(entity.TAccountRole)
+	return accountRole
+}
+
+// ContextLegacyStatus is set by middleware.LegacyStatus for clients that still expect every response as 200
+const ContextLegacyStatus = "legacy_status"
+
+func SetLegacyStatus(c *gin.Context) {
+	c.Set(ContextLegacyStatus, true)
+}
+
+func IsLegacyStatus(c *gin.Context) bool {
+	return c.GetBool(ContextLegacyStatus)
+}
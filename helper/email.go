@@ -0,0 +1,8 @@
+package helper
+
+import "strings"
+
+// NormalizeEmail is applied before an email is stored, emails are matched case-insensitively
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
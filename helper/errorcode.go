@@ -0,0 +1,72 @@
+package helper
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/agustadewa/hospital-backend/entity"
+)
+
+// ErrorCode is the machine-readable code in Error.Code, clients should branch on it rather than on the message
+type ErrorCode string
+
+const (
+	ErrCodeBadRequest      ErrorCode = "BAD_REQUEST"
+	ErrCodeUnauthorized    ErrorCode = "UNAUTHORIZED"
+	ErrCodeForbidden       ErrorCode = "FORBIDDEN"
+	ErrCodeNotFound        ErrorCode = "NOT_FOUND"
+	ErrCodeConflict        ErrorCode = "CONFLICT"
+	ErrCodeValidation      ErrorCode = "VALIDATION_FAILED"
+	ErrCodeTooManyRequests ErrorCode = "TOO_MANY_REQUESTS"
+	ErrCodeInternal        ErrorCode = "INTERNAL"
+)
+
+var errorCodeStatus = map[ErrorCode]int{
+	ErrCodeBadRequest:      http.StatusBadRequest,
+	ErrCodeUnauthorized:    http.StatusUnauthorized,
+	ErrCodeForbidden:       http.StatusForbidden,
+	ErrCodeNotFound:        http.StatusNotFound,
+	ErrCodeConflict:        http.StatusConflict,
+	ErrCodeValidation:      http.StatusUnprocessableEntity,
+	ErrCodeTooManyRequests: http.StatusTooManyRequests,
+	ErrCodeInternal:        http.StatusInternalServerError,
+}
+
+// legacyErrorCode is the code legacy clients get, the only two they ever received: "401" for failed
+// authentication and authorization, "400" for everything else
+func legacyErrorCode(code ErrorCode) string {
+	switch code {
+	case ErrCodeUnauthorized, ErrCodeForbidden:
+		return strconv.Itoa(http.StatusUnauthorized)
+	default:
+		return strconv.Itoa(http.StatusBadRequest)
+	}
+}
+
+// errorKindCode maps the domain error kinds to their response code
+var errorKindCode = map[entity.TErrorKind]ErrorCode{
+	entity.ErrKindBadRequest:      ErrCodeBadRequest,
+	entity.ErrKindUnauthorized:    ErrCodeUnauthorized,
+	entity.ErrKindForbidden:       ErrCodeForbidden,
+	entity.ErrKindNotFound:        ErrCodeNotFound,
+	entity.ErrKindConflict:        ErrCodeConflict,
+	entity.ErrKindValidation:      ErrCodeValidation,
+	entity.ErrKindTooManyRequests: ErrCodeTooManyRequests,
+	entity.ErrKindInternal:        ErrCodeInternal,
+}
+
+// Status returns the HTTP status of code, unknown codes are internal errors
+func (code ErrorCode) Status() int {
+	if status, isExists := errorCodeStatus[code]; isExists {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// LegacyStatusHeader lets a client opt back in to the old responses, every error sent as 200
+// with "400" or "401" in Error.Code
+const (
+	LegacyStatusHeader = "X-Status-Compat"
+	LegacyStatusValue  = "legacy"
+)
@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"crypto/subtle"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHashCost is the bcrypt cost used for new hashes.
+// bcrypt hashes are self-describing ("$2a$<cost>$<salt><hash>"), so the algorithm
+// and cost are stored alongside every hash and can be raised without a migration.
+const PasswordHashCost = 12
+
+// MaxPasswordBytes is the longest password bcrypt accepts, longer ones must be rejected before hashing
+const MaxPasswordBytes = 72
+
+// HashPassword function
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), PasswordHashCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashed), nil
+}
+
+// ComparePassword checks password against the stored value.
+// needsRehash is true when the stored value is legacy plaintext or was hashed with a lower cost,
+// so the caller can upgrade it after a successful match.
+func ComparePassword(stored, password string) (match bool, needsRehash bool) {
+	cost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		// legacy plaintext record
+		match = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return match, match
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)); err != nil {
+		return false, false
+	}
+
+	return true, cost < PasswordHashCost
+}
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/agustadewa/hospital-backend/entity"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator"
@@ -30,26 +31,73 @@ type Response struct {
 }
 
 func BadRequest(c *gin.Context, err error) {
-	if err == nil {
-		err = errors.New("")
+	FailWithCode(c, ErrCodeBadRequest, err)
+}
+
+func Unauthorized(c *gin.Context, err error) {
+	FailWithCode(c, ErrCodeUnauthorized, err)
+}
+
+func Forbidden(c *gin.Context, err error) {
+	FailWithCode(c, ErrCodeForbidden, err)
+}
+
+func NotFound(c *gin.Context, err error) {
+	FailWithCode(c, ErrCodeNotFound, err)
+}
+
+func Conflict(c *gin.Context, err error) {
+	FailWithCode(c, ErrCodeConflict, err)
+}
+
+func UnprocessableEntity(c *gin.Context, err error) {
+	FailWithCode(c, ErrCodeValidation, err)
+}
+
+func TooManyRequests(c *gin.Context, err error) {
+	FailWithCode(c, ErrCodeTooManyRequests, err)
+}
+
+func InternalServerError(c *gin.Context, err error) {
+	FailWithCode(c, ErrCodeInternal, err)
+}
+
+// Fail translates a domain error into its response. Errors that aren't an entity.TError are
+// answered as internal errors with a generic message, driver and library messages never reach clients.
+func Fail(c *gin.Context, err error) {
+	var domainErr *entity.TError
+	if !errors.As(err, &domainErr) {
+		domainErr = entity.NewInternalError(err)
 	}
 
-	c.JSON(http.StatusOK, Response{
-		Error: Error{
-			Code:    "400",
-			Message: err.Error(),
-		},
-	})
+	code, isExists := errorKindCode[domainErr.Kind]
+	if !isExists {
+		code = ErrCodeInternal
+	}
+
+	FailWithCode(c, code, errors.New(domainErr.Message))
 }
 
-func Unauthorized(c *gin.Context, err error) {
+// FailWithCode writes an error response with the status of code. Clients in legacy mode get the old
+// shape instead: 200 with the "400" or "401" code they always got.
+func FailWithCode(c *gin.Context, code ErrorCode, err error) {
 	if err == nil {
 		err = errors.New("")
 	}
 
-	c.JSON(http.StatusOK, Response{
+	if IsLegacyStatus(c) {
+		c.JSON(http.StatusOK, Response{
+			Error: Error{
+				Code:    legacyErrorCode(code),
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+
+	c.JSON(code.Status(), Response{
 		Error: Error{
-			Code:    "401",
+			Code:    string(code),
 			Message: err.Error(),
 		},
 	})
@@ -3,52 +3,207 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/agustadewa/hospital-backend/config"
 	"github.com/agustadewa/hospital-backend/controller"
+	"github.com/agustadewa/hospital-backend/entity"
 	"github.com/agustadewa/hospital-backend/helper"
 	"github.com/agustadewa/hospital-backend/middleware"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/agustadewa/hospital-backend/service"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func main() {
 	ctx := context.Background()
 
+	if err := service.InitKeyRing(); err != nil {
+		log.Fatal(err)
+	}
+
 	mongoClient := helper.NewMongoConnection(ctx, config.CONFIG.MongoURL)
 
+	// Unique indexes guard invariants the services only pre-check, don't serve without them. Account
+	// indexes blocked by duplicates already stored are the exception, they are logged and skipped.
+	if err := repository.EnsureIndexes(ctx, mongoClient); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := repository.Migrate(ctx, mongoClient); err != nil {
+		log.Fatal(err)
+	}
+
+	repos := repository.NewMongoRepositories(mongoClient)
+
+	r, err := newRouter(mongoClient, repos)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := r.Run(fmt.Sprintf("%s:%s", config.CONFIG.ServiceHost, config.CONFIG.ServicePort)); err != nil {
+		return
+	}
+}
+
+// newRouter wires every route. mongoClient only runs transactions, it is nil with the memory repositories.
+func newRouter(mongoClient *mongo.Client, repos repository.Repositories) (*gin.Engine, error) {
 	r := gin.Default()
+
+	// The login throttle keys on the client ip, only proxies we run may set it through X-Forwarded-For
+	if err := r.SetTrustedProxies(config.CONFIG.TrustedProxies); err != nil {
+		return nil, err
+	}
+
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{"http://localhost:8080", "http://localhost:3000"}
 	corsConfig.AllowCredentials = true
 	corsConfig.AddAllowMethods("GET", "POST", "PUT", "DELETE", "OPTIONS")
+	corsConfig.AddAllowHeaders(helper.LegacyStatusHeader)
 
 	r.Use(cors.New(corsConfig))
+	r.Use(middleware.LegacyStatus(config.CONFIG.LegacyStatusCodes))
+
+	authMiddleware := middleware.NewAuthMiddleware(mongoClient, repos)
+
+	r.GET("/.well-known/jwks.json", controller.JWKS)
 
 	auth := r.Group("/auth")
 	{
-		authController := controller.NewAuthController(mongoClient)
+		authController := controller.NewAuthController(mongoClient, repos)
 
 		auth.GET("/check", authController.CheckAuthentication)
 		auth.POST("/login", authController.Login)
+		auth.POST("/login/totp", authController.LoginTOTP)
+		auth.POST("/login/totp/enroll", authController.LoginTOTPEnroll)
 		auth.POST("/register", authController.Register)
+		auth.POST("/refresh", authController.Refresh)
+		auth.POST("/logout", authMiddleware.HeaderVerifier, authController.Logout)
+
+		auth.POST("/verifyemail", authController.VerifyEmail)
+		auth.POST("/resendverification", authMiddleware.HeaderVerifier, authController.ResendVerification)
+		auth.POST("/forgotpassword", authController.ForgotPassword)
+		auth.POST("/resetpassword", authController.ResetPassword)
+
+		auth.POST("/totp/enroll", authMiddleware.HeaderVerifier, authController.EnrollTOTP)
+		auth.POST("/totp/confirm", authMiddleware.HeaderVerifier, authController.ConfirmTOTP)
+		auth.POST("/totp/disable", authMiddleware.HeaderVerifier, authController.DisableTOTP)
 	}
 
 	admin := r.Group("/admin")
 	{
-		admin.Use(middleware.HeaderVerifier)
+		admin.Use(authMiddleware.HeaderVerifier, authMiddleware.RequireRole(entity.ADMINISTRATOR))
+
+		adminController := controller.NewAdminController(mongoClient, repos)
+		admin.GET("/getaccount/:account_id", authMiddleware.RequirePermission(entity.ACCOUNT_READ), adminController.GetAccount)
+		admin.POST("/getmanyaccount", authMiddleware.RequirePermission(entity.ACCOUNT_READ), adminController.GetManyAccount)
+		admin.POST("/createaccount", authMiddleware.RequirePermission(entity.ACCOUNT_WRITE), adminController.CreateAccount)
+		admin.POST("/updateaccount/:account_id", authMiddleware.RequirePermission(entity.ACCOUNT_WRITE), adminController.UpdateAccount)
+		admin.POST("/unlockaccount/:account_id", authMiddleware.RequirePermission(entity.ACCOUNT_WRITE), adminController.UnlockAccount)
 
-		adminController := controller.NewAdminController(mongoClient)
-		admin.GET("/getaccount/:account_id", adminController.GetAccount)
-		admin.POST("/createaccount", adminController.CreateAccount)
+		admin.POST("/createdoctor", authMiddleware.RequirePermission(entity.DOCTOR_WRITE), adminController.CreateDoctor)
+		admin.POST("/updatedoctor/:doctor_id", authMiddleware.RequirePermission(entity.DOCTOR_WRITE), adminController.UpdateDoctor)
+		admin.DELETE("/deletedoctor/:doctor_id", authMiddleware.RequirePermission(entity.DOCTOR_WRITE), adminController.DeleteDoctor)
+		admin.GET("/getworkingschedule/:doctor_id", authMiddleware.RequirePermission(entity.DOCTOR_READ), adminController.GetWorkingSchedule)
+		admin.POST("/setworkingschedule/:doctor_id", authMiddleware.RequirePermission(entity.DOCTOR_WRITE), adminController.SetWorkingSchedule)
 
-		admin.GET("/getdoctor/:doctor_id", adminController.GetDoctor)
-		admin.POST("/getmanydoctor", adminController.GetManyDoctor)
-		admin.POST("/createdoctor", adminController.CreateDoctor)
-		admin.DELETE("/deletedoctor/:doctor_id", adminController.DeleteDoctor)
+		admin.GET("/getappointment/:appointment_id", authMiddleware.RequirePermission(entity.APPOINTMENT_READ), adminController.GetAppointment)
+		admin.POST("/getmanyappointment", authMiddleware.RequirePermission(entity.APPOINTMENT_READ), adminController.GetManyAppointment)
+		admin.POST("/createappointment", authMiddleware.RequirePermission(entity.APPOINTMENT_WRITE), adminController.CreateAppointment)
+		admin.DELETE("/deleteappointment/:appointment_id", authMiddleware.RequirePermission(entity.APPOINTMENT_WRITE), adminController.DeleteAppointment)
 	}
 
-	if err := r.Run(fmt.Sprintf("%s:%s", config.CONFIG.ServiceHost, config.CONFIG.ServicePort)); err != nil {
-		return
+	// Doctor reads keep their /admin paths but every role holding DOCTOR_READ may use them
+	doctorRead := r.Group("/admin")
+	{
+		doctorRead.Use(authMiddleware.HeaderVerifier, authMiddleware.RequirePermission(entity.DOCTOR_READ))
+
+		doctorReadController := controller.NewAdminController(mongoClient, repos)
+		doctorRead.GET("/getdoctor/:doctor_id", doctorReadController.GetDoctor)
+		doctorRead.POST("/getmanydoctor", doctorReadController.GetManyDoctor)
 	}
+
+	appointment := r.Group("/appointment")
+	{
+		appointment.Use(authMiddleware.HeaderVerifier)
+
+		appointmentController := controller.NewAppointmentController(mongoClient, repos)
+		appointment.POST("/getmany", authMiddleware.RequirePermission(entity.APPOINTMENT_READ), appointmentController.GetManyAppointment)
+		appointment.POST("/getslots", authMiddleware.RequirePermission(entity.APPOINTMENT_READ), appointmentController.GetSlots)
+
+		// Deprecated, kept for clients from before the /patient routes, answer like their successors
+		legacyPatientController := controller.NewPatientController(mongoClient, repos)
+		appointment.GET("/getmine", middleware.Deprecated("/patient/getappointments"), authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), legacyPatientController.GetAppointments)
+		appointment.POST("/book/:appointment_id", middleware.Deprecated("/patient/bookappointment/:appointment_id"), authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), legacyPatientController.BookAppointment)
+		appointment.DELETE("/cancel/:appointment_id", middleware.Deprecated("/patient/cancelappointment/:appointment_id"), authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), legacyPatientController.CancelAppointment)
+	}
+
+	patient := r.Group("/patient")
+	{
+		patient.Use(authMiddleware.HeaderVerifier, authMiddleware.RequireRole(entity.PATIENT))
+
+		patientController := controller.NewPatientController(mongoClient, repos)
+		patient.GET("/getprofile", patientController.GetProfile)
+		patient.POST("/updateprofile", patientController.UpdateProfile)
+
+		patient.GET("/getappointments", authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), patientController.GetAppointments)
+		patient.POST("/bookappointment/:appointment_id", authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), patientController.BookAppointment)
+		patient.DELETE("/cancelappointment/:appointment_id", authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), patientController.CancelAppointment)
+		patient.POST("/reschedule/:appointment_id", authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), patientController.Reschedule)
+		patient.POST("/bookslot", authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), patientController.BookSlot)
+		patient.POST("/joinwaitlist/:appointment_id", authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), patientController.JoinWaitlist)
+		patient.DELETE("/leavewaitlist/:appointment_id", authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), patientController.LeaveWaitlist)
+		patient.GET("/getwaitlistposition/:appointment_id", authMiddleware.RequirePermission(entity.APPOINTMENT_BOOK), patientController.GetWaitlistPosition)
+	}
+
+	doctor := r.Group("/doctor")
+	{
+		doctor.Use(authMiddleware.HeaderVerifier, authMiddleware.RequireRole(entity.DOCTOR))
+
+		doctorController := controller.NewDoctorController(mongoClient, repos)
+		doctor.GET("/getschedule", authMiddleware.RequirePermission(entity.SCHEDULE_READ), doctorController.GetSchedule)
+		doctor.GET("/getworkingschedule", authMiddleware.RequirePermission(entity.SCHEDULE_READ), doctorController.GetWorkingSchedule)
+		doctor.GET("/getpatients", authMiddleware.RequirePermission(entity.SCHEDULE_READ), doctorController.GetPatients)
+		doctor.GET("/getpatientvitals/:account_id", authMiddleware.RequirePermission(entity.VITALS_READ), doctorController.GetPatientVitals)
+		doctor.POST("/updatestatus/:appointment_id/:account_id", authMiddleware.RequirePermission(entity.VISIT_WRITE), doctorController.UpdateVisitStatus)
+		doctor.GET("/getqueue", authMiddleware.RequirePermission(entity.SCHEDULE_READ), doctorController.GetQueue)
+		doctor.POST("/callnext", authMiddleware.RequirePermission(entity.VISIT_WRITE), doctorController.CallNext)
+	}
+
+	nurse := r.Group("/nurse")
+	{
+		nurse.Use(authMiddleware.HeaderVerifier, authMiddleware.RequireRole(entity.NURSE))
+
+		nurseController := controller.NewNurseController(mongoClient, repos)
+		nurse.POST("/createvitals", authMiddleware.RequirePermission(entity.VITALS_WRITE), nurseController.CreateVitals)
+		nurse.GET("/getpatientvitals/:account_id", authMiddleware.RequirePermission(entity.VITALS_READ), nurseController.GetPatientVitals)
+	}
+
+	reception := r.Group("/reception")
+	{
+		reception.Use(authMiddleware.HeaderVerifier, authMiddleware.RequirePermission(entity.BOOKING_MANAGE))
+
+		receptionController := controller.NewReceptionController(mongoClient, repos)
+		reception.GET("/getappointment/:appointment_id", receptionController.GetAppointment)
+		reception.POST("/getmanyappointment", receptionController.GetManyAppointment)
+		reception.POST("/bookappointment/:appointment_id/:account_id", receptionController.BookAppointment)
+		reception.DELETE("/cancelappointment/:appointment_id/:account_id", receptionController.CancelAppointment)
+		reception.POST("/reschedule/:appointment_id/:account_id", receptionController.Reschedule)
+		reception.POST("/bookslot/:account_id", receptionController.BookSlot)
+		reception.POST("/updatestatus/:appointment_id/:account_id", receptionController.UpdateStatus)
+		reception.POST("/issuequeue", receptionController.IssueQueue)
+		reception.GET("/getqueue/:doctor_id", receptionController.GetQueue)
+		reception.POST("/callnext/:doctor_id", receptionController.CallNext)
+	}
+
+	queue := r.Group("/queue")
+	{
+		queueController := controller.NewQueueController(mongoClient, repos)
+		queue.GET("/board/:doctor_id", queueController.GetBoard)
+		queue.GET("/stream/:doctor_id", queueController.StreamBoard)
+	}
+
+	return r, nil
 }
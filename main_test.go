@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/agustadewa/hospital-backend/service"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logrus.SetOutput(io.Discard)
+
+	config.JWTSecretKey = "test-secret"
+	if err := service.InitKeyRing(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// testServer is the full router on the memory repositories, without a Mongo client
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	repos  *repository.MemoryRepositories
+}
+
+func newTestServer(t *testing.T) *testServer {
+	repos := repository.NewMemoryRepositories()
+
+	router, err := newRouter(nil, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{t: t, router: router, repos: repos}
+}
+
+// do sends values wrapped in the kind envelope, a nil values sends no body
+func (s *testServer) do(method, path, token, kind string, values interface{}) (*httptest.ResponseRecorder, helper.Response) {
+	s.t.Helper()
+
+	var body io.Reader = http.NoBody
+	if values != nil {
+		b, err := json.Marshal(helper.Request{Kind: kind, Values: values})
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, req)
+
+	var res helper.Response
+	if err := json.Unmarshal(recorder.Body.Bytes(), &res); err != nil {
+		s.t.Fatalf("%s %s: %v in %q", method, path, err, recorder.Body.String())
+	}
+
+	return recorder, res
+}
+
+// expect fails the test unless the response has status, then decodes its values into result
+func (s *testServer) expect(recorder *httptest.ResponseRecorder, res helper.Response, status int, result interface{}) {
+	s.t.Helper()
+
+	if recorder.Code != status {
+		s.t.Fatalf("status %d, want %d: %s", recorder.Code, status, recorder.Body.String())
+	}
+
+	if result != nil {
+		b, err := json.Marshal(res.Values)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, result); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+}
+
+// register signs a patient up and returns their access token
+func (s *testServer) register(username, password string) string {
+	s.t.Helper()
+
+	var login entity.LoginRes
+	recorder, res := s.do(http.MethodPost, "/auth/register", "", "auth#register", entity.TCreateAccountReq{
+		FirstName: username,
+		LastName:  "Patient",
+		Age:       30,
+		Email:     username + "@example.com",
+		Username:  username,
+		Password:  password,
+	})
+	s.expect(recorder, res, http.StatusOK, &login)
+
+	return login.Authorization
+}
+
+// admin stores an administrator and opens a session for it, admin logins need TOTP
+func (s *testServer) admin() string {
+	s.t.Helper()
+
+	ctx := context.Background()
+	if err := s.repos.Account(ctx).Create(entity.TAccount{
+		AccountID: "admin",
+		Role:      entity.ADMINISTRATOR,
+		Email:     "admin@example.com",
+		Username:  "admin",
+	}); err != nil {
+		s.t.Fatal(err)
+	}
+
+	login, err := service.NewAuthService(nil, s.repos).CreateSession(ctx, "admin")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return login.Authorization
+}
+
+func TestRegisterLoginAndProfile(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice", "first-password")
+
+	var login entity.LoginRes
+	recorder, res := s.do(http.MethodPost, "/auth/login", "", "auth#login", entity.LoginReq{Identifier: "ALICE@example.com", Password: "first-password"})
+	s.expect(recorder, res, http.StatusOK, &login)
+	if login.Authorization == "" || login.RefreshToken == "" {
+		t.Fatalf("login returned no tokens: %+v", login)
+	}
+
+	var profile entity.TAccount
+	recorder, res = s.do(http.MethodGet, "/patient/getprofile", login.Authorization, "", nil)
+	s.expect(recorder, res, http.StatusOK, &profile)
+	if profile.Username != "alice" || profile.Role != entity.PATIENT {
+		t.Errorf("profile %+v", profile)
+	}
+
+	recorder, res = s.do(http.MethodPost, "/auth/login", "", "auth#login", entity.LoginReq{Identifier: "alice", Password: "wrong-password"})
+	s.expect(recorder, res, http.StatusUnauthorized, nil)
+
+	recorder, res = s.do(http.MethodGet, "/patient/getprofile", "", "", nil)
+	s.expect(recorder, res, http.StatusUnauthorized, nil)
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("bob", "first-password")
+
+	recorder, res := s.do(http.MethodPost, "/auth/logout", token, "", nil)
+	s.expect(recorder, res, http.StatusOK, nil)
+
+	recorder, res = s.do(http.MethodGet, "/patient/getprofile", token, "", nil)
+	s.expect(recorder, res, http.StatusUnauthorized, nil)
+}
+
+func TestPasswordChangeRevokesSessions(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("carol", "first-password")
+
+	newPassword, currentPassword := "second-password", "first-password"
+	recorder, res := s.do(http.MethodPost, "/patient/updateprofile", token, "patient#updateprofile", entity.TUpdateAccountReq{
+		Password:        &newPassword,
+		CurrentPassword: &currentPassword,
+	})
+	s.expect(recorder, res, http.StatusOK, nil)
+
+	recorder, res = s.do(http.MethodGet, "/patient/getprofile", token, "", nil)
+	s.expect(recorder, res, http.StatusUnauthorized, nil)
+
+	recorder, res = s.do(http.MethodPost, "/auth/login", "", "auth#login", entity.LoginReq{Identifier: "carol", Password: newPassword})
+	s.expect(recorder, res, http.StatusOK, nil)
+}
+
+func TestDoctorRoutesPermissions(t *testing.T) {
+	s := newTestServer(t)
+	adminToken := s.admin()
+	patientToken := s.register("dave", "first-password")
+
+	var created entity.TCreateDoctorRes
+	recorder, res := s.do(http.MethodPost, "/admin/createdoctor", adminToken, "doctor#create", entity.TCreateDoctorReq{FirstName: "Gregory", LastName: "House"})
+	s.expect(recorder, res, http.StatusOK, &created)
+
+	var doctor entity.TDoctor
+	recorder, res = s.do(http.MethodGet, "/admin/getdoctor/"+created.DoctorID, patientToken, "", nil)
+	s.expect(recorder, res, http.StatusOK, &doctor)
+	if doctor.LastName != "House" {
+		t.Errorf("doctor %+v", doctor)
+	}
+
+	recorder, res = s.do(http.MethodPost, "/admin/createdoctor", patientToken, "doctor#create", entity.TCreateDoctorReq{FirstName: "James", LastName: "Wilson"})
+	s.expect(recorder, res, http.StatusForbidden, nil)
+}
+
+func TestBookingUntilFull(t *testing.T) {
+	s := newTestServer(t)
+	adminToken := s.admin()
+	firstToken := s.register("erin", "first-password")
+	secondToken := s.register("frank", "first-password")
+
+	var doctor entity.TCreateDoctorRes
+	recorder, res := s.do(http.MethodPost, "/admin/createdoctor", adminToken, "doctor#create", entity.TCreateDoctorReq{FirstName: "Lisa", LastName: "Cuddy"})
+	s.expect(recorder, res, http.StatusOK, &doctor)
+
+	var appointment entity.TCreateAppointmentRes
+	recorder, res = s.do(http.MethodPost, "/admin/createappointment", adminToken, "appointment#create", entity.TCreateAppointmentReq{DoctorID: doctor.DoctorID, MaxAppointment: 1})
+	s.expect(recorder, res, http.StatusOK, &appointment)
+
+	recorder, res = s.do(http.MethodPost, "/patient/bookappointment/"+appointment.AppointmentID, firstToken, "", nil)
+	s.expect(recorder, res, http.StatusOK, nil)
+
+	recorder, res = s.do(http.MethodPost, "/patient/bookappointment/"+appointment.AppointmentID, secondToken, "", nil)
+	s.expect(recorder, res, http.StatusConflict, nil)
+
+	// The deprecated alias answers like its successor and says so
+	recorder, res = s.do(http.MethodPost, "/appointment/book/"+appointment.AppointmentID, secondToken, "", nil)
+	s.expect(recorder, res, http.StatusConflict, nil)
+	if recorder.Header().Get("Deprecation") != "true" {
+		t.Errorf("deprecated route sent no Deprecation header")
+	}
+
+	var mine []entity.TAppointmentRes
+	recorder, res = s.do(http.MethodGet, "/patient/getappointments", firstToken, "", nil)
+	s.expect(recorder, res, http.StatusOK, &mine)
+	if len(mine) != 1 || mine[0].Status != entity.REQUESTED {
+		t.Errorf("appointments %+v", mine)
+	}
+}
+
+func TestLoginGuardKeysOnTrustedClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		wantStatus     int
+	}{
+		// Without trusted proxies every login counts against the remote address, whatever it forwards
+		{name: "untrusted proxy", trustedProxies: nil, wantStatus: http.StatusTooManyRequests},
+		{name: "trusted proxy", trustedProxies: []string{"192.0.2.1"}, wantStatus: http.StatusUnauthorized},
+	}
+
+	trustedProxies := config.CONFIG.TrustedProxies
+	defer func() { config.CONFIG.TrustedProxies = trustedProxies }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.CONFIG.TrustedProxies = test.trustedProxies
+			s := newTestServer(t)
+
+			var recorder *httptest.ResponseRecorder
+			for i := 0; i <= config.CONFIG.LoginGuard.MaxAttempts; i++ {
+				b, err := json.Marshal(helper.Request{Kind: "auth#login", Values: entity.LoginReq{Identifier: "nobody", Password: "wrong-password"}})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// httptest requests come from 192.0.2.1:1234
+				req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(b))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+
+				recorder = httptest.NewRecorder()
+				s.router.ServeHTTP(recorder, req)
+			}
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("login past the attempts status %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -3,13 +3,26 @@ package middleware
 import (
 	"errors"
 
+	"github.com/agustadewa/hospital-backend/entity"
 	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
 	"github.com/agustadewa/hospital-backend/service"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func HeaderVerifier(c *gin.Context) {
+func NewAuthMiddleware(client *mongo.Client, repos repository.Repositories) *Auth {
+	return &Auth{AuthService: service.NewAuthService(client, repos)}
+}
+
+type Auth struct {
+	AuthService *service.Auth
+}
+
+// HeaderVerifier validates the bearer token, then resolves the account role once per request
+// and puts both on the gin context, read them back with helper.GetAccountID and helper.GetAccountRole.
+func (m *Auth) HeaderVerifier(c *gin.Context) {
 	token, err := service.VerifyTokenHeader(c)
 	if err != nil {
 		logrus.Error("MHeaderVerifier.VerifyTokenHeader.", err)
@@ -26,14 +39,77 @@ func HeaderVerifier(c *gin.Context) {
 		return
 	}
 
-	if accessToken.Claims.AccountID == "" {
+	// Purpose tokens such as the mfa token are only accepted by their own endpoint
+	if accessToken.Claims.AccountID == "" || accessToken.Claims.Purpose != "" {
 		logrus.Error("MHeaderVerifier.AccountID.IsNil")
 		helper.Unauthorized(c, errors.New("invalid token"))
 		c.Abort()
 		return
 	}
 
-	c.Request.Header.Set("Account-Id", accessToken.Claims.AccountID)
+	// Tokens are only as good as their session, a logout or refresh token reuse revokes it
+	isActive, err := m.AuthService.IsSessionActive(c.Request.Context(), accessToken.Claims.SessionID)
+	if err != nil || !isActive {
+		logrus.Error("MHeaderVerifier.IsSessionActive.", err)
+		helper.Unauthorized(c, errors.New("session revoked"))
+		c.Abort()
+		return
+	}
+
+	role, err := m.AuthService.ResolveRole(c.Request.Context(), accessToken.Claims.AccountID)
+	if err != nil {
+		logrus.Error("MHeaderVerifier.ResolveRole.", err)
+		helper.Unauthorized(c, errors.New("invalid token"))
+		c.Abort()
+		return
+	}
+
+	helper.SetAccount(c, accessToken.Claims.AccountID, role)
+	helper.SetSessionID(c, accessToken.Claims.SessionID)
 
 	c.Next()
 }
+
+// RequireRole allows the request when the account has one of roles, it must run after HeaderVerifier
+func (m *Auth) RequireRole(roles ...entity.TAccountRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountRole := helper.GetAccountRole(c)
+		for _, role := range roles {
+			if accountRole == role {
+				c.Next()
+				return
+			}
+		}
+
+		logrus.Info("MRequireRole.Forbidden.", accountRole)
+		helper.Forbidden(c, errors.New("forbidden"))
+		c.Abort()
+	}
+}
+
+// RequirePermission allows the request when the account role grants every permission, it must run after HeaderVerifier
+func (m *Auth) RequirePermission(permissions ...entity.TPermission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountRole := helper.GetAccountRole(c)
+		for _, permission := range permissions {
+			if !HasPermission(accountRole, permission) {
+				logrus.Info("MRequirePermission.Forbidden.", accountRole, permission)
+				helper.Forbidden(c, errors.New("forbidden"))
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func HasPermission(role entity.TAccountRole, permission entity.TPermission) bool {
+	for _, granted := range entity.RolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+
+	return false
+}
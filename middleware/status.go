@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/gin-gonic/gin"
+)
+
+// LegacyStatus switches the request to the old 200-always error responses, for every request when
+// isDefault is set, otherwise only for clients sending the helper.LegacyStatusHeader header
+func LegacyStatus(isDefault bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isDefault || strings.EqualFold(c.GetHeader(helper.LegacyStatusHeader), helper.LegacyStatusValue) {
+			helper.SetLegacyStatus(c)
+		}
+
+		c.Next()
+	}
+}
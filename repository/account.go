@@ -2,15 +2,30 @@ package repository
 
 import (
 	"context"
+	"strings"
 
 	"github.com/agustadewa/hospital-backend/config"
 	"github.com/agustadewa/hospital-backend/entity"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	accountEmailIndex    = "email_unique"
+	accountUsernameIndex = "username_unique"
+	accountDoctorIndex   = "doctor_id_unique"
+)
+
+var accountListSpec = listSpec{
+	idField:    "account_id",
+	sortFields: []string{"last_name", "first_name", "username", "email", "role", "account_id"},
+}
+
+// emailCollation makes email matching case-insensitive, queries must pass it to use the unique index
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
 func NewAccountRepo(ctx context.Context, client *mongo.Client) *AccountRepo {
 	const repoName = "account"
 	mongoConfig := config.CONFIG.Repositories[repoName]
@@ -27,9 +42,34 @@ type AccountRepo struct {
 	ctx  context.Context
 }
 
-func (r *AccountRepo) Create(payload entity.TAccount) error {
-	insertResult, err := r.coll.InsertOne(r.ctx, payload)
-	if err != nil || insertResult.InsertedID == primitive.NilObjectID {
+// EnsureIndexes creates the unique email and username indexes and the one linking a doctor to a single
+// DOCTOR account, the checks before an insert can race so these are what actually keeps duplicates out.
+// Accounts stored before them may already collide, e.g. emails differing only in case. The index is then
+// skipped and the colliding accounts are logged to be merged by hand, the next start builds it.
+func (r *AccountRepo) EnsureIndexes() error {
+	if err := r.ensureUniqueIndex("email", options.Index().SetName(accountEmailIndex).SetUnique(true).SetCollation(emailCollation), emailCollation); err != nil {
+		return err
+	}
+
+	if err := r.ensureUniqueIndex("username", options.Index().SetName(accountUsernameIndex).SetUnique(true), nil); err != nil {
+		return err
+	}
+
+	doctorFilter := bson.M{"role": entity.DOCTOR}
+	if err := r.ensureUniqueIndex("doctor_id", options.Index().SetName(accountDoctorIndex).SetUnique(true).SetPartialFilterExpression(doctorFilter), nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *AccountRepo) ensureUniqueIndex(field string, opts *options.IndexOptions, collation *options.Collation) error {
+	_, err := r.coll.Indexes().CreateOne(r.ctx, mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}}, Options: opts})
+	if mongo.IsDuplicateKeyError(err) {
+		logrus.Error("running without the unique ", field, " index, accounts share a value: ", err)
+		return r.logDuplicates(field, opts.PartialFilterExpression, collation)
+	}
+	if err != nil {
 		logrus.Error(err)
 		return err
 	}
@@ -37,34 +77,129 @@ func (r *AccountRepo) Create(payload entity.TAccount) error {
 	return nil
 }
 
+// logDuplicates logs every value of field held by more than one of the accounts matching filter, compared
+// under collation. A nil filter looks at every account.
+func (r *AccountRepo) logDuplicates(field string, filter interface{}, collation *options.Collation) error {
+	opts := options.Aggregate()
+	if collation != nil {
+		opts.SetCollation(collation)
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	cursor, err := r.coll.Aggregate(r.ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": "$" + field, "account_ids": bson.M{"$push": "$account_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}, opts)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	var duplicates []struct {
+		Value      string   `bson:"_id"`
+		AccountIDs []string `bson:"account_ids"`
+	}
+	if err = cursor.All(r.ctx, &duplicates); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	for _, duplicate := range duplicates {
+		logrus.Error("duplicate account ", field, " ", duplicate.Value, " held by ", strings.Join(duplicate.AccountIDs, ", "))
+	}
+
+	return nil
+}
+
+// duplicateAccountError tells which unique index rejected a write
+func duplicateAccountError(err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	if strings.Contains(err.Error(), accountUsernameIndex) {
+		return ErrDuplicateUsername
+	}
+	if strings.Contains(err.Error(), accountDoctorIndex) {
+		return ErrDuplicateDoctor
+	}
+
+	return ErrDuplicateEmail
+}
+
+func (r *AccountRepo) Create(payload entity.TAccount) error {
+	if _, err := r.coll.InsertOne(r.ctx, payload); err != nil {
+		logrus.Error(err)
+		return duplicateAccountError(err)
+	}
+
+	return nil
+}
+
 func (r *AccountRepo) Read(accountId string, result *entity.TAccount) error {
 	err := r.coll.FindOne(r.ctx, bson.M{"account_id": accountId}).Decode(result)
 	if err != nil {
 		logrus.Error(err)
-		return err
+		return notFound(err, ErrAccountNotFound)
 	}
 
 	return nil
 }
 
 func (r *AccountRepo) ReadByEmail(email string, result *entity.TAccount) error {
-	err := r.coll.FindOne(r.ctx, bson.M{"email": email}).Decode(result)
+	err := r.coll.FindOne(r.ctx, bson.M{"email": email}, options.FindOne().SetCollation(emailCollation)).Decode(result)
 	if err != nil {
 		logrus.Error(err)
-		return err
+		return notFound(err, ErrAccountNotFound)
 	}
 
 	return nil
 }
 
-func (r *AccountRepo) ReadMany(id string, result *[]entity.TAccount) error {
-	oid, err := primitive.ObjectIDFromHex(id)
+func (r *AccountRepo) ReadByUsername(username string, result *entity.TAccount) error {
+	err := r.coll.FindOne(r.ctx, bson.M{"username": username}).Decode(result)
 	if err != nil {
 		logrus.Error(err)
-		return err
+		return notFound(err, ErrAccountNotFound)
 	}
 
-	cursor, err := r.coll.Find(r.ctx, bson.M{"_id": oid})
+	return nil
+}
+
+// ReadManyByFilter pages the accounts matching the keyword and role
+func (r *AccountRepo) ReadManyByFilter(filter entity.TGetManyAccountReq, result *[]entity.TAccount) (entity.TListPage, error) {
+	query := bson.M{}
+	if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+
+	if keyword := strings.TrimSpace(filter.Keyword); keyword != "" {
+		wordPrefix := wordPrefixInsensitive(keyword)
+		query["$or"] = bson.A{
+			bson.M{"first_name": wordPrefix},
+			bson.M{"last_name": wordPrefix},
+			bson.M{"email": wordPrefix},
+			bson.M{"username": wordPrefix},
+		}
+	}
+
+	*result = []entity.TAccount{}
+
+	return findPage(r.ctx, r.coll, query, filter.TListReq, accountListSpec, func(cursor *mongo.Cursor) error {
+		var account entity.TAccount
+		if err := cursor.Decode(&account); err != nil {
+			return err
+		}
+		*result = append(*result, account)
+		return nil
+	})
+}
+
+func (r *AccountRepo) ReadManyByIDs(accountIds []string, result *[]entity.TAccount) error {
+	cursor, err := r.coll.Find(r.ctx, bson.M{"account_id": bson.M{"$in": accountIds}})
 	if err != nil {
 		logrus.Error(err)
 		return err
@@ -77,11 +212,8 @@ func (r *AccountRepo) ReadMany(id string, result *[]entity.TAccount) error {
 	return nil
 }
 
-func (r *AccountRepo) CheckIsAdmin(accountId string) (bool, error) {
-	count, err := r.coll.CountDocuments(r.ctx, bson.M{
-		"account_id": accountId,
-		"role":       entity.ADMINISTRATOR,
-	})
+func (r *AccountRepo) CheckAccountByEmail(email string) (bool, error) {
+	count, err := r.coll.CountDocuments(r.ctx, bson.M{"email": email}, options.Count().SetCollation(emailCollation))
 	if err != nil && err != mongo.ErrNoDocuments {
 		logrus.Error(err)
 		return false, err
@@ -94,8 +226,8 @@ func (r *AccountRepo) CheckIsAdmin(accountId string) (bool, error) {
 	return true, nil
 }
 
-func (r *AccountRepo) CheckAccountByEmail(email string) (bool, error) {
-	count, err := r.coll.CountDocuments(r.ctx, bson.M{"email": email})
+func (r *AccountRepo) CheckAccountByUsername(username string) (bool, error) {
+	count, err := r.coll.CountDocuments(r.ctx, bson.M{"username": username})
 	if err != nil && err != mongo.ErrNoDocuments {
 		logrus.Error(err)
 		return false, err
@@ -108,8 +240,8 @@ func (r *AccountRepo) CheckAccountByEmail(email string) (bool, error) {
 	return true, nil
 }
 
-func (r *AccountRepo) CheckAccountByUsername(username string) (bool, error) {
-	count, err := r.coll.CountDocuments(r.ctx, bson.M{"username": username})
+func (r *AccountRepo) CheckAccountByDoctor(doctorId string) (bool, error) {
+	count, err := r.coll.CountDocuments(r.ctx, bson.M{"doctor_id": doctorId})
 	if err != nil && err != mongo.ErrNoDocuments {
 		logrus.Error(err)
 		return false, err
@@ -121,3 +253,128 @@ func (r *AccountRepo) CheckAccountByUsername(username string) (bool, error) {
 
 	return true, nil
 }
+
+func (r *AccountRepo) UpdatePassword(accountId, password string) error {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{"account_id": accountId}, bson.M{"$set": bson.M{"password": password}})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if updateResult.MatchedCount == 0 {
+		err = ErrAccountNotFound
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *AccountRepo) Update(accountId string, payload entity.TUpdateAccount) error {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{"account_id": accountId}, bson.M{"$set": payload})
+	if err != nil {
+		logrus.Error(err)
+		return duplicateAccountError(err)
+	}
+
+	if updateResult.MatchedCount == 0 {
+		err = ErrAccountNotFound
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *AccountRepo) SetTOTPPendingSecret(accountId, secret string) error {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{"account_id": accountId}, bson.M{"$set": bson.M{"totp_pending_secret": secret}})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if updateResult.MatchedCount == 0 {
+		err = ErrAccountNotFound
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// EnableTOTP promotes the pending secret, the step that confirmed it is kept so the code can't be replayed
+func (r *AccountRepo) EnableTOTP(accountId, secret string, step int64, recoveryCodeHashes []string) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"account_id":          accountId,
+		"totp_pending_secret": secret,
+	}, bson.M{
+		"$set": bson.M{
+			"totp_enabled":         true,
+			"totp_secret":          secret,
+			"totp_last_step":       step,
+			"recovery_code_hashes": recoveryCodeHashes,
+		},
+		"$unset": bson.M{"totp_pending_secret": ""},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+func (r *AccountRepo) DisableTOTP(accountId string) error {
+	_, err := r.coll.UpdateOne(r.ctx, bson.M{"account_id": accountId}, bson.M{
+		"$set":   bson.M{"totp_enabled": false},
+		"$unset": bson.M{"totp_secret": "", "totp_pending_secret": "", "totp_last_step": "", "recovery_code_hashes": ""},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// UseTOTPStep records step as used only if it is newer than the last one, so a code works once
+func (r *AccountRepo) UseTOTPStep(accountId string, step int64) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"account_id": accountId,
+		"$or": bson.A{
+			bson.M{"totp_last_step": bson.M{"$lt": step}},
+			bson.M{"totp_last_step": bson.M{"$exists": false}},
+		},
+	}, bson.M{"$set": bson.M{"totp_last_step": step}})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes the code hash, it returns false when the code was unknown or already used
+func (r *AccountRepo) UseRecoveryCode(accountId, codeHash string) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"account_id":           accountId,
+		"recovery_code_hashes": codeHash,
+	}, bson.M{"$pull": bson.M{"recovery_code_hashes": codeHash}})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// MarkEmailVerified only matches while the account still has email, so a link sent to an old address does nothing
+func (r *AccountRepo) MarkEmailVerified(accountId, email string) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{"account_id": accountId, "email": email}, bson.M{"$set": bson.M{"email_verified": true}})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.MatchedCount == 1, nil
+}
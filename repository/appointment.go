@@ -2,15 +2,23 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/agustadewa/hospital-backend/config"
 	"github.com/agustadewa/hospital-backend/entity"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const appointmentSlotIndex = "doctor_slot_unique"
+
+var appointmentListSpec = listSpec{
+	idField:    "appointment_id",
+	sortFields: []string{"appointment_id", "start_at", "max_appointment"},
+}
+
 func NewAppointmentRepo(ctx context.Context, client *mongo.Client) *AppointmentRepo {
 	const repoName = "appointment"
 	mongoConfig := config.CONFIG.Repositories[repoName]
@@ -27,46 +35,126 @@ type AppointmentRepo struct {
 	ctx  context.Context
 }
 
-func (r *AppointmentRepo) Create(payload entity.TAppointment) error {
-	oid, err := primitive.ObjectIDFromHex(payload.AppointmentID)
+// EnsureIndexes creates the unique index that holds one appointment per doctor and start time,
+// timed appointments only
+func (r *AppointmentRepo) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateOne(r.ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "doctor_id", Value: 1}, {Key: "start_at", Value: 1}},
+		Options: options.Index().
+			SetName(appointmentSlotIndex).
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"start_at": bson.M{"$exists": true}}),
+	})
 	if err != nil {
 		logrus.Error(err)
 		return err
 	}
 
-	insertResult, err := r.coll.InsertOne(r.ctx, bson.M{"_id": oid})
-	if err != nil || insertResult.InsertedID == primitive.NilObjectID {
+	return nil
+}
+
+func (r *AppointmentRepo) Create(payload entity.TAppointment) error {
+	if _, err := r.coll.InsertOne(r.ctx, payload); err != nil {
 		logrus.Error(err)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateSlot
+		}
 		return err
 	}
 
 	return nil
 }
 
-func (r *AppointmentRepo) Read(id string, result *entity.TAppointment) error {
-	oid, err := primitive.ObjectIDFromHex(id)
+func (r *AppointmentRepo) Read(appointmentId string, result *entity.TAppointment) error {
+	err := r.coll.FindOne(r.ctx, bson.M{"appointment_id": appointmentId}).Decode(result)
 	if err != nil {
 		logrus.Error(err)
-		return err
+		return notFound(err, ErrAppointmentNotFound)
 	}
 
-	err = r.coll.FindOne(r.ctx, bson.M{"_id": oid}).Decode(result)
+	return nil
+}
+
+// ReadManyByFilter pages the appointments of a doctor
+func (r *AppointmentRepo) ReadManyByFilter(filter entity.TGetManyAppointmentReq, result *[]entity.TAppointment) (entity.TListPage, error) {
+	*result = []entity.TAppointment{}
+
+	return findPage(r.ctx, r.coll, bson.M{"doctor_id": filter.DoctorID}, filter.TListReq, appointmentListSpec, func(cursor *mongo.Cursor) error {
+		var appointment entity.TAppointment
+		if err := cursor.Decode(&appointment); err != nil {
+			return err
+		}
+		*result = append(*result, appointment)
+		return nil
+	})
+}
+
+func (r *AppointmentRepo) ReadManyByDoctor(doctorId string, result *[]entity.TAppointment) error {
+	cursor, err := r.coll.Find(r.ctx, bson.M{"doctor_id": doctorId})
 	if err != nil {
 		logrus.Error(err)
 		return err
 	}
 
+	if err = cursor.All(r.ctx, result); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	return nil
+}
+
+// ReadBySlot reads the appointment of doctorId starting exactly at startAt
+func (r *AppointmentRepo) ReadBySlot(doctorId string, startAt time.Time, result *entity.TAppointment) error {
+	err := r.coll.FindOne(r.ctx, bson.M{"doctor_id": doctorId, "start_at": startAt}).Decode(result)
+	if err != nil {
+		logrus.Error(err)
+		return notFound(err, ErrAppointmentNotFound)
+	}
+
 	return nil
 }
 
-func (r *AppointmentRepo) ReadMany(id string, result *[]entity.TAppointment) error {
-	oid, err := primitive.ObjectIDFromHex(id)
+// ReadManyByDoctorRange reads the timed appointments of doctorId overlapping [from, to)
+func (r *AppointmentRepo) ReadManyByDoctorRange(doctorId string, from, to time.Time, result *[]entity.TAppointment) error {
+	opts := options.Find().SetSort(bson.D{{Key: "start_at", Value: 1}})
+	cursor, err := r.coll.Find(r.ctx, bson.M{
+		"doctor_id": doctorId,
+		"start_at":  bson.M{"$lt": to},
+		"end_at":    bson.M{"$gt": from},
+	}, opts)
 	if err != nil {
 		logrus.Error(err)
 		return err
 	}
 
-	cursor, err := r.coll.Find(r.ctx, bson.M{"_id": oid})
+	if err = cursor.All(r.ctx, result); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	return nil
+}
+
+// CheckOverlap reports whether doctorId has a timed appointment overlapping [startAt, endAt)
+func (r *AppointmentRepo) CheckOverlap(doctorId string, startAt, endAt time.Time) (bool, error) {
+	count, err := r.coll.CountDocuments(r.ctx, bson.M{
+		"doctor_id": doctorId,
+		"start_at":  bson.M{"$lt": endAt},
+		"end_at":    bson.M{"$gt": startAt},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// ReadManyByPatient reads the appointments accountId is booked on or waiting for
+func (r *AppointmentRepo) ReadManyByPatient(accountId string, result *[]entity.TAppointment) error {
+	cursor, err := r.coll.Find(r.ctx, bson.M{"$or": bson.A{
+		bson.M{"patient_account_id": accountId},
+		bson.M{"waitlist.account_id": accountId},
+	}})
 	if err != nil {
 		logrus.Error(err)
 		return err
@@ -79,9 +167,32 @@ func (r *AppointmentRepo) ReadMany(id string, result *[]entity.TAppointment) err
 	return nil
 }
 
+func (r *AppointmentRepo) CheckPatientWithDoctor(doctorId, accountId string) (bool, error) {
+	count, err := r.coll.CountDocuments(r.ctx, bson.M{
+		"doctor_id":          doctorId,
+		"patient_account_id": accountId,
+	})
+	if err != nil && err != mongo.ErrNoDocuments {
+		logrus.Error(err)
+		return false, err
+	}
+
+	if count == 0 {
+		return false, nil
+	}
+
+	return true, nil
+}
+
 func (r *AppointmentRepo) Update(appointmentId string, payload entity.TUpdateAppointment) error {
-	delResult, err := r.coll.UpdateOne(r.ctx, bson.M{"appointment_id": appointmentId}, bson.M{"$set": payload})
-	if err != nil || delResult.MatchedCount == 0 {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{"appointment_id": appointmentId}, bson.M{"$set": payload})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if updateResult.MatchedCount == 0 {
+		err = ErrAppointmentNotFound
 		logrus.Error(err)
 		return err
 	}
@@ -91,11 +202,188 @@ func (r *AppointmentRepo) Update(appointmentId string, payload entity.TUpdateApp
 
 func (r *AppointmentRepo) Delete(appointId string) error {
 	delResult, err := r.coll.DeleteOne(r.ctx, bson.M{"appointment_id": appointId})
-	if err != nil || delResult.DeletedCount == 0 {
-		err = mongo.ErrNoDocuments
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if delResult.DeletedCount == 0 {
+		err = ErrAppointmentNotFound
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteManyByDoctor removes every appointment of the doctor, a doctor without any is not an error
+func (r *AppointmentRepo) DeleteManyByDoctor(doctorId string) error {
+	if _, err := r.coll.DeleteMany(r.ctx, bson.M{"doctor_id": doctorId}); err != nil {
 		logrus.Error(err)
 		return err
 	}
 
 	return nil
 }
+
+// DeleteUnused removes the appointment only while nobody ever booked or waited on it.
+// It returns false when the guard did not match.
+func (r *AppointmentRepo) DeleteUnused(appointmentId string) (bool, error) {
+	delResult, err := r.coll.DeleteOne(r.ctx, bson.M{
+		"appointment_id":       appointmentId,
+		"patient_account_id.0": bson.M{"$exists": false},
+		"waitlist.0":           bson.M{"$exists": false},
+		"history.0":            bson.M{"$exists": false},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return delResult.DeletedCount == 1, nil
+}
+
+// AddPatient appends the patient of change in a single conditional update, so concurrent bookings can never
+// go over max_appointment or add the same patient twice. A free seat only goes to a patient while nobody
+// waits for it, or to the head of the waitlist. The status and history entry are written with it and the
+// patient leaves the waitlist if they were on it.
+// It returns false when the guard did not match, the caller decides why.
+func (r *AppointmentRepo) AddPatient(appointmentId string, change entity.TStatusChange) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"appointment_id":     appointmentId,
+		"patient_account_id": bson.M{"$ne": change.AccountID},
+		"$or": bson.A{
+			bson.M{"waitlist.0": bson.M{"$exists": false}},
+			bson.M{"waitlist.0.account_id": change.AccountID},
+		},
+		"$expr": bson.M{"$lt": bson.A{
+			bson.M{"$size": bson.M{"$ifNull": bson.A{"$patient_account_id", bson.A{}}}},
+			"$max_appointment",
+		}},
+	}, bson.M{
+		"$push": bson.M{"patient_account_id": change.AccountID, "history": change},
+		"$set":  bson.M{"patient_status." + change.AccountID: change.ToStatus},
+		"$pull": bson.M{"waitlist": bson.M{"account_id": change.AccountID}},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// AddToWaitlist appends entry to the waitlist only while the appointment is full or others already wait,
+// and the patient is neither booked nor waiting.
+// It returns false when the guard did not match, the caller decides why.
+func (r *AppointmentRepo) AddToWaitlist(appointmentId string, entry entity.TWaitlistEntry) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"appointment_id":      appointmentId,
+		"patient_account_id":  bson.M{"$ne": entry.AccountID},
+		"waitlist.account_id": bson.M{"$ne": entry.AccountID},
+		"$or": bson.A{
+			bson.M{"waitlist.0": bson.M{"$exists": true}},
+			bson.M{"$expr": bson.M{"$gte": bson.A{
+				bson.M{"$size": bson.M{"$ifNull": bson.A{"$patient_account_id", bson.A{}}}},
+				"$max_appointment",
+			}}},
+		},
+	}, bson.M{"$push": bson.M{"waitlist": entry}})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// RemoveFromWaitlist pulls accountId from the waitlist.
+// It returns false when the patient was not waiting.
+func (r *AppointmentRepo) RemoveFromWaitlist(appointmentId, accountId string) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"appointment_id":      appointmentId,
+		"waitlist.account_id": accountId,
+	}, bson.M{"$pull": bson.M{"waitlist": bson.M{"account_id": accountId}}})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// PromoteWaitlisted moves the head of the waitlist, the patient of change, onto a free seat in a single
+// conditional update. A concurrent booking or promotion makes the guard miss.
+// It returns false when the guard did not match, the caller decides why.
+func (r *AppointmentRepo) PromoteWaitlisted(appointmentId string, change entity.TStatusChange) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"appointment_id":        appointmentId,
+		"waitlist.0.account_id": change.AccountID,
+		"patient_account_id":    bson.M{"$ne": change.AccountID},
+		"$expr": bson.M{"$lt": bson.A{
+			bson.M{"$size": bson.M{"$ifNull": bson.A{"$patient_account_id", bson.A{}}}},
+			"$max_appointment",
+		}},
+	}, bson.M{
+		"$pop":  bson.M{"waitlist": -1},
+		"$push": bson.M{"patient_account_id": change.AccountID, "history": change},
+		"$set":  bson.M{"patient_status." + change.AccountID: change.ToStatus},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// RemovePatient pulls the patient of change only when it is booked with one of the from statuses,
+// the seat is released and the status kept.
+// It returns false when the guard did not match, the caller decides why.
+func (r *AppointmentRepo) RemovePatient(appointmentId string, from []entity.TAppointmentStatus, change entity.TStatusChange) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, patientStatusFilter(appointmentId, change.AccountID, from), bson.M{
+		"$pull": bson.M{"patient_account_id": change.AccountID},
+		"$push": bson.M{"history": change},
+		"$set":  bson.M{"patient_status." + change.AccountID: change.ToStatus},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// UpdatePatientStatus moves the patient of change to its status only when it is booked with one of
+// the from statuses, concurrent transitions can't both apply.
+// It returns false when the guard did not match, the caller decides why.
+func (r *AppointmentRepo) UpdatePatientStatus(appointmentId string, from []entity.TAppointmentStatus, change entity.TStatusChange) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, patientStatusFilter(appointmentId, change.AccountID, from), bson.M{
+		"$push": bson.M{"history": change},
+		"$set":  bson.M{"patient_status." + change.AccountID: change.ToStatus},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// patientStatusFilter matches the appointment when accountId is booked with one of the from statuses.
+// A missing status is REQUESTED, $in matches it with null.
+func patientStatusFilter(appointmentId, accountId string, from []entity.TAppointmentStatus) bson.M {
+	statuses := bson.A{}
+	for _, status := range from {
+		statuses = append(statuses, status)
+		if status == entity.REQUESTED {
+			statuses = append(statuses, nil)
+		}
+	}
+
+	return bson.M{
+		"appointment_id":              appointmentId,
+		"patient_account_id":          accountId,
+		"patient_status." + accountId: bson.M{"$in": statuses},
+	}
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"regexp"
+	"strings"
 
 	"github.com/agustadewa/hospital-backend/config"
 	"github.com/agustadewa/hospital-backend/entity"
@@ -9,8 +11,21 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	doctorSearchIndex     = "doctor_search"
+	doctorWordsIndex      = "search_words"
+	doctorNameWeight      = 10
+	doctorSpecialtyWeight = 5
+)
+
+var doctorListSpec = listSpec{
+	idField:    "doctor_id",
+	sortFields: []string{"last_name", "first_name", "specialty", "doctor_id"},
+}
+
 func NewDoctorRepo(ctx context.Context, client *mongo.Client) *DoctorRepo {
 	const repoName = "doctor"
 	mongoConfig := config.CONFIG.Repositories[repoName]
@@ -27,9 +42,87 @@ type DoctorRepo struct {
 	ctx  context.Context
 }
 
+// EnsureIndexes creates the text index keyword search runs on. Stemming is off, names are not words
+// of a language, and a match on a name weighs more than one on the specialty. The search words index
+// serves the word prefix fallback.
+func (r *DoctorRepo) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "first_name", Value: "text"},
+				{Key: "last_name", Value: "text"},
+				{Key: "specialty", Value: "text"},
+			},
+			Options: options.Index().
+				SetName(doctorSearchIndex).
+				SetDefaultLanguage("none").
+				SetWeights(bson.D{
+					{Key: "first_name", Value: doctorNameWeight},
+					{Key: "last_name", Value: doctorNameWeight},
+					{Key: "specialty", Value: doctorSpecialtyWeight},
+				}),
+		},
+		{
+			Keys:    bson.D{{Key: "search_words", Value: 1}},
+			Options: options.Index().SetName(doctorWordsIndex),
+		},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// BackfillIsActive marks the doctors stored before the is_active flag existed as active
+func (r *DoctorRepo) BackfillIsActive() error {
+	updateResult, err := r.coll.UpdateMany(r.ctx, bson.M{"is_active": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"is_active": true}})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if updateResult.ModifiedCount > 0 {
+		logrus.Info("marked ", updateResult.ModifiedCount, " doctors without is_active as active")
+	}
+
+	return nil
+}
+
+// BackfillSearchWords fills the search words of the doctors stored before they existed
+func (r *DoctorRepo) BackfillSearchWords() error {
+	cursor, err := r.coll.Find(r.ctx, bson.M{"search_words": bson.M{"$exists": false}})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	defer cursor.Close(r.ctx)
+
+	for cursor.Next(r.ctx) {
+		var doctor entity.TDoctor
+		if err := cursor.Decode(&doctor); err != nil {
+			logrus.Error(err)
+			return err
+		}
+
+		_, err := r.coll.UpdateOne(r.ctx, bson.M{"doctor_id": doctor.DoctorID}, bson.M{"$set": bson.M{"search_words": doctor.ComputeSearchWords()}})
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
 func (r *DoctorRepo) Create(payload entity.TDoctor) error {
-	insertResult, err := r.coll.InsertOne(r.ctx, payload)
-	if err != nil || insertResult.InsertedID == primitive.NilObjectID {
+	if _, err := r.coll.InsertOne(r.ctx, payload); err != nil {
 		logrus.Error(err)
 		return err
 	}
@@ -59,53 +152,107 @@ func (r *DoctorRepo) Read(doctorId string, result *entity.TDoctor) error {
 	err := r.coll.FindOne(r.ctx, bson.M{"doctor_id": doctorId}).Decode(result)
 	if err != nil {
 		logrus.Error(err)
-		return err
+		return notFound(err, ErrDoctorNotFound)
 	}
 
 	return nil
 }
 
-func (r *DoctorRepo) ReadMany(id string, result *[]entity.TDoctor) error {
-	oid, err := primitive.ObjectIDFromHex(id)
+// ReadManyByFilter ranks keyword matches by text score unless another sort is asked for. When no whole
+// word matches, it falls back to matching every keyword word as the prefix of a search word, so a half
+// typed name still finds the doctor.
+func (r *DoctorRepo) ReadManyByFilter(filter entity.TGetManyDoctorReq, result *[]entity.TDoctor) (entity.TListPage, error) {
+	query := bson.M{}
+
+	if filter.Specialty != "" {
+		query["specialty"] = exactInsensitive(filter.Specialty)
+	}
+
+	if filter.Department != "" {
+		query["department"] = exactInsensitive(filter.Department)
+	}
+
+	if filter.IsActive != nil {
+		query["is_active"] = *filter.IsActive
+	}
+
+	*result = []entity.TDoctor{}
+	decode := func(cursor *mongo.Cursor) error {
+		var doctor entity.TDoctor
+		if err := cursor.Decode(&doctor); err != nil {
+			return err
+		}
+		*result = append(*result, doctor)
+		return nil
+	}
+
+	isRelevance := filter.SortBy == "" || filter.SortBy == SortByRelevance
+	list := filter.TListReq
+	if filter.SortBy == SortByRelevance {
+		list.SortBy = ""
+	}
+
+	keyword := strings.TrimSpace(filter.Keyword)
+	if keyword == "" {
+		return findPage(r.ctx, r.coll, query, list, doctorListSpec, decode)
+	}
+
+	textQuery := bson.M{"$text": bson.M{"$search": keyword}}
+	for key, value := range query {
+		textQuery[key] = value
+	}
+
+	// Counting on the text index is cheap, and deciding on the count keeps every page of a search in the same mode
+	textTotal, err := r.coll.CountDocuments(r.ctx, textQuery)
 	if err != nil {
 		logrus.Error(err)
-		return err
+		return entity.TListPage{}, err
+	}
+
+	if textTotal > 0 {
+		if isRelevance {
+			return findRankedPage(r.ctx, r.coll, textQuery, filter.TListReq, doctorListSpec, decode)
+		}
+		return findPage(r.ctx, r.coll, textQuery, list, doctorListSpec, decode)
 	}
 
-	cursor, err := r.coll.Find(r.ctx, bson.M{"doctor_id": oid})
+	query["search_words"] = bson.M{"$all": wordPrefixes(keyword)}
+
+	return findPage(r.ctx, r.coll, query, list, doctorListSpec, decode)
+}
+
+func (r *DoctorRepo) Update(doctorId string, payload entity.TUpdateDoctor) error {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{"doctor_id": doctorId}, bson.M{"$set": payload})
 	if err != nil {
 		logrus.Error(err)
 		return err
 	}
 
-	if err = cursor.All(r.ctx, result); err != nil {
+	if updateResult.MatchedCount == 0 {
+		err = ErrDoctorNotFound
 		logrus.Error(err)
 		return err
 	}
+
 	return nil
 }
 
-func (r *DoctorRepo) ReadManyByName(keyword string, result *[]entity.TDoctor) error {
-	reKeywordObj := primitive.Regex{
-		Pattern: keyword,
-		Options: "i",
-	}
-
-	cursor, err := r.coll.Find(r.ctx, bson.M{
-		"$or": bson.A{
-			bson.M{"first_name": reKeywordObj},
-			bson.M{"last_name": reKeywordObj},
-		},
-	})
+// LockAppointments writes the lock counter of the doctor. Inside a transaction it makes every other
+// transaction that locks the same doctor conflict, so an overlap check and the insert after it can't
+// interleave with another one.
+func (r *DoctorRepo) LockAppointments(doctorId string) error {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{"doctor_id": doctorId}, bson.M{"$inc": bson.M{"appointment_lock": 1}})
 	if err != nil {
 		logrus.Error(err)
 		return err
 	}
 
-	if err = cursor.All(r.ctx, result); err != nil {
+	if updateResult.MatchedCount == 0 {
+		err = ErrDoctorNotFound
 		logrus.Error(err)
 		return err
 	}
+
 	return nil
 }
 
@@ -117,10 +264,37 @@ func (r *DoctorRepo) Delete(doctorId string) error {
 	}
 
 	if delResult.DeletedCount == 0 {
-		err = mongo.ErrNoDocuments
+		err = ErrDoctorNotFound
 		logrus.Error(err)
 		return err
 	}
 
 	return nil
 }
+
+// wordPrefixInsensitive matches value at the start of any word, escaped like exactInsensitive
+func wordPrefixInsensitive(value string) primitive.Regex {
+	return primitive.Regex{
+		Pattern: `(^|\s)` + regexp.QuoteMeta(value),
+		Options: "i",
+	}
+}
+
+// wordPrefixes matches the lowercased words of keyword at the start of a search word. The patterns are
+// anchored and case-sensitive so they run on the index, and escaped like exactInsensitive.
+func wordPrefixes(keyword string) bson.A {
+	prefixes := bson.A{}
+	for _, word := range strings.Fields(strings.ToLower(keyword)) {
+		prefixes = append(prefixes, primitive.Regex{Pattern: "^" + regexp.QuoteMeta(word)})
+	}
+
+	return prefixes
+}
+
+// exactInsensitive matches the whole value case-insensitively, the value is escaped so it is never treated as a pattern
+func exactInsensitive(value string) primitive.Regex {
+	return primitive.Regex{
+		Pattern: "^" + regexp.QuoteMeta(value) + "$",
+		Options: "i",
+	}
+}
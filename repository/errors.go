@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"github.com/agustadewa/hospital-backend/entity"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Repositories report misses and unique index violations as typed errors, services check them
+// with entity.IsNotFound or by comparing to these sentinels, never against driver errors
+var (
+	ErrAccountNotFound     = entity.NewNotFoundError("account not found")
+	ErrDoctorNotFound      = entity.NewNotFoundError("doctor not found")
+	ErrAppointmentNotFound = entity.NewNotFoundError("appointment not found")
+	ErrSessionNotFound     = entity.NewNotFoundError("session not found")
+	ErrQueueNotFound       = entity.NewNotFoundError("queue not found")
+	ErrScheduleNotFound    = entity.NewNotFoundError("schedule not found")
+
+	ErrDuplicateEmail    = entity.NewConflictError("email already exists")
+	ErrDuplicateUsername = entity.NewConflictError("username already exists")
+	ErrDuplicateDoctor   = entity.NewConflictError("doctor already linked to an account")
+	ErrDuplicateSlot     = entity.NewConflictError("slot already has an appointment")
+)
+
+// notFound replaces the driver miss with the typed error of the resource, other errors pass through
+func notFound(err error, notFoundErr error) error {
+	if err == mongo.ErrNoDocuments {
+		return notFoundErr
+	}
+
+	return err
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EnsureIndexes creates the indexes the repositories rely on, it runs once at startup.
+// Keyword search fails without the doctor text index.
+func EnsureIndexes(ctx context.Context, client *mongo.Client) error {
+	if err := NewAccountRepo(ctx, client).EnsureIndexes(); err != nil {
+		return err
+	}
+
+	if err := NewDoctorRepo(ctx, client).EnsureIndexes(); err != nil {
+		return err
+	}
+
+	if err := NewAppointmentRepo(ctx, client).EnsureIndexes(); err != nil {
+		return err
+	}
+
+	if err := NewQueueRepo(ctx, client).EnsureIndexes(); err != nil {
+		return err
+	}
+
+	if err := NewSessionRepo(ctx, client).EnsureIndexes(); err != nil {
+		return err
+	}
+
+	if err := NewUsedTokenRepo(ctx, client).EnsureIndexes(); err != nil {
+		return err
+	}
+
+	if err := NewLoginAttemptRepo(client).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
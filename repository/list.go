@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+
+	// SortByRelevance ranks keyword matches by text score, it is only accepted with a keyword
+	SortByRelevance = "relevance"
+)
+
+var (
+	ErrInvalidPageSize  = entity.NewValidationError(fmt.Sprintf("page_size must be between 1 and %d", MaxPageSize))
+	ErrInvalidSortBy    = entity.NewValidationError("invalid sort_by")
+	ErrInvalidSortOrder = entity.NewValidationError("sort_order must be asc or desc")
+	ErrInvalidCursor    = entity.NewBadRequestError("invalid cursor")
+)
+
+// listSpec describes how a collection pages. idField is the unique key that breaks ties between equal
+// sort values, sortFields are the fields a client may sort on and the first one is the default.
+type listSpec struct {
+	idField    string
+	sortFields []string
+}
+
+// resolve validates the list request and fills in the defaults
+func (spec listSpec) resolve(list entity.TListReq) (pageSize int, sortBy string, direction int, err error) {
+	pageSize = list.PageSize
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize < 1 || pageSize > MaxPageSize {
+		return 0, "", 0, ErrInvalidPageSize
+	}
+
+	sortBy = list.SortBy
+	if sortBy == "" {
+		sortBy = spec.sortFields[0]
+	}
+	if !containsField(spec.sortFields, sortBy) {
+		return 0, "", 0, ErrInvalidSortBy
+	}
+
+	switch list.SortOrder {
+	case "", "asc":
+		direction = 1
+	case "desc":
+		direction = -1
+	default:
+		return 0, "", 0, ErrInvalidSortOrder
+	}
+
+	return pageSize, sortBy, direction, nil
+}
+
+// listCursor is the position after the last item of a page. Keyset pages carry the sort value and
+// id of that item, offset pages (relevance and the memory repositories) carry the offset.
+// It is BSON encoded so the sort value keeps its type.
+type listCursor struct {
+	SortBy string      `bson:"s"`
+	Value  interface{} `bson:"v"`
+	ID     string      `bson:"id,omitempty"`
+	Offset int64       `bson:"o,omitempty"`
+}
+
+func encodeCursor(cursor listCursor) (string, error) {
+	b, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor rejects a cursor made for another sort, its position means nothing there. The sort value
+// goes into the query as is, so only the scalar types a sort field holds are accepted: a document or
+// regex would be read as an operator.
+func decodeCursor(value, sortBy string) (listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return listCursor{}, ErrInvalidCursor
+	}
+
+	var cursor listCursor
+	if err := bson.Unmarshal(b, &cursor); err != nil || cursor.SortBy != sortBy || cursor.Offset < 0 {
+		return listCursor{}, ErrInvalidCursor
+	}
+	if !isCursorScalar(cursor.Value) {
+		return listCursor{}, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+func isCursorScalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, string, int32, int64, float64, primitive.DateTime, time.Time, primitive.ObjectID:
+		return true
+	default:
+		return false
+	}
+}
+
+// findPage runs one keyset page of filter. decode is called once per item of the page, in order.
+func findPage(ctx context.Context, coll *mongo.Collection, filter bson.M, list entity.TListReq, spec listSpec, decode func(cursor *mongo.Cursor) error) (entity.TListPage, error) {
+	pageSize, sortBy, direction, err := spec.resolve(list)
+	if err != nil {
+		return entity.TListPage{}, err
+	}
+
+	query := filter
+	if list.Cursor != "" {
+		after, err := decodeCursor(list.Cursor, sortBy)
+		if err != nil {
+			return entity.TListPage{}, err
+		}
+		query = bson.M{"$and": bson.A{filter, spec.after(sortBy, direction, after)}}
+	}
+
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		logrus.Error(err)
+		return entity.TListPage{}, err
+	}
+
+	sort := bson.D{{Key: sortBy, Value: direction}}
+	if sortBy != spec.idField {
+		sort = append(sort, bson.E{Key: spec.idField, Value: direction})
+	}
+
+	// One extra item tells whether there is a next page
+	cursor, err := coll.Find(ctx, query, options.Find().SetSort(sort).SetLimit(int64(pageSize)+1))
+	if err != nil {
+		logrus.Error(err)
+		return entity.TListPage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	page := entity.TListPage{Total: total}
+	var last listCursor
+	for count := 0; cursor.Next(ctx); count++ {
+		if count == pageSize {
+			if page.NextCursor, err = encodeCursor(last); err != nil {
+				return entity.TListPage{}, err
+			}
+			break
+		}
+
+		if err := decode(cursor); err != nil {
+			logrus.Error(err)
+			return entity.TListPage{}, err
+		}
+
+		id, _ := cursor.Current.Lookup(spec.idField).StringValueOK()
+		last = listCursor{SortBy: sortBy, ID: id}
+		if value, err := cursor.Current.LookupErr(sortBy); err == nil {
+			last.Value = value
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		logrus.Error(err)
+		return entity.TListPage{}, err
+	}
+
+	return page, nil
+}
+
+// after matches the documents past the cursor in the sort order. Mongo sorts a missing field before
+// every value, comparison operators never match it, so it needs its own clauses.
+func (spec listSpec) after(sortBy string, direction int, cursor listCursor) bson.M {
+	operator := "$gt"
+	if direction < 0 {
+		operator = "$lt"
+	}
+
+	if sortBy == spec.idField {
+		return bson.M{spec.idField: bson.M{operator: cursor.ID}}
+	}
+
+	sameValue := bson.M{sortBy: cursor.Value, spec.idField: bson.M{operator: cursor.ID}}
+
+	if cursor.Value == nil {
+		if direction < 0 {
+			return sameValue
+		}
+		return bson.M{"$or": bson.A{sameValue, bson.M{sortBy: bson.M{"$ne": nil}}}}
+	}
+
+	clauses := bson.A{bson.M{sortBy: bson.M{operator: cursor.Value}}, sameValue}
+	if direction < 0 {
+		clauses = append(clauses, bson.M{sortBy: nil})
+	}
+
+	return bson.M{"$or": clauses}
+}
+
+// findRankedPage runs one page of a $text filter ordered by relevance. Scores are not stable keys,
+// so the cursor holds an offset instead of a position.
+func findRankedPage(ctx context.Context, coll *mongo.Collection, filter bson.M, list entity.TListReq, spec listSpec, decode func(cursor *mongo.Cursor) error) (entity.TListPage, error) {
+	pageSize, _, _, err := spec.resolve(entity.TListReq{PageSize: list.PageSize})
+	if err != nil {
+		return entity.TListPage{}, err
+	}
+
+	var offset int64
+	if list.Cursor != "" {
+		after, err := decodeCursor(list.Cursor, SortByRelevance)
+		if err != nil {
+			return entity.TListPage{}, err
+		}
+		offset = after.Offset
+	}
+
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		logrus.Error(err)
+		return entity.TListPage{}, err
+	}
+
+	textScore := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": textScore}).
+		SetSort(bson.D{{Key: "score", Value: textScore}, {Key: spec.idField, Value: 1}}).
+		SetSkip(offset).
+		SetLimit(int64(pageSize) + 1)
+
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		logrus.Error(err)
+		return entity.TListPage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	page := entity.TListPage{Total: total}
+	for count := 0; cursor.Next(ctx); count++ {
+		if count == pageSize {
+			next := listCursor{SortBy: SortByRelevance, Offset: offset + int64(pageSize)}
+			if page.NextCursor, err = encodeCursor(next); err != nil {
+				return entity.TListPage{}, err
+			}
+			break
+		}
+
+		if err := decode(cursor); err != nil {
+			logrus.Error(err)
+			return entity.TListPage{}, err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		logrus.Error(err)
+		return entity.TListPage{}, err
+	}
+
+	return page, nil
+}
+
+// memoryPage cuts one page out of total items that are already filtered and sorted, the memory
+// repositories page by offset
+func memoryPage(total int, list entity.TListReq, sortBy string, pageSize int) (start, end int, page entity.TListPage, err error) {
+	if list.Cursor != "" {
+		after, err := decodeCursor(list.Cursor, sortBy)
+		if err != nil {
+			return 0, 0, entity.TListPage{}, err
+		}
+		start = int(after.Offset)
+	}
+	if start > total {
+		start = total
+	}
+
+	end = start + pageSize
+	page = entity.TListPage{Total: int64(total)}
+	if end < total {
+		if page.NextCursor, err = encodeCursor(listCursor{SortBy: sortBy, Offset: int64(end)}); err != nil {
+			return 0, 0, entity.TListPage{}, err
+		}
+	} else {
+		end = total
+	}
+
+	return start, end, page, nil
+}
+
+func containsField(fields []string, field string) bool {
+	for _, item := range fields {
+		if item == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptStore keeps failed login counters. The store outlives a request, so unlike the
+// other repositories it takes the context per call.
+type LoginAttemptStore interface {
+	// Read returns the zero value with the key set when nothing is recorded
+	Read(ctx context.Context, key string) (entity.TLoginAttempt, error)
+	// RecordFailure atomically increments the counter and returns the updated record
+	RecordFailure(ctx context.Context, key string, now time.Time) (entity.TLoginAttempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// +++++++++++++ MONGO +++++++++++++++
+
+const (
+	loginAttemptKeyIndex    = "key_unique"
+	loginAttemptExpireIndex = "expire_at_ttl"
+)
+
+func NewLoginAttemptRepo(client *mongo.Client) *LoginAttemptRepo {
+	const repoName = "login_attempt"
+	mongoConfig := config.CONFIG.Repositories[repoName]
+
+	collection := client.Database(mongoConfig.DBName).Collection(mongoConfig.CollName)
+	return &LoginAttemptRepo{
+		coll:   collection,
+		window: time.Duration(config.CONFIG.LoginGuard.AttemptWindow) * time.Second,
+	}
+}
+
+// LoginAttemptRepo keeps an expire_at on every record, the later of the end of its attempt window and
+// of its lockout. The TTL index removes the record after that, it can't lock or count anymore.
+type LoginAttemptRepo struct {
+	coll   *mongo.Collection
+	window time.Duration
+}
+
+// EnsureIndexes creates the unique key index that keeps concurrent first failures on one counter, and
+// the TTL index on expire_at. Records are only counters, when duplicates from before the unique index
+// keep it from building they are dropped and it is built again.
+func (r *LoginAttemptRepo) EnsureIndexes(ctx context.Context) error {
+	keyIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetName(loginAttemptKeyIndex).SetUnique(true),
+	}
+
+	_, err := r.coll.Indexes().CreateOne(ctx, keyIndex)
+	if mongo.IsDuplicateKeyError(err) {
+		logrus.Warn("login attempts hold duplicate keys, clearing them to build ", loginAttemptKeyIndex)
+		if _, err = r.coll.DeleteMany(ctx, bson.M{}); err == nil {
+			_, err = r.coll.Indexes().CreateOne(ctx, keyIndex)
+		}
+	}
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	_, err = r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expire_at", Value: 1}},
+		Options: options.Index().SetName(loginAttemptExpireIndex).SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *LoginAttemptRepo) Read(ctx context.Context, key string) (entity.TLoginAttempt, error) {
+	result := entity.TLoginAttempt{Key: key}
+	err := r.coll.FindOne(ctx, bson.M{"key": key}).Decode(&result)
+	if err != nil && err != mongo.ErrNoDocuments {
+		logrus.Error(err)
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (r *LoginAttemptRepo) RecordFailure(ctx context.Context, key string, now time.Time) (entity.TLoginAttempt, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	update := bson.M{
+		"$inc": bson.M{"failure_count": 1},
+		"$set": bson.M{"last_failure_at": now},
+		"$max": bson.M{"expire_at": now.Add(r.window)},
+	}
+
+	// Two first failures of a key race on the upsert, the loser retries against the record of the winner
+	var result entity.TLoginAttempt
+	err := r.coll.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&result)
+	if mongo.IsDuplicateKeyError(err) {
+		err = r.coll.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&result)
+	}
+	if err != nil {
+		logrus.Error(err)
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (r *LoginAttemptRepo) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.coll.UpdateOne(ctx, bson.M{"key": key}, bson.M{
+		"$set": bson.M{"locked_until": until},
+		"$max": bson.M{"expire_at": until},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *LoginAttemptRepo) Reset(ctx context.Context, key string) error {
+	_, err := r.coll.DeleteOne(ctx, bson.M{"key": key})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// +++++++++++++ MEMORY +++++++++++++++
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: map[string]entity.TLoginAttempt{}}
+}
+
+// MemoryLoginAttemptStore is a process local LoginAttemptStore for single instance deployments and tests
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]entity.TLoginAttempt
+}
+
+func (r *MemoryLoginAttemptStore) Read(_ context.Context, key string) (entity.TLoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, isExists := r.attempts[key]
+	if !isExists {
+		return entity.TLoginAttempt{Key: key}, nil
+	}
+
+	return attempt, nil
+}
+
+func (r *MemoryLoginAttemptStore) RecordFailure(_ context.Context, key string, now time.Time) (entity.TLoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt := r.attempts[key]
+	attempt.Key = key
+	attempt.FailureCount++
+	attempt.LastFailureAt = now
+	r.attempts[key] = attempt
+
+	return attempt, nil
+}
+
+func (r *MemoryLoginAttemptStore) Lock(_ context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, isExists := r.attempts[key]
+	if !isExists {
+		return nil
+	}
+
+	attempt.LockedUntil = until
+	r.attempts[key] = attempt
+
+	return nil
+}
+
+func (r *MemoryLoginAttemptStore) Reset(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+
+	return nil
+}
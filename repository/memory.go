@@ -0,0 +1,1327 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/entity"
+)
+
+// MemoryRepositories keeps every repository in process for tests. It is safe for
+// concurrent use and mirrors the Mongo behaviour the services rely on: the typed not found errors,
+// the unique email (case-insensitive) and username indexes, and the conditional booking updates.
+type MemoryRepositories struct {
+	mu           sync.RWMutex
+	accounts     map[string]entity.TAccount
+	doctors      map[string]entity.TDoctor
+	appointments map[string]entity.TAppointment
+	vitals       []entity.TVitals
+	schedules    map[string]entity.TWorkingSchedule
+	queues       map[string]entity.TQueue
+	sessions     map[string]entity.TSession
+	usedTokens   map[string]entity.TUsedToken
+	loginAttempt *MemoryLoginAttemptStore
+}
+
+func NewMemoryRepositories() *MemoryRepositories {
+	return &MemoryRepositories{
+		accounts:     map[string]entity.TAccount{},
+		doctors:      map[string]entity.TDoctor{},
+		appointments: map[string]entity.TAppointment{},
+		schedules:    map[string]entity.TWorkingSchedule{},
+		queues:       map[string]entity.TQueue{},
+		sessions:     map[string]entity.TSession{},
+		usedTokens:   map[string]entity.TUsedToken{},
+		loginAttempt: NewMemoryLoginAttemptStore(),
+	}
+}
+
+func (r *MemoryRepositories) Account(ctx context.Context) AccountRepository {
+	return &memoryAccountRepo{store: r}
+}
+
+func (r *MemoryRepositories) Doctor(ctx context.Context) DoctorRepository {
+	return &memoryDoctorRepo{store: r}
+}
+
+func (r *MemoryRepositories) Appointment(ctx context.Context) AppointmentRepository {
+	return &memoryAppointmentRepo{store: r}
+}
+
+func (r *MemoryRepositories) Vitals(ctx context.Context) VitalsRepository {
+	return &memoryVitalsRepo{store: r}
+}
+
+func (r *MemoryRepositories) Schedule(ctx context.Context) ScheduleRepository {
+	return &memoryScheduleRepo{store: r}
+}
+
+func (r *MemoryRepositories) Queue(ctx context.Context) QueueRepository {
+	return &memoryQueueRepo{store: r}
+}
+
+func (r *MemoryRepositories) Session(ctx context.Context) SessionRepository {
+	return &memorySessionRepo{store: r}
+}
+
+func (r *MemoryRepositories) UsedToken(ctx context.Context) UsedTokenRepository {
+	return &memoryUsedTokenRepo{store: r}
+}
+
+func (r *MemoryRepositories) LoginAttempt() LoginAttemptStore {
+	return r.loginAttempt
+}
+
+// +++++++++++++ ACCOUNT +++++++++++++++
+
+type memoryAccountRepo struct {
+	store *MemoryRepositories
+}
+
+// checkUnique must be called with the lock held, skipAccountId is the account being updated
+func (r *memoryAccountRepo) checkUnique(email, username, skipAccountId string) error {
+	for id, account := range r.store.accounts {
+		if id == skipAccountId {
+			continue
+		}
+		if email != "" && strings.EqualFold(account.Email, email) {
+			return ErrDuplicateEmail
+		}
+		if username != "" && account.Username == username {
+			return ErrDuplicateUsername
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryAccountRepo) Create(payload entity.TAccount) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if err := r.checkUnique(payload.Email, payload.Username, ""); err != nil {
+		return err
+	}
+
+	if payload.Role == entity.DOCTOR {
+		for _, account := range r.store.accounts {
+			if account.Role == entity.DOCTOR && account.DoctorID == payload.DoctorID {
+				return ErrDuplicateDoctor
+			}
+		}
+	}
+
+	r.store.accounts[payload.AccountID] = copyAccount(payload)
+	return nil
+}
+
+func (r *memoryAccountRepo) Read(accountId string, result *entity.TAccount) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	account, isExists := r.store.accounts[accountId]
+	if !isExists {
+		return ErrAccountNotFound
+	}
+
+	*result = copyAccount(account)
+	return nil
+}
+
+func (r *memoryAccountRepo) findOne(match func(entity.TAccount) bool, result *entity.TAccount) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, account := range r.store.accounts {
+		if match(account) {
+			*result = copyAccount(account)
+			return nil
+		}
+	}
+
+	return ErrAccountNotFound
+}
+
+func (r *memoryAccountRepo) ReadByEmail(email string, result *entity.TAccount) error {
+	return r.findOne(func(account entity.TAccount) bool { return strings.EqualFold(account.Email, email) }, result)
+}
+
+func (r *memoryAccountRepo) ReadByUsername(username string, result *entity.TAccount) error {
+	return r.findOne(func(account entity.TAccount) bool { return account.Username == username }, result)
+}
+
+func (r *memoryAccountRepo) ReadManyByIDs(accountIds []string, result *[]entity.TAccount) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	accounts := []entity.TAccount{}
+	for _, accountId := range accountIds {
+		if account, isExists := r.store.accounts[accountId]; isExists {
+			accounts = append(accounts, copyAccount(account))
+		}
+	}
+
+	*result = accounts
+	return nil
+}
+
+func (r *memoryAccountRepo) ReadManyByFilter(filter entity.TGetManyAccountReq, result *[]entity.TAccount) (entity.TListPage, error) {
+	pageSize, sortBy, direction, err := accountListSpec.resolve(filter.TListReq)
+	if err != nil {
+		return entity.TListPage{}, err
+	}
+
+	keyword := strings.ToLower(strings.TrimSpace(filter.Keyword))
+
+	r.store.mu.RLock()
+	accounts := []entity.TAccount{}
+	for _, account := range r.store.accounts {
+		if filter.Role != "" && account.Role != filter.Role {
+			continue
+		}
+		if keyword != "" && !hasWordPrefix(account.FirstName, keyword) && !hasWordPrefix(account.LastName, keyword) &&
+			!hasWordPrefix(account.Email, keyword) && !hasWordPrefix(account.Username, keyword) {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	r.store.mu.RUnlock()
+
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return memoryLess(accountSortValue(accounts[i], sortBy), accountSortValue(accounts[j], sortBy), accounts[i].AccountID, accounts[j].AccountID, direction)
+	})
+
+	start, end, page, err := memoryPage(len(accounts), filter.TListReq, sortBy, pageSize)
+	if err != nil {
+		return entity.TListPage{}, err
+	}
+
+	*result = append([]entity.TAccount{}, accounts[start:end]...)
+	return page, nil
+}
+
+func accountSortValue(account entity.TAccount, sortBy string) string {
+	switch sortBy {
+	case "first_name":
+		return account.FirstName
+	case "username":
+		return account.Username
+	case "email":
+		return account.Email
+	case "role":
+		return string(account.Role)
+	case "account_id":
+		return account.AccountID
+	default:
+		return account.LastName
+	}
+}
+
+func (r *memoryAccountRepo) check(match func(entity.TAccount) bool) (bool, error) {
+	err := r.findOne(match, &entity.TAccount{})
+	if entity.IsNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (r *memoryAccountRepo) CheckAccountByEmail(email string) (bool, error) {
+	return r.check(func(account entity.TAccount) bool { return strings.EqualFold(account.Email, email) })
+}
+
+func (r *memoryAccountRepo) CheckAccountByUsername(username string) (bool, error) {
+	return r.check(func(account entity.TAccount) bool { return account.Username == username })
+}
+
+func (r *memoryAccountRepo) CheckAccountByDoctor(doctorId string) (bool, error) {
+	return r.check(func(account entity.TAccount) bool { return account.DoctorID == doctorId })
+}
+
+// modify applies fn to a stored account under the write lock, fn returns false to leave it unchanged
+func (r *memoryAccountRepo) modify(accountId string, fn func(account *entity.TAccount) (bool, error)) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	account, isExists := r.store.accounts[accountId]
+	if !isExists {
+		return false, ErrAccountNotFound
+	}
+
+	isModified, err := fn(&account)
+	if err != nil || !isModified {
+		return false, err
+	}
+
+	r.store.accounts[accountId] = account
+	return true, nil
+}
+
+func (r *memoryAccountRepo) UpdatePassword(accountId, password string) error {
+	_, err := r.modify(accountId, func(account *entity.TAccount) (bool, error) {
+		account.Password = password
+		return true, nil
+	})
+
+	return err
+}
+
+func (r *memoryAccountRepo) Update(accountId string, payload entity.TUpdateAccount) error {
+	_, err := r.modify(accountId, func(account *entity.TAccount) (bool, error) {
+		var email, username string
+		if payload.Email != nil {
+			email = *payload.Email
+		}
+		if payload.Username != nil {
+			username = *payload.Username
+		}
+		if err := r.checkUnique(email, username, accountId); err != nil {
+			return false, err
+		}
+
+		if payload.FirstName != nil {
+			account.FirstName = *payload.FirstName
+		}
+		if payload.LastName != nil {
+			account.LastName = *payload.LastName
+		}
+		if payload.Age != nil {
+			account.Age = *payload.Age
+		}
+		if payload.Email != nil {
+			account.Email = *payload.Email
+		}
+		if payload.Username != nil {
+			account.Username = *payload.Username
+		}
+		if payload.Password != nil {
+			account.Password = *payload.Password
+		}
+		if payload.EmailVerified != nil {
+			account.EmailVerified = *payload.EmailVerified
+		}
+		return true, nil
+	})
+
+	return err
+}
+
+func (r *memoryAccountRepo) SetTOTPPendingSecret(accountId, secret string) error {
+	_, err := r.modify(accountId, func(account *entity.TAccount) (bool, error) {
+		account.TOTPPendingSecret = secret
+		return true, nil
+	})
+
+	return err
+}
+
+func (r *memoryAccountRepo) EnableTOTP(accountId, secret string, step int64, recoveryCodeHashes []string) (bool, error) {
+	return r.conditional(accountId, func(account *entity.TAccount) (bool, error) {
+		if account.TOTPPendingSecret != secret {
+			return false, nil
+		}
+
+		account.TOTPEnabled = true
+		account.TOTPSecret = secret
+		account.TOTPLastStep = step
+		account.RecoveryCodeHashes = append([]string{}, recoveryCodeHashes...)
+		account.TOTPPendingSecret = ""
+		return true, nil
+	})
+}
+
+func (r *memoryAccountRepo) DisableTOTP(accountId string) error {
+	_, err := r.conditional(accountId, func(account *entity.TAccount) (bool, error) {
+		account.TOTPEnabled = false
+		account.TOTPSecret = ""
+		account.TOTPPendingSecret = ""
+		account.TOTPLastStep = 0
+		account.RecoveryCodeHashes = nil
+		return true, nil
+	})
+
+	return err
+}
+
+func (r *memoryAccountRepo) UseTOTPStep(accountId string, step int64) (bool, error) {
+	return r.conditional(accountId, func(account *entity.TAccount) (bool, error) {
+		if account.TOTPLastStep >= step {
+			return false, nil
+		}
+
+		account.TOTPLastStep = step
+		return true, nil
+	})
+}
+
+func (r *memoryAccountRepo) UseRecoveryCode(accountId, codeHash string) (bool, error) {
+	return r.conditional(accountId, func(account *entity.TAccount) (bool, error) {
+		for i, hash := range account.RecoveryCodeHashes {
+			if hash == codeHash {
+				account.RecoveryCodeHashes = append(account.RecoveryCodeHashes[:i:i], account.RecoveryCodeHashes[i+1:]...)
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+}
+
+func (r *memoryAccountRepo) MarkEmailVerified(accountId, email string) (bool, error) {
+	return r.conditional(accountId, func(account *entity.TAccount) (bool, error) {
+		if account.Email != email {
+			return false, nil
+		}
+
+		account.EmailVerified = true
+		return true, nil
+	})
+}
+
+// conditional is modify for the guarded updates, like their Mongo versions a missing account is a miss, not an error
+func (r *memoryAccountRepo) conditional(accountId string, fn func(account *entity.TAccount) (bool, error)) (bool, error) {
+	isModified, err := r.modify(accountId, fn)
+	if entity.IsNotFound(err) {
+		return false, nil
+	}
+
+	return isModified, err
+}
+
+func copyAccount(account entity.TAccount) entity.TAccount {
+	if account.RecoveryCodeHashes != nil {
+		account.RecoveryCodeHashes = append([]string{}, account.RecoveryCodeHashes...)
+	}
+
+	return account
+}
+
+// +++++++++++++ DOCTOR +++++++++++++++
+
+type memoryDoctorRepo struct {
+	store *MemoryRepositories
+}
+
+func (r *memoryDoctorRepo) Create(payload entity.TDoctor) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.doctors[payload.DoctorID] = payload
+	return nil
+}
+
+func (r *memoryDoctorRepo) CheckDoctorByName(firstName, lastName string) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, doctor := range r.store.doctors {
+		if doctor.FirstName == firstName && doctor.LastName == lastName {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *memoryDoctorRepo) Read(doctorId string, result *entity.TDoctor) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	doctor, isExists := r.store.doctors[doctorId]
+	if !isExists {
+		return ErrDoctorNotFound
+	}
+
+	*result = doctor
+	return nil
+}
+
+func (r *memoryDoctorRepo) ReadManyByFilter(filter entity.TGetManyDoctorReq, result *[]entity.TDoctor) (entity.TListPage, error) {
+	isRelevance := filter.SortBy == "" || filter.SortBy == SortByRelevance
+	list := filter.TListReq
+	if filter.SortBy == SortByRelevance {
+		list.SortBy = ""
+	}
+
+	pageSize, sortBy, direction, err := doctorListSpec.resolve(list)
+	if err != nil {
+		return entity.TListPage{}, err
+	}
+
+	keyword := strings.ToLower(strings.TrimSpace(filter.Keyword))
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	doctors := []entity.TDoctor{}
+	for _, doctor := range r.store.doctors {
+		if filter.Specialty != "" && !strings.EqualFold(doctor.Specialty, filter.Specialty) {
+			continue
+		}
+		if filter.Department != "" && !strings.EqualFold(doctor.Department, filter.Department) {
+			continue
+		}
+		if filter.IsActive != nil && doctor.IsActive != *filter.IsActive {
+			continue
+		}
+		doctors = append(doctors, doctor)
+	}
+
+	// Whole word matches first, word prefixes only when nothing matched, like the text index
+	if keyword != "" {
+		scores := map[string]int{}
+		matched := []entity.TDoctor{}
+		for _, doctor := range doctors {
+			if score := doctorTextScore(doctor, keyword); score > 0 {
+				scores[doctor.DoctorID] = score
+				matched = append(matched, doctor)
+			}
+		}
+
+		if len(matched) > 0 && isRelevance {
+			sort.SliceStable(matched, func(i, j int) bool {
+				if scores[matched[i].DoctorID] != scores[matched[j].DoctorID] {
+					return scores[matched[i].DoctorID] > scores[matched[j].DoctorID]
+				}
+				return matched[i].DoctorID < matched[j].DoctorID
+			})
+			return memoryDoctorPage(matched, filter.TListReq, SortByRelevance, pageSize, result)
+		}
+
+		if len(matched) == 0 {
+			for _, doctor := range doctors {
+				if hasWordPrefixes(doctor.ComputeSearchWords(), keyword) {
+					matched = append(matched, doctor)
+				}
+			}
+		}
+		doctors = matched
+	}
+
+	sort.SliceStable(doctors, func(i, j int) bool {
+		return memoryLess(doctorSortValue(doctors[i], sortBy), doctorSortValue(doctors[j], sortBy), doctors[i].DoctorID, doctors[j].DoctorID, direction)
+	})
+
+	return memoryDoctorPage(doctors, list, sortBy, pageSize, result)
+}
+
+func memoryDoctorPage(doctors []entity.TDoctor, list entity.TListReq, sortBy string, pageSize int, result *[]entity.TDoctor) (entity.TListPage, error) {
+	start, end, page, err := memoryPage(len(doctors), list, sortBy, pageSize)
+	if err != nil {
+		return entity.TListPage{}, err
+	}
+
+	*result = append([]entity.TDoctor{}, doctors[start:end]...)
+	return page, nil
+}
+
+func doctorSortValue(doctor entity.TDoctor, sortBy string) string {
+	switch sortBy {
+	case "first_name":
+		return doctor.FirstName
+	case "specialty":
+		return doctor.Specialty
+	case "doctor_id":
+		return doctor.DoctorID
+	default:
+		return doctor.LastName
+	}
+}
+
+// doctorTextScore adds the field weight of the doctor text index for every keyword word found in a field
+func doctorTextScore(doctor entity.TDoctor, keyword string) int {
+	score := 0
+	for _, word := range strings.Fields(keyword) {
+		if hasWord(doctor.FirstName, word) {
+			score += doctorNameWeight
+		}
+		if hasWord(doctor.LastName, word) {
+			score += doctorNameWeight
+		}
+		if hasWord(doctor.Specialty, word) {
+			score += doctorSpecialtyWeight
+		}
+	}
+
+	return score
+}
+
+// memoryLess orders by the sort value and then by id, like the sort findPage sends to Mongo
+func memoryLess(a, b, idA, idB string, direction int) bool {
+	if a == b {
+		a, b = idA, idB
+	}
+	if direction < 0 {
+		return a > b
+	}
+
+	return a < b
+}
+
+func hasWord(value, word string) bool {
+	for _, field := range strings.Fields(strings.ToLower(value)) {
+		if field == word {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasWordPrefix(value, prefix string) bool {
+	value = strings.ToLower(value)
+
+	return strings.HasPrefix(value, prefix) || strings.Contains(value, " "+prefix)
+}
+
+// hasWordPrefixes reports whether every word of keyword starts one of the search words
+func hasWordPrefixes(searchWords []string, keyword string) bool {
+	for _, word := range strings.Fields(keyword) {
+		isFound := false
+		for _, searchWord := range searchWords {
+			if strings.HasPrefix(searchWord, word) {
+				isFound = true
+				break
+			}
+		}
+		if !isFound {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *memoryDoctorRepo) Update(doctorId string, payload entity.TUpdateDoctor) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	doctor, isExists := r.store.doctors[doctorId]
+	if !isExists {
+		return ErrDoctorNotFound
+	}
+
+	if payload.FirstName != nil {
+		doctor.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		doctor.LastName = *payload.LastName
+	}
+	if payload.Specialty != nil {
+		doctor.Specialty = *payload.Specialty
+	}
+	if payload.Department != nil {
+		doctor.Department = *payload.Department
+	}
+	if payload.LicenseNumber != nil {
+		doctor.LicenseNumber = *payload.LicenseNumber
+	}
+	if payload.Phone != nil {
+		doctor.Phone = *payload.Phone
+	}
+	if payload.Bio != nil {
+		doctor.Bio = *payload.Bio
+	}
+	if payload.IsActive != nil {
+		doctor.IsActive = *payload.IsActive
+	}
+	if payload.SearchWords != nil {
+		doctor.SearchWords = append([]string{}, *payload.SearchWords...)
+	}
+
+	r.store.doctors[doctorId] = doctor
+	return nil
+}
+
+// LockAppointments only checks the doctor, the memory repositories have no transactions to conflict
+func (r *memoryDoctorRepo) LockAppointments(doctorId string) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	if _, isExists := r.store.doctors[doctorId]; !isExists {
+		return ErrDoctorNotFound
+	}
+
+	return nil
+}
+
+func (r *memoryDoctorRepo) Delete(doctorId string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, isExists := r.store.doctors[doctorId]; !isExists {
+		return ErrDoctorNotFound
+	}
+
+	delete(r.store.doctors, doctorId)
+	return nil
+}
+
+// +++++++++++++ APPOINTMENT +++++++++++++++
+
+type memoryAppointmentRepo struct {
+	store *MemoryRepositories
+}
+
+func (r *memoryAppointmentRepo) Create(payload entity.TAppointment) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if payload.StartAt != nil {
+		for _, appointment := range r.store.appointments {
+			if appointment.DoctorID == payload.DoctorID && appointment.StartAt != nil && appointment.StartAt.Equal(*payload.StartAt) {
+				return ErrDuplicateSlot
+			}
+		}
+	}
+
+	r.store.appointments[payload.AppointmentID] = copyAppointment(payload)
+	return nil
+}
+
+func (r *memoryAppointmentRepo) Read(appointmentId string, result *entity.TAppointment) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists {
+		return ErrAppointmentNotFound
+	}
+
+	*result = copyAppointment(appointment)
+	return nil
+}
+
+func (r *memoryAppointmentRepo) readMany(match func(entity.TAppointment) bool, result *[]entity.TAppointment) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	appointments := []entity.TAppointment{}
+	for _, appointment := range r.store.appointments {
+		if match(appointment) {
+			appointments = append(appointments, copyAppointment(appointment))
+		}
+	}
+
+	*result = appointments
+	return nil
+}
+
+func (r *memoryAppointmentRepo) ReadManyByDoctor(doctorId string, result *[]entity.TAppointment) error {
+	return r.readMany(func(appointment entity.TAppointment) bool { return appointment.DoctorID == doctorId }, result)
+}
+
+func (r *memoryAppointmentRepo) ReadManyByPatient(accountId string, result *[]entity.TAppointment) error {
+	return r.readMany(func(appointment entity.TAppointment) bool {
+		return containsID(appointment.PatientAccountIDs, accountId) || appointment.WaitlistPosition(accountId) > 0
+	}, result)
+}
+
+func (r *memoryAppointmentRepo) ReadManyByFilter(filter entity.TGetManyAppointmentReq, result *[]entity.TAppointment) (entity.TListPage, error) {
+	pageSize, sortBy, direction, err := appointmentListSpec.resolve(filter.TListReq)
+	if err != nil {
+		return entity.TListPage{}, err
+	}
+
+	var appointments []entity.TAppointment
+	if err := r.ReadManyByDoctor(filter.DoctorID, &appointments); err != nil {
+		return entity.TListPage{}, err
+	}
+
+	sortValue := func(appointment entity.TAppointment) string {
+		switch sortBy {
+		case "start_at":
+			// A missing start sorts first, like in Mongo
+			if appointment.StartAt == nil {
+				return ""
+			}
+			return appointment.StartAt.UTC().Format("2006-01-02T15:04:05.000")
+		case "max_appointment":
+			return fmt.Sprintf("%03d", appointment.MaxAppointment)
+		default:
+			return appointment.AppointmentID
+		}
+	}
+	sort.SliceStable(appointments, func(i, j int) bool {
+		return memoryLess(sortValue(appointments[i]), sortValue(appointments[j]), appointments[i].AppointmentID, appointments[j].AppointmentID, direction)
+	})
+
+	start, end, page, err := memoryPage(len(appointments), filter.TListReq, sortBy, pageSize)
+	if err != nil {
+		return entity.TListPage{}, err
+	}
+
+	*result = append([]entity.TAppointment{}, appointments[start:end]...)
+	return page, nil
+}
+
+func (r *memoryAppointmentRepo) ReadBySlot(doctorId string, startAt time.Time, result *entity.TAppointment) error {
+	var appointments []entity.TAppointment
+	if err := r.readMany(func(appointment entity.TAppointment) bool {
+		return appointment.DoctorID == doctorId && appointment.StartAt != nil && appointment.StartAt.Equal(startAt)
+	}, &appointments); err != nil {
+		return err
+	}
+
+	if len(appointments) == 0 {
+		return ErrAppointmentNotFound
+	}
+
+	*result = appointments[0]
+	return nil
+}
+
+func (r *memoryAppointmentRepo) ReadManyByDoctorRange(doctorId string, from, to time.Time, result *[]entity.TAppointment) error {
+	if err := r.readMany(func(appointment entity.TAppointment) bool {
+		return appointment.DoctorID == doctorId && overlaps(appointment, from, to)
+	}, result); err != nil {
+		return err
+	}
+
+	sort.SliceStable(*result, func(i, j int) bool {
+		return (*result)[i].StartAt.Before(*(*result)[j].StartAt)
+	})
+	return nil
+}
+
+func (r *memoryAppointmentRepo) CheckOverlap(doctorId string, startAt, endAt time.Time) (bool, error) {
+	var appointments []entity.TAppointment
+	if err := r.readMany(func(appointment entity.TAppointment) bool {
+		return appointment.DoctorID == doctorId && overlaps(appointment, startAt, endAt)
+	}, &appointments); err != nil {
+		return false, err
+	}
+
+	return len(appointments) > 0, nil
+}
+
+// overlaps reports whether a timed appointment overlaps [from, to)
+func overlaps(appointment entity.TAppointment, from, to time.Time) bool {
+	return appointment.StartAt != nil && appointment.EndAt != nil && appointment.StartAt.Before(to) && appointment.EndAt.After(from)
+}
+
+func (r *memoryAppointmentRepo) CheckPatientWithDoctor(doctorId, accountId string) (bool, error) {
+	var appointments []entity.TAppointment
+	err := r.readMany(func(appointment entity.TAppointment) bool {
+		return appointment.DoctorID == doctorId && containsID(appointment.PatientAccountIDs, accountId)
+	}, &appointments)
+
+	return len(appointments) > 0, err
+}
+
+func (r *memoryAppointmentRepo) Update(appointmentId string, payload entity.TUpdateAppointment) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists {
+		return ErrAppointmentNotFound
+	}
+
+	if payload.DoctorID != nil {
+		appointment.DoctorID = *payload.DoctorID
+	}
+	if payload.PatientAccountIDs != nil {
+		appointment.PatientAccountIDs = append([]string{}, *payload.PatientAccountIDs...)
+	}
+	if payload.Description != nil {
+		appointment.Description = *payload.Description
+	}
+	if payload.MaxAppointment != nil {
+		appointment.MaxAppointment = *payload.MaxAppointment
+	}
+
+	r.store.appointments[appointmentId] = appointment
+	return nil
+}
+
+func (r *memoryAppointmentRepo) Delete(appointmentId string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, isExists := r.store.appointments[appointmentId]; !isExists {
+		return ErrAppointmentNotFound
+	}
+
+	delete(r.store.appointments, appointmentId)
+	return nil
+}
+
+func (r *memoryAppointmentRepo) DeleteManyByDoctor(doctorId string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for appointmentId, appointment := range r.store.appointments {
+		if appointment.DoctorID == doctorId {
+			delete(r.store.appointments, appointmentId)
+		}
+	}
+	return nil
+}
+
+func (r *memoryAppointmentRepo) DeleteUnused(appointmentId string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists || len(appointment.PatientAccountIDs) > 0 || len(appointment.Waitlist) > 0 || len(appointment.History) > 0 {
+		return false, nil
+	}
+
+	delete(r.store.appointments, appointmentId)
+	return true, nil
+}
+
+func (r *memoryAppointmentRepo) AddPatient(appointmentId string, change entity.TStatusChange) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists || containsID(appointment.PatientAccountIDs, change.AccountID) ||
+		len(appointment.PatientAccountIDs) >= int(appointment.MaxAppointment) ||
+		(len(appointment.Waitlist) > 0 && appointment.Waitlist[0].AccountID != change.AccountID) {
+		return false, nil
+	}
+
+	appointment = copyAppointment(appointment)
+	appointment.PatientAccountIDs = append(appointment.PatientAccountIDs, change.AccountID)
+	appointment.Waitlist = withoutWaitlisted(appointment.Waitlist, change.AccountID)
+	r.store.appointments[appointmentId] = withStatusChange(appointment, change)
+	return true, nil
+}
+
+func (r *memoryAppointmentRepo) AddToWaitlist(appointmentId string, entry entity.TWaitlistEntry) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists || containsID(appointment.PatientAccountIDs, entry.AccountID) || appointment.WaitlistPosition(entry.AccountID) > 0 ||
+		(len(appointment.Waitlist) == 0 && len(appointment.PatientAccountIDs) < int(appointment.MaxAppointment)) {
+		return false, nil
+	}
+
+	appointment = copyAppointment(appointment)
+	appointment.Waitlist = append(appointment.Waitlist, entry)
+	r.store.appointments[appointmentId] = appointment
+	return true, nil
+}
+
+func (r *memoryAppointmentRepo) RemoveFromWaitlist(appointmentId, accountId string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists || appointment.WaitlistPosition(accountId) == 0 {
+		return false, nil
+	}
+
+	appointment = copyAppointment(appointment)
+	appointment.Waitlist = withoutWaitlisted(appointment.Waitlist, accountId)
+	r.store.appointments[appointmentId] = appointment
+	return true, nil
+}
+
+func (r *memoryAppointmentRepo) PromoteWaitlisted(appointmentId string, change entity.TStatusChange) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists || appointment.WaitlistPosition(change.AccountID) != 1 || containsID(appointment.PatientAccountIDs, change.AccountID) ||
+		len(appointment.PatientAccountIDs) >= int(appointment.MaxAppointment) {
+		return false, nil
+	}
+
+	appointment = copyAppointment(appointment)
+	appointment.Waitlist = appointment.Waitlist[1:]
+	appointment.PatientAccountIDs = append(appointment.PatientAccountIDs, change.AccountID)
+	r.store.appointments[appointmentId] = withStatusChange(appointment, change)
+	return true, nil
+}
+
+func withoutWaitlisted(waitlist []entity.TWaitlistEntry, accountId string) []entity.TWaitlistEntry {
+	var result []entity.TWaitlistEntry
+	for _, entry := range waitlist {
+		if entry.AccountID != accountId {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
+
+func (r *memoryAppointmentRepo) RemovePatient(appointmentId string, from []entity.TAppointmentStatus, change entity.TStatusChange) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists || !hasPatientStatus(appointment, change.AccountID, from) {
+		return false, nil
+	}
+
+	appointment = copyAppointment(appointment)
+	patientAccountIds := []string{}
+	for _, id := range appointment.PatientAccountIDs {
+		if id != change.AccountID {
+			patientAccountIds = append(patientAccountIds, id)
+		}
+	}
+	appointment.PatientAccountIDs = patientAccountIds
+	r.store.appointments[appointmentId] = withStatusChange(appointment, change)
+	return true, nil
+}
+
+func (r *memoryAppointmentRepo) UpdatePatientStatus(appointmentId string, from []entity.TAppointmentStatus, change entity.TStatusChange) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	appointment, isExists := r.store.appointments[appointmentId]
+	if !isExists || !hasPatientStatus(appointment, change.AccountID, from) {
+		return false, nil
+	}
+
+	r.store.appointments[appointmentId] = withStatusChange(copyAppointment(appointment), change)
+	return true, nil
+}
+
+func hasPatientStatus(appointment entity.TAppointment, accountId string, from []entity.TAppointmentStatus) bool {
+	if !containsID(appointment.PatientAccountIDs, accountId) {
+		return false
+	}
+
+	status := appointment.StatusOf(accountId)
+	for _, item := range from {
+		if item == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withStatusChange expects a copy, it writes the status and history of appointment in place
+func withStatusChange(appointment entity.TAppointment, change entity.TStatusChange) entity.TAppointment {
+	if appointment.PatientStatus == nil {
+		appointment.PatientStatus = map[string]entity.TAppointmentStatus{}
+	}
+	appointment.PatientStatus[change.AccountID] = change.ToStatus
+	appointment.History = append(appointment.History, change)
+
+	return appointment
+}
+
+func copyAppointment(appointment entity.TAppointment) entity.TAppointment {
+	if appointment.PatientAccountIDs != nil {
+		appointment.PatientAccountIDs = append([]string{}, appointment.PatientAccountIDs...)
+	}
+	if appointment.PatientStatus != nil {
+		patientStatus := make(map[string]entity.TAppointmentStatus, len(appointment.PatientStatus))
+		for accountId, status := range appointment.PatientStatus {
+			patientStatus[accountId] = status
+		}
+		appointment.PatientStatus = patientStatus
+	}
+	if appointment.History != nil {
+		appointment.History = append([]entity.TStatusChange{}, appointment.History...)
+	}
+	if appointment.Waitlist != nil {
+		appointment.Waitlist = append([]entity.TWaitlistEntry{}, appointment.Waitlist...)
+	}
+
+	return appointment
+}
+
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// +++++++++++++ VITALS +++++++++++++++
+
+type memoryVitalsRepo struct {
+	store *MemoryRepositories
+}
+
+func (r *memoryVitalsRepo) Create(payload entity.TVitals) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.vitals = append(r.store.vitals, payload)
+	return nil
+}
+
+// ReadManyByPatient returns the latest recording first, like the Mongo sort on recorded_at
+func (r *memoryVitalsRepo) ReadManyByPatient(accountId string, result *[]entity.TVitals) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	vitals := []entity.TVitals{}
+	for _, recorded := range r.store.vitals {
+		if recorded.PatientAccountID == accountId {
+			vitals = append(vitals, recorded)
+		}
+	}
+	sort.SliceStable(vitals, func(i, j int) bool { return vitals[i].RecordedAt.After(vitals[j].RecordedAt) })
+
+	*result = vitals
+	return nil
+}
+
+// +++++++++++++ SCHEDULE +++++++++++++++
+
+type memoryScheduleRepo struct {
+	store *MemoryRepositories
+}
+
+func (r *memoryScheduleRepo) Upsert(payload entity.TWorkingSchedule) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.schedules[payload.DoctorID] = copySchedule(payload)
+	return nil
+}
+
+func (r *memoryScheduleRepo) ReadByDoctor(doctorId string, result *entity.TWorkingSchedule) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	schedule, isExists := r.store.schedules[doctorId]
+	if !isExists {
+		return ErrScheduleNotFound
+	}
+
+	*result = copySchedule(schedule)
+	return nil
+}
+
+func (r *memoryScheduleRepo) DeleteByDoctor(doctorId string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.schedules, doctorId)
+	return nil
+}
+
+func copySchedule(schedule entity.TWorkingSchedule) entity.TWorkingSchedule {
+	schedule.WeeklyHours = append([]entity.TWorkingHours{}, schedule.WeeklyHours...)
+	schedule.Exceptions = append([]entity.TScheduleException{}, schedule.Exceptions...)
+	return schedule
+}
+
+// +++++++++++++ QUEUE +++++++++++++++
+
+type memoryQueueRepo struct {
+	store *MemoryRepositories
+}
+
+func queueKey(doctorId, date string) string {
+	return doctorId + "/" + date
+}
+
+func (r *memoryQueueRepo) Read(doctorId, date string, result *entity.TQueue) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	queue, isExists := r.store.queues[queueKey(doctorId, date)]
+	if !isExists {
+		return ErrQueueNotFound
+	}
+
+	*result = copyQueue(queue)
+	return nil
+}
+
+func (r *memoryQueueRepo) IssueTicket(doctorId, date string, ticket entity.TQueueTicket) (int, bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	queue, isExists := r.store.queues[queueKey(doctorId, date)]
+	if !isExists {
+		queue = entity.TQueue{DoctorID: doctorId, Date: date}
+	}
+	queue = copyQueue(queue)
+
+	if ticket.AccountID != "" {
+		for _, issued := range queue.Tickets {
+			if issued.AccountID == ticket.AccountID {
+				return 0, false, nil
+			}
+		}
+	}
+
+	queue.LastNumber++
+	ticket.Number = queue.LastNumber
+	queue.Tickets = append(queue.Tickets, ticket)
+	queue.UpdatedAt = ticket.IssuedAt
+	r.store.queues[queueKey(doctorId, date)] = queue
+	return ticket.Number, true, nil
+}
+
+func (r *memoryQueueRepo) CallNext(doctorId, date string, current, number int, now time.Time) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	queue, isExists := r.store.queues[queueKey(doctorId, date)]
+	if !isExists || queue.CurrentNumber != current {
+		return false, nil
+	}
+
+	queue = copyQueue(queue)
+	isWaiting := false
+	for i := range queue.Tickets {
+		if queue.Tickets[i].Number == number && queue.Tickets[i].Status == entity.QUEUE_WAITING {
+			isWaiting = true
+		}
+	}
+	if !isWaiting {
+		return false, nil
+	}
+
+	for i := range queue.Tickets {
+		switch queue.Tickets[i].Number {
+		case current:
+			queue.Tickets[i].Status = entity.QUEUE_DONE
+		case number:
+			calledAt := now
+			queue.Tickets[i].Status = entity.QUEUE_CALLED
+			queue.Tickets[i].CalledAt = &calledAt
+		}
+	}
+	queue.CurrentNumber = number
+	queue.UpdatedAt = now
+	r.store.queues[queueKey(doctorId, date)] = queue
+	return true, nil
+}
+
+func (r *memoryQueueRepo) DeleteManyByDoctor(doctorId string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for key, queue := range r.store.queues {
+		if queue.DoctorID == doctorId {
+			delete(r.store.queues, key)
+		}
+	}
+	return nil
+}
+
+func copyQueue(queue entity.TQueue) entity.TQueue {
+	queue.Tickets = append([]entity.TQueueTicket{}, queue.Tickets...)
+	return queue
+}
+
+// +++++++++++++ SESSION +++++++++++++++
+
+type memorySessionRepo struct {
+	store *MemoryRepositories
+}
+
+func (r *memorySessionRepo) Create(payload entity.TSession) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.sessions[payload.SessionID] = copySession(payload)
+	return nil
+}
+
+func (r *memorySessionRepo) findOne(match func(entity.TSession) bool, result *entity.TSession) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, session := range r.store.sessions {
+		if match(session) {
+			*result = copySession(session)
+			return nil
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+func (r *memorySessionRepo) ReadByTokenHash(tokenHash string, result *entity.TSession) error {
+	return r.findOne(func(session entity.TSession) bool { return session.RefreshTokenHash == tokenHash }, result)
+}
+
+func (r *memorySessionRepo) ReadByUsedTokenHash(tokenHash string, result *entity.TSession) error {
+	return r.findOne(func(session entity.TSession) bool { return containsID(session.UsedTokenHashes, tokenHash) }, result)
+}
+
+func (r *memorySessionRepo) Rotate(sessionId, oldHash, newHash string, now time.Time) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	session, isExists := r.store.sessions[sessionId]
+	if !isExists || session.RefreshTokenHash != oldHash || session.IsRevoked || !session.ExpiredAt.After(now) {
+		return false, nil
+	}
+
+	session = copySession(session)
+	session.RefreshTokenHash = newHash
+	session.RefreshedAt = now
+	session.UsedTokenHashes = append(session.UsedTokenHashes, oldHash)
+	r.store.sessions[sessionId] = session
+	return true, nil
+}
+
+func (r *memorySessionRepo) CheckActive(sessionId string, now time.Time) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	session, isExists := r.store.sessions[sessionId]
+	return isExists && !session.IsRevoked && session.ExpiredAt.After(now), nil
+}
+
+func (r *memorySessionRepo) Revoke(sessionId string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if session, isExists := r.store.sessions[sessionId]; isExists {
+		session.IsRevoked = true
+		r.store.sessions[sessionId] = session
+	}
+	return nil
+}
+
+func (r *memorySessionRepo) RevokeAllByAccount(accountId string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for sessionId, session := range r.store.sessions {
+		if session.AccountID == accountId {
+			session.IsRevoked = true
+			r.store.sessions[sessionId] = session
+		}
+	}
+	return nil
+}
+
+func copySession(session entity.TSession) entity.TSession {
+	session.UsedTokenHashes = append([]string{}, session.UsedTokenHashes...)
+	return session
+}
+
+// +++++++++++++ USED TOKEN +++++++++++++++
+
+type memoryUsedTokenRepo struct {
+	store *MemoryRepositories
+}
+
+func (r *memoryUsedTokenRepo) Use(payload entity.TUsedToken) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, isUsed := r.store.usedTokens[payload.TokenID]; isUsed {
+		return false, nil
+	}
+
+	r.store.usedTokens[payload.TokenID] = payload
+	return true, nil
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migrate brings documents stored by older versions up to what the repositories expect, it runs once
+// at startup and every step is safe to run again
+func Migrate(ctx context.Context, client *mongo.Client) error {
+	if err := NewDoctorRepo(ctx, client).BackfillIsActive(); err != nil {
+		return err
+	}
+
+	if err := NewDoctorRepo(ctx, client).BackfillSearchWords(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const queueDayIndex = "doctor_date_unique"
+
+func NewQueueRepo(ctx context.Context, client *mongo.Client) *QueueRepo {
+	const repoName = "queue"
+	mongoConfig := config.CONFIG.Repositories[repoName]
+
+	collection := client.Database(mongoConfig.DBName).Collection(mongoConfig.CollName)
+	return &QueueRepo{
+		coll: collection,
+		ctx:  ctx,
+	}
+}
+
+// QueueRepo holds one queue per doctor and day
+type QueueRepo struct {
+	coll *mongo.Collection
+	ctx  context.Context
+}
+
+// EnsureIndexes creates the unique index that keeps concurrent first tickets of a day on one queue
+func (r *QueueRepo) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateOne(r.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "doctor_id", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetName(queueDayIndex).SetUnique(true),
+	})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *QueueRepo) Read(doctorId, date string, result *entity.TQueue) error {
+	err := r.coll.FindOne(r.ctx, bson.M{"doctor_id": doctorId, "date": date}).Decode(result)
+	if err != nil {
+		logrus.Error(err)
+		return notFound(err, ErrQueueNotFound)
+	}
+
+	return nil
+}
+
+// IssueTicket gives ticket the next number of the day and stores it in the same update, creating the
+// queue on the first one. A ticket with an AccountID is only stored while that patient holds no number
+// of the day yet. It returns the number, or false when the patient already had one.
+func (r *QueueRepo) IssueTicket(doctorId, date string, ticket entity.TQueueTicket) (int, bool, error) {
+	filter := bson.M{"doctor_id": doctorId, "date": date}
+	if ticket.AccountID != "" {
+		filter["tickets.account_id"] = bson.M{"$ne": ticket.AccountID}
+	}
+
+	// A pipeline update so the ticket can carry the number it increments to, the ticket fields go in as
+	// literals so no value is read as an expression
+	number := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$last_number", 0}}, 1}}
+	update := bson.A{bson.M{"$set": bson.M{
+		"last_number":    number,
+		"current_number": bson.M{"$ifNull": bson.A{"$current_number", 0}},
+		"updated_at":     ticket.IssuedAt,
+		"tickets": bson.M{"$concatArrays": bson.A{
+			bson.M{"$ifNull": bson.A{"$tickets", bson.A{}}},
+			bson.A{bson.M{"$mergeObjects": bson.A{bson.M{"$literal": ticket}, bson.M{"number": number}}}},
+		}},
+	}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	// The filter missing the queue inserts a new one, which the unique index refuses when the queue
+	// exists: either a concurrent first ticket created it, then the retry matches, or the patient
+	// already holds a number, then the retry is refused again
+	var queue entity.TQueue
+	err := r.coll.FindOneAndUpdate(r.ctx, filter, update, opts).Decode(&queue)
+	if mongo.IsDuplicateKeyError(err) {
+		err = r.coll.FindOneAndUpdate(r.ctx, filter, update, opts).Decode(&queue)
+	}
+	if mongo.IsDuplicateKeyError(err) && ticket.AccountID != "" {
+		return 0, false, nil
+	}
+	if err != nil {
+		logrus.Error(err)
+		return 0, false, err
+	}
+
+	return queue.LastNumber, true, nil
+}
+
+// CallNext serves number: it becomes CALLED and the ticket served before it DONE. The update only
+// applies while current is still the number being served and number is still waiting, so two desks
+// calling at once can't call the same patient.
+// It returns false when the guard did not match, the caller decides why.
+func (r *QueueRepo) CallNext(doctorId, date string, current, number int, now time.Time) (bool, error) {
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		bson.M{"previous.number": current},
+		bson.M{"next.number": number},
+	}})
+
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"doctor_id":      doctorId,
+		"date":           date,
+		"current_number": current,
+		"tickets":        bson.M{"$elemMatch": bson.M{"number": number, "status": entity.QUEUE_WAITING}},
+	}, bson.M{"$set": bson.M{
+		"current_number":             number,
+		"updated_at":                 now,
+		"tickets.$[previous].status": entity.QUEUE_DONE,
+		"tickets.$[next].status":     entity.QUEUE_CALLED,
+		"tickets.$[next].called_at":  now,
+	}}, opts)
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+// DeleteManyByDoctor removes the queues of every day of the doctor
+func (r *QueueRepo) DeleteManyByDoctor(doctorId string) error {
+	if _, err := r.coll.DeleteMany(r.ctx, bson.M{"doctor_id": doctorId}); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
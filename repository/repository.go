@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AccountRepository is implemented by AccountRepo and the in-memory MemoryRepositories.
+// Reads of a missing account return ErrAccountNotFound in both.
+type AccountRepository interface {
+	Create(payload entity.TAccount) error
+	Read(accountId string, result *entity.TAccount) error
+	ReadByEmail(email string, result *entity.TAccount) error
+	ReadByUsername(username string, result *entity.TAccount) error
+	ReadManyByIDs(accountIds []string, result *[]entity.TAccount) error
+	ReadManyByFilter(filter entity.TGetManyAccountReq, result *[]entity.TAccount) (entity.TListPage, error)
+	CheckAccountByEmail(email string) (bool, error)
+	CheckAccountByUsername(username string) (bool, error)
+	CheckAccountByDoctor(doctorId string) (bool, error)
+	UpdatePassword(accountId, password string) error
+	Update(accountId string, payload entity.TUpdateAccount) error
+	SetTOTPPendingSecret(accountId, secret string) error
+	EnableTOTP(accountId, secret string, step int64, recoveryCodeHashes []string) (bool, error)
+	DisableTOTP(accountId string) error
+	UseTOTPStep(accountId string, step int64) (bool, error)
+	UseRecoveryCode(accountId, codeHash string) (bool, error)
+	MarkEmailVerified(accountId, email string) (bool, error)
+}
+
+type DoctorRepository interface {
+	Create(payload entity.TDoctor) error
+	CheckDoctorByName(firstName, lastName string) (bool, error)
+	Read(doctorId string, result *entity.TDoctor) error
+	ReadManyByFilter(filter entity.TGetManyDoctorReq, result *[]entity.TDoctor) (entity.TListPage, error)
+	Update(doctorId string, payload entity.TUpdateDoctor) error
+	LockAppointments(doctorId string) error
+	Delete(doctorId string) error
+}
+
+// AppointmentRepository Create returns ErrDuplicateSlot when the doctor already has an appointment starting
+// at the same time
+type AppointmentRepository interface {
+	Create(payload entity.TAppointment) error
+	Read(appointmentId string, result *entity.TAppointment) error
+	ReadManyByDoctor(doctorId string, result *[]entity.TAppointment) error
+	ReadManyByFilter(filter entity.TGetManyAppointmentReq, result *[]entity.TAppointment) (entity.TListPage, error)
+	ReadBySlot(doctorId string, startAt time.Time, result *entity.TAppointment) error
+	ReadManyByDoctorRange(doctorId string, from, to time.Time, result *[]entity.TAppointment) error
+	CheckOverlap(doctorId string, startAt, endAt time.Time) (bool, error)
+	ReadManyByPatient(accountId string, result *[]entity.TAppointment) error
+	CheckPatientWithDoctor(doctorId, accountId string) (bool, error)
+	Update(appointmentId string, payload entity.TUpdateAppointment) error
+	Delete(appointmentId string) error
+	DeleteManyByDoctor(doctorId string) error
+	DeleteUnused(appointmentId string) (bool, error)
+	AddPatient(appointmentId string, change entity.TStatusChange) (bool, error)
+	RemovePatient(appointmentId string, from []entity.TAppointmentStatus, change entity.TStatusChange) (bool, error)
+	UpdatePatientStatus(appointmentId string, from []entity.TAppointmentStatus, change entity.TStatusChange) (bool, error)
+	AddToWaitlist(appointmentId string, entry entity.TWaitlistEntry) (bool, error)
+	RemoveFromWaitlist(appointmentId, accountId string) (bool, error)
+	PromoteWaitlisted(appointmentId string, change entity.TStatusChange) (bool, error)
+}
+
+type VitalsRepository interface {
+	Create(payload entity.TVitals) error
+	ReadManyByPatient(accountId string, result *[]entity.TVitals) error
+}
+
+type SessionRepository interface {
+	Create(payload entity.TSession) error
+	ReadByTokenHash(tokenHash string, result *entity.TSession) error
+	ReadByUsedTokenHash(tokenHash string, result *entity.TSession) error
+	Rotate(sessionId, oldHash, newHash string, now time.Time) (bool, error)
+	CheckActive(sessionId string, now time.Time) (bool, error)
+	Revoke(sessionId string) error
+	RevokeAllByAccount(accountId string) error
+}
+
+type UsedTokenRepository interface {
+	Use(payload entity.TUsedToken) (bool, error)
+}
+
+type ScheduleRepository interface {
+	Upsert(payload entity.TWorkingSchedule) error
+	ReadByDoctor(doctorId string, result *entity.TWorkingSchedule) error
+	DeleteByDoctor(doctorId string) error
+}
+
+type QueueRepository interface {
+	Read(doctorId, date string, result *entity.TQueue) error
+	IssueTicket(doctorId, date string, ticket entity.TQueueTicket) (int, bool, error)
+	CallNext(doctorId, date string, current, number int, now time.Time) (bool, error)
+	DeleteManyByDoctor(doctorId string) error
+}
+
+// Repositories hands out request scoped repositories, services depend on it instead of building Mongo repos
+type Repositories interface {
+	Account(ctx context.Context) AccountRepository
+	Doctor(ctx context.Context) DoctorRepository
+	Appointment(ctx context.Context) AppointmentRepository
+	Vitals(ctx context.Context) VitalsRepository
+	Schedule(ctx context.Context) ScheduleRepository
+	Queue(ctx context.Context) QueueRepository
+	Session(ctx context.Context) SessionRepository
+	UsedToken(ctx context.Context) UsedTokenRepository
+	// LoginAttempt is not request scoped, the store takes the context per call
+	LoginAttempt() LoginAttemptStore
+}
+
+func NewMongoRepositories(client *mongo.Client) Repositories {
+	return &mongoRepositories{client: client}
+}
+
+type mongoRepositories struct {
+	client *mongo.Client
+}
+
+func (r *mongoRepositories) Account(ctx context.Context) AccountRepository {
+	return NewAccountRepo(ctx, r.client)
+}
+
+func (r *mongoRepositories) Doctor(ctx context.Context) DoctorRepository {
+	return NewDoctorRepo(ctx, r.client)
+}
+
+func (r *mongoRepositories) Appointment(ctx context.Context) AppointmentRepository {
+	return NewAppointmentRepo(ctx, r.client)
+}
+
+func (r *mongoRepositories) Vitals(ctx context.Context) VitalsRepository {
+	return NewVitalsRepo(ctx, r.client)
+}
+
+func (r *mongoRepositories) Schedule(ctx context.Context) ScheduleRepository {
+	return NewScheduleRepo(ctx, r.client)
+}
+
+func (r *mongoRepositories) Queue(ctx context.Context) QueueRepository {
+	return NewQueueRepo(ctx, r.client)
+}
+
+func (r *mongoRepositories) Session(ctx context.Context) SessionRepository {
+	return NewSessionRepo(ctx, r.client)
+}
+
+func (r *mongoRepositories) UsedToken(ctx context.Context) UsedTokenRepository {
+	return NewUsedTokenRepo(ctx, r.client)
+}
+
+func (r *mongoRepositories) LoginAttempt() LoginAttemptStore {
+	return NewLoginAttemptRepo(r.client)
+}
+
+// compile time checks that the Mongo repositories keep up with the interfaces
+var (
+	_ AccountRepository     = (*AccountRepo)(nil)
+	_ DoctorRepository      = (*DoctorRepo)(nil)
+	_ AppointmentRepository = (*AppointmentRepo)(nil)
+	_ VitalsRepository      = (*VitalsRepo)(nil)
+	_ ScheduleRepository    = (*ScheduleRepo)(nil)
+	_ QueueRepository       = (*QueueRepo)(nil)
+	_ SessionRepository     = (*SessionRepo)(nil)
+	_ UsedTokenRepository   = (*UsedTokenRepo)(nil)
+	_ LoginAttemptStore     = (*LoginAttemptRepo)(nil)
+)
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func NewScheduleRepo(ctx context.Context, client *mongo.Client) *ScheduleRepo {
+	const repoName = "schedule"
+	mongoConfig := config.CONFIG.Repositories[repoName]
+
+	collection := client.Database(mongoConfig.DBName).Collection(mongoConfig.CollName)
+	return &ScheduleRepo{
+		coll: collection,
+		ctx:  ctx,
+	}
+}
+
+// ScheduleRepo holds one working schedule per doctor
+type ScheduleRepo struct {
+	coll *mongo.Collection
+	ctx  context.Context
+}
+
+// Upsert replaces the schedule of the doctor, or creates it
+func (r *ScheduleRepo) Upsert(payload entity.TWorkingSchedule) error {
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.coll.ReplaceOne(r.ctx, bson.M{"doctor_id": payload.DoctorID}, payload, opts); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *ScheduleRepo) ReadByDoctor(doctorId string, result *entity.TWorkingSchedule) error {
+	err := r.coll.FindOne(r.ctx, bson.M{"doctor_id": doctorId}).Decode(result)
+	if err != nil {
+		logrus.Error(err)
+		return notFound(err, ErrScheduleNotFound)
+	}
+
+	return nil
+}
+
+// DeleteByDoctor removes the schedule of the doctor, a doctor without one is not an error
+func (r *ScheduleRepo) DeleteByDoctor(doctorId string) error {
+	if _, err := r.coll.DeleteOne(r.ctx, bson.M{"doctor_id": doctorId}); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	sessionIdIndex        = "session_id_unique"
+	sessionTokenIndex     = "refresh_token_hash_unique"
+	sessionUsedTokenIndex = "used_token_hashes"
+	sessionAccountIndex   = "account_id"
+	sessionExpireIndex    = "expired_at_ttl"
+)
+
+func NewSessionRepo(ctx context.Context, client *mongo.Client) *SessionRepo {
+	const repoName = "session"
+	mongoConfig := config.CONFIG.Repositories[repoName]
+
+	collection := client.Database(mongoConfig.DBName).Collection(mongoConfig.CollName)
+	return &SessionRepo{
+		coll: collection,
+		ctx:  ctx,
+	}
+}
+
+type SessionRepo struct {
+	coll *mongo.Collection
+	ctx  context.Context
+}
+
+// EnsureIndexes creates the indexes behind the per request session check, refresh and reuse detection
+// and account wide revokes. Expired sessions are purged by the TTL index.
+func (r *SessionRepo) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "session_id", Value: 1}},
+			Options: options.Index().SetName(sessionIdIndex).SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "refresh_token_hash", Value: 1}},
+			Options: options.Index().SetName(sessionTokenIndex).SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "used_token_hashes", Value: 1}},
+			Options: options.Index().SetName(sessionUsedTokenIndex),
+		},
+		{
+			Keys:    bson.D{{Key: "account_id", Value: 1}},
+			Options: options.Index().SetName(sessionAccountIndex),
+		},
+		{
+			Keys:    bson.D{{Key: "expired_at", Value: 1}},
+			Options: options.Index().SetName(sessionExpireIndex).SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) Create(payload entity.TSession) error {
+	if _, err := r.coll.InsertOne(r.ctx, payload); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) ReadByTokenHash(tokenHash string, result *entity.TSession) error {
+	err := r.coll.FindOne(r.ctx, bson.M{"refresh_token_hash": tokenHash}).Decode(result)
+	if err != nil {
+		logrus.Error(err)
+		return notFound(err, ErrSessionNotFound)
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) ReadByUsedTokenHash(tokenHash string, result *entity.TSession) error {
+	err := r.coll.FindOne(r.ctx, bson.M{"used_token_hashes": tokenHash}).Decode(result)
+	if err != nil {
+		logrus.Error(err)
+		return notFound(err, ErrSessionNotFound)
+	}
+
+	return nil
+}
+
+// Rotate swaps the current refresh token hash only if it is still oldHash, so two concurrent
+// refreshes with the same token can't both succeed. It returns false when the guard did not match.
+func (r *SessionRepo) Rotate(sessionId, oldHash, newHash string, now time.Time) (bool, error) {
+	updateResult, err := r.coll.UpdateOne(r.ctx, bson.M{
+		"session_id":         sessionId,
+		"refresh_token_hash": oldHash,
+		"is_revoked":         false,
+		"expired_at":         bson.M{"$gt": now},
+	}, bson.M{
+		"$set":  bson.M{"refresh_token_hash": newHash, "refreshed_at": now},
+		"$push": bson.M{"used_token_hashes": oldHash},
+	})
+	if err != nil {
+		logrus.Error(err)
+		return false, err
+	}
+
+	return updateResult.ModifiedCount == 1, nil
+}
+
+func (r *SessionRepo) CheckActive(sessionId string, now time.Time) (bool, error) {
+	count, err := r.coll.CountDocuments(r.ctx, bson.M{
+		"session_id": sessionId,
+		"is_revoked": false,
+		"expired_at": bson.M{"$gt": now},
+	})
+	if err != nil && err != mongo.ErrNoDocuments {
+		logrus.Error(err)
+		return false, err
+	}
+
+	if count == 0 {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (r *SessionRepo) Revoke(sessionId string) error {
+	_, err := r.coll.UpdateOne(r.ctx, bson.M{"session_id": sessionId}, bson.M{"$set": bson.M{"is_revoked": true}})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) RevokeAllByAccount(accountId string) error {
+	_, err := r.coll.UpdateMany(r.ctx, bson.M{"account_id": accountId, "is_revoked": false}, bson.M{"$set": bson.M{"is_revoked": true}})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const usedTokenExpireIndex = "expired_at_ttl"
+
+func NewUsedTokenRepo(ctx context.Context, client *mongo.Client) *UsedTokenRepo {
+	const repoName = "used_token"
+	mongoConfig := config.CONFIG.Repositories[repoName]
+
+	collection := client.Database(mongoConfig.DBName).Collection(mongoConfig.CollName)
+	return &UsedTokenRepo{
+		coll: collection,
+		ctx:  ctx,
+	}
+}
+
+type UsedTokenRepo struct {
+	coll *mongo.Collection
+	ctx  context.Context
+}
+
+// EnsureIndexes creates the TTL index that purges a used token once the token itself expired,
+// it can't be replayed anymore by then
+func (r *UsedTokenRepo) EnsureIndexes() error {
+	_, err := r.coll.Indexes().CreateOne(r.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expired_at", Value: 1}},
+		Options: options.Index().SetName(usedTokenExpireIndex).SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Use marks the token as spent, it returns false when it was already used.
+// The jti is the _id so the unique index settles concurrent attempts.
+func (r *UsedTokenRepo) Use(payload entity.TUsedToken) (bool, error) {
+	_, err := r.coll.InsertOne(r.ctx, payload)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		logrus.Error(err)
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func NewVitalsRepo(ctx context.Context, client *mongo.Client) *VitalsRepo {
+	const repoName = "vitals"
+	mongoConfig := config.CONFIG.Repositories[repoName]
+
+	collection := client.Database(mongoConfig.DBName).Collection(mongoConfig.CollName)
+	return &VitalsRepo{
+		coll: collection,
+		ctx:  ctx,
+	}
+}
+
+type VitalsRepo struct {
+	coll *mongo.Collection
+	ctx  context.Context
+}
+
+func (r *VitalsRepo) Create(payload entity.TVitals) error {
+	if _, err := r.coll.InsertOne(r.ctx, payload); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *VitalsRepo) ReadManyByPatient(accountId string, result *[]entity.TVitals) error {
+	opts := options.Find().SetSort(bson.D{{Key: "recorded_at", Value: -1}})
+	cursor, err := r.coll.Find(r.ctx, bson.M{"patient_account_id": accountId}, opts)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if err = cursor.All(r.ctx, result); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNothingToUpdate    = entity.NewValidationError("nothing to update")
+	ErrAccountExists      = entity.NewConflictError("already exists")
+	ErrEmailExists        = entity.NewConflictError("email already exists")
+	ErrUsernameExists     = entity.NewConflictError("username already exists")
+	ErrInvalidUsername    = entity.NewValidationError("username can't contain @")
+	ErrInvalidPassword    = entity.NewValidationError("invalid current password")
+	ErrPasswordRequired   = entity.NewValidationError("current password required")
+	ErrPasswordTooLong    = entity.NewValidationError("password can't be longer than 72 bytes")
+	ErrInvalidRole        = entity.NewValidationError("invalid role")
+	ErrDoctorIDRequired   = entity.NewValidationError("doctor_id required for DOCTOR accounts")
+	ErrDoctorIDNotAllowed = entity.NewValidationError("doctor_id is only allowed for DOCTOR accounts")
+	ErrDoctorLinked       = entity.NewConflictError("doctor already linked to an account")
+	ErrDoctorNotLinked    = entity.NewForbiddenError("account is not linked to a doctor")
+	ErrNotPatient         = entity.NewValidationError("account is not a patient")
+	ErrPatientNotFound    = entity.NewNotFoundError("patient not found")
+)
+
+// prepareAccountUpdate turns a partial update request into the repository payload.
+// Email and username are only re-checked for uniqueness when they actually change, and a new
+// password is hashed. When requireCurrentPassword is set a password change must carry the current one.
+func prepareAccountUpdate(accountRepo repository.AccountRepository, current entity.TAccount, payload entity.TUpdateAccountReq, requireCurrentPassword bool) (entity.TUpdateAccount, error) {
+	if payload.FirstName == nil && payload.LastName == nil && payload.Age == nil &&
+		payload.Email == nil && payload.Username == nil && payload.Password == nil {
+		return entity.TUpdateAccount{}, ErrNothingToUpdate
+	}
+
+	update := entity.TUpdateAccount{
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Age:       payload.Age,
+	}
+
+	if payload.Email != nil && helper.NormalizeEmail(*payload.Email) != helper.NormalizeEmail(current.Email) {
+		email := helper.NormalizeEmail(*payload.Email)
+		isExists, err := accountRepo.CheckAccountByEmail(email)
+		if err != nil {
+			return update, err
+		}
+		if isExists {
+			return update, ErrEmailExists
+		}
+		update.Email = &email
+
+		// The new address has to be verified again
+		isVerified := false
+		update.EmailVerified = &isVerified
+	}
+
+	if payload.Username != nil && strings.TrimSpace(*payload.Username) != current.Username {
+		username := strings.TrimSpace(*payload.Username)
+		if err := validateUsername(username); err != nil {
+			return update, err
+		}
+		isExists, err := accountRepo.CheckAccountByUsername(username)
+		if err != nil {
+			return update, err
+		}
+		if isExists {
+			return update, ErrUsernameExists
+		}
+		update.Username = &username
+	}
+
+	if payload.Password != nil {
+		if requireCurrentPassword {
+			if payload.CurrentPassword == nil {
+				return update, ErrPasswordRequired
+			}
+			if isMatch, _ := helper.ComparePassword(current.Password, *payload.CurrentPassword); !isMatch {
+				return update, ErrInvalidPassword
+			}
+		}
+		if err := validatePassword(*payload.Password); err != nil {
+			return update, err
+		}
+
+		hashed, err := helper.HashPassword(*payload.Password)
+		if err != nil {
+			logrus.Error("SAccount.prepareAccountUpdate.HashPassword.", err)
+			return update, err
+		}
+		update.Password = &hashed
+	}
+
+	return update, nil
+}
+
+// isEmptyAccountUpdate reports whether there is nothing left to $set, e.g. only unchanged email/username were sent
+func isEmptyAccountUpdate(update entity.TUpdateAccount) bool {
+	return update.FirstName == nil && update.LastName == nil && update.Age == nil &&
+		update.Email == nil && update.Username == nil && update.Password == nil
+}
+
+// validateUsername keeps usernames and emails apart, so a login identifier can only mean one account
+func validateUsername(username string) error {
+	if strings.Contains(username, "@") {
+		return ErrInvalidUsername
+	}
+
+	return nil
+}
+
+// validatePassword rejects what bcrypt can't hash, so it surfaces as a validation error instead of a 500
+func validatePassword(password string) error {
+	if len(password) > helper.MaxPasswordBytes {
+		return ErrPasswordTooLong
+	}
+
+	return nil
+}
+
+// accountWriteError maps a unique index violation to the same errors the pre-write checks return
+func accountWriteError(err error) error {
+	switch err {
+	case repository.ErrDuplicateEmail:
+		return ErrEmailExists
+	case repository.ErrDuplicateUsername:
+		return ErrUsernameExists
+	case repository.ErrDuplicateDoctor:
+		return ErrDoctorLinked
+	}
+
+	return err
+}
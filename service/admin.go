@@ -2,27 +2,26 @@ package service
 
 import (
 	"context"
+	"strings"
 
 	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
 	"github.com/agustadewa/hospital-backend/repository"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func NewAdminService(client *mongo.Client) *Admin {
-	return &Admin{mongoClient: client}
+func NewAdminService(client *mongo.Client, repos repository.Repositories) *Admin {
+	return &Admin{mongoClient: client, repos: repos}
 }
 
 type Admin struct {
 	mongoClient *mongo.Client
-}
-
-func (s *Admin) IsAdmin(ctx context.Context, accountId string) (bool, error) {
-	return repository.NewAccountRepo(ctx, s.mongoClient).CheckIsAdmin(accountId)
+	repos       repository.Repositories
 }
 
 func (s *Admin) GetAccount(ctx context.Context, accountId string, result *entity.TAccount) error {
-	if err := repository.NewAccountRepo(ctx, s.mongoClient).Read(accountId, result); err != nil {
+	if err := s.repos.Account(ctx).Read(accountId, result); err != nil {
 		logrus.Error(err)
 		return err
 	}
@@ -30,13 +29,27 @@ func (s *Admin) GetAccount(ctx context.Context, accountId string, result *entity
 	return nil
 }
 
+func (s *Admin) GetManyAccount(ctx context.Context, filter entity.TGetManyAccountReq, result *[]entity.TAccount) (entity.TListPage, error) {
+	if filter.Role != "" && !entity.IsValidRole(filter.Role) {
+		return entity.TListPage{}, ErrInvalidRole
+	}
+
+	page, err := s.repos.Account(ctx).ReadManyByFilter(filter, result)
+	if err != nil {
+		logrus.Error("SAdmin.GetManyAccount.ReadManyByFilter.", err)
+		return entity.TListPage{}, err
+	}
+
+	return page, nil
+}
+
 func (s *Admin) CheckAccountByEmailAndUsername(ctx context.Context, email, username string) (bool, error) {
-	accountRepo := repository.NewAccountRepo(ctx, s.mongoClient)
-	emailIsExists, err := accountRepo.CheckAccountByEmail(email)
+	accountRepo := s.repos.Account(ctx)
+	emailIsExists, err := accountRepo.CheckAccountByEmail(helper.NormalizeEmail(email))
 	if err != nil {
 		return false, err
 	}
-	usernameIsExists, err := accountRepo.CheckAccountByUsername(username)
+	usernameIsExists, err := accountRepo.CheckAccountByUsername(strings.TrimSpace(username))
 	if err != nil {
 		return false, err
 	}
@@ -49,18 +62,115 @@ func (s *Admin) CheckAccountByEmailAndUsername(ctx context.Context, email, usern
 }
 
 func (s *Admin) CreateAccount(ctx context.Context, id string, payload entity.TCreateAccountReq) error {
+	role := payload.Role
+	if role == "" {
+		role = entity.ADMINISTRATOR
+	}
+
+	if !entity.IsValidRole(role) {
+		return ErrInvalidRole
+	}
+
+	// A DOCTOR account must be linked to exactly one existing doctor record
+	if role == entity.DOCTOR {
+		if payload.DoctorID == "" {
+			return ErrDoctorIDRequired
+		}
+
+		if err := s.repos.Doctor(ctx).Read(payload.DoctorID, &entity.TDoctor{}); err != nil {
+			logrus.Error("SAdmin.CreateAccount.ReadDoctor.", err)
+			return err
+		}
+
+		isLinked, err := s.repos.Account(ctx).CheckAccountByDoctor(payload.DoctorID)
+		if err != nil {
+			return err
+		}
+		if isLinked {
+			return ErrDoctorLinked
+		}
+	} else if payload.DoctorID != "" {
+		return ErrDoctorIDNotAllowed
+	}
+
+	if err := validateUsername(strings.TrimSpace(payload.Username)); err != nil {
+		return err
+	}
+	if err := validatePassword(payload.Password); err != nil {
+		return err
+	}
+
+	password, err := helper.HashPassword(payload.Password)
+	if err != nil {
+		logrus.Error("SAdmin.CreateAccount.HashPassword.", err)
+		return err
+	}
+
 	account := entity.TAccount{
 		AccountID: id,
-		Role:      entity.ADMINISTRATOR,
+		Role:      role,
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Age:       payload.Age,
-		Email:     payload.Email,
-		Username:  payload.Username,
-		Password:  payload.Password,
+		Email:     helper.NormalizeEmail(payload.Email),
+		Username:  strings.TrimSpace(payload.Username),
+		Password:  password,
+		DoctorID:  payload.DoctorID,
 	}
-	if err := repository.NewAccountRepo(ctx, s.mongoClient).Create(account); err != nil {
+	if err := s.repos.Account(ctx).Create(account); err != nil {
 		logrus.Error("SAdmin.CreateAccount.Create.", err)
+		return accountWriteError(err)
+	}
+
+	return nil
+}
+
+// UpdateAccount updates any account, admins may reset a password without knowing the current one.
+// Changing the password revokes every session of the account.
+func (s *Admin) UpdateAccount(ctx context.Context, accountId string, payload entity.TUpdateAccountReq) error {
+	accountRepo := s.repos.Account(ctx)
+
+	var current entity.TAccount
+	if err := accountRepo.Read(accountId, &current); err != nil {
+		logrus.Error("SAdmin.UpdateAccount.Read.", err)
+		return err
+	}
+
+	update, err := prepareAccountUpdate(accountRepo, current, payload, false)
+	if err != nil {
+		logrus.Info("SAdmin.UpdateAccount.prepareAccountUpdate.", err)
+		return err
+	}
+
+	if isEmptyAccountUpdate(update) {
+		return nil
+	}
+
+	if err := accountRepo.Update(accountId, update); err != nil {
+		logrus.Error("SAdmin.UpdateAccount.Update.", err)
+		return accountWriteError(err)
+	}
+
+	// Like a reset, a new password signs out whoever held the old one
+	if update.Password != nil {
+		if err := s.repos.Session(ctx).RevokeAllByAccount(accountId); err != nil {
+			logrus.Error("SAdmin.UpdateAccount.RevokeAllByAccount.", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnlockAccount clears the failed login counter of an account locked out by the login guard
+func (s *Admin) UnlockAccount(ctx context.Context, accountId string) error {
+	if err := s.repos.Account(ctx).Read(accountId, &entity.TAccount{}); err != nil {
+		logrus.Error("SAdmin.UnlockAccount.Read.", err)
+		return err
+	}
+
+	if err := NewLoginGuard(s.repos).Reset(ctx, AccountLoginKey(accountId)); err != nil {
+		logrus.Error("SAdmin.UnlockAccount.Reset.", err)
 		return err
 	}
 
@@ -69,8 +179,10 @@ func (s *Admin) CreateAccount(ctx context.Context, id string, payload entity.TCr
 
 // +++++++++++++++ DOCTOR ++++++++++++++++
 
+var ErrDoctorExists = entity.NewConflictError("already exists")
+
 func (s *Admin) CheckDoctorByName(ctx context.Context, firstName, lastName string) (bool, error) {
-	doctorRepo := repository.NewDoctorRepo(ctx, s.mongoClient)
+	doctorRepo := s.repos.Doctor(ctx)
 	nameIsExists, err := doctorRepo.CheckDoctorByName(firstName, lastName)
 	if err != nil {
 		return false, err
@@ -84,7 +196,7 @@ func (s *Admin) CheckDoctorByName(ctx context.Context, firstName, lastName strin
 }
 
 func (s *Admin) GetDoctor(ctx context.Context, doctorId string, result *entity.TDoctor) error {
-	if err := repository.NewDoctorRepo(ctx, s.mongoClient).Read(doctorId, result); err != nil {
+	if err := s.repos.Doctor(ctx).Read(doctorId, result); err != nil {
 		logrus.Error("SAdmin.GetDoctor.Read.", err)
 		return err
 	}
@@ -92,22 +204,35 @@ func (s *Admin) GetDoctor(ctx context.Context, doctorId string, result *entity.T
 	return nil
 }
 
-func (s *Admin) GetManyDoctorByName(ctx context.Context, keyword string, result *[]entity.TDoctor) error {
-	if err := repository.NewDoctorRepo(ctx, s.mongoClient).ReadManyByName(keyword, result); err != nil {
-		logrus.Error("SAdmin.GetManyDoctor.ReadManyByName.", err)
-		return err
+func (s *Admin) GetManyDoctor(ctx context.Context, filter entity.TGetManyDoctorReq, result *[]entity.TDoctor) (entity.TListPage, error) {
+	page, err := s.repos.Doctor(ctx).ReadManyByFilter(filter, result)
+	if err != nil {
+		logrus.Error("SAdmin.GetManyDoctor.ReadManyByFilter.", err)
+		return entity.TListPage{}, err
 	}
 
-	return nil
+	return page, nil
 }
 
 func (s *Admin) CreateDoctor(ctx context.Context, doctorId string, payload entity.TCreateDoctorReq) error {
+	isActive := true
+	if payload.IsActive != nil {
+		isActive = *payload.IsActive
+	}
+
 	doctor := entity.TDoctor{
-		DoctorID:  doctorId,
-		FirstName: payload.FirstName,
-		LastName:  payload.LastName,
+		DoctorID:      doctorId,
+		FirstName:     payload.FirstName,
+		LastName:      payload.LastName,
+		Specialty:     payload.Specialty,
+		Department:    payload.Department,
+		LicenseNumber: payload.LicenseNumber,
+		Phone:         payload.Phone,
+		Bio:           payload.Bio,
+		IsActive:      isActive,
 	}
-	if err := repository.NewDoctorRepo(ctx, s.mongoClient).Create(doctor); err != nil {
+	doctor.SearchWords = doctor.ComputeSearchWords()
+	if err := s.repos.Doctor(ctx).Create(doctor); err != nil {
 		logrus.Error("SAdmin.CreateDoctor.Create.", err)
 		return err
 	}
@@ -115,9 +240,122 @@ func (s *Admin) CreateDoctor(ctx context.Context, doctorId string, payload entit
 	return nil
 }
 
+func (s *Admin) UpdateDoctor(ctx context.Context, doctorId string, payload entity.TUpdateDoctorReq) error {
+	if payload == (entity.TUpdateDoctorReq{}) {
+		return ErrNothingToUpdate
+	}
+
+	doctorRepo := s.repos.Doctor(ctx)
+
+	var current entity.TDoctor
+	if err := doctorRepo.Read(doctorId, &current); err != nil {
+		logrus.Error("SAdmin.UpdateDoctor.Read.", err)
+		return err
+	}
+
+	// Keep doctor names unique when the name changes
+	if payload.FirstName != nil || payload.LastName != nil {
+		firstName, lastName := current.FirstName, current.LastName
+		if payload.FirstName != nil {
+			firstName = *payload.FirstName
+		}
+		if payload.LastName != nil {
+			lastName = *payload.LastName
+		}
+
+		if firstName != current.FirstName || lastName != current.LastName {
+			isExists, err := doctorRepo.CheckDoctorByName(firstName, lastName)
+			if err != nil {
+				return err
+			}
+			if isExists {
+				return ErrDoctorExists
+			}
+		}
+	}
+
+	doctor := entity.TUpdateDoctor{
+		FirstName:     payload.FirstName,
+		LastName:      payload.LastName,
+		Specialty:     payload.Specialty,
+		Department:    payload.Department,
+		LicenseNumber: payload.LicenseNumber,
+		Phone:         payload.Phone,
+		Bio:           payload.Bio,
+		IsActive:      payload.IsActive,
+	}
+
+	// The search words follow the names and specialty
+	if payload.FirstName != nil || payload.LastName != nil || payload.Specialty != nil {
+		updated := current
+		if payload.FirstName != nil {
+			updated.FirstName = *payload.FirstName
+		}
+		if payload.LastName != nil {
+			updated.LastName = *payload.LastName
+		}
+		if payload.Specialty != nil {
+			updated.Specialty = *payload.Specialty
+		}
+		searchWords := updated.ComputeSearchWords()
+		doctor.SearchWords = &searchWords
+	}
+
+	if err := doctorRepo.Update(doctorId, doctor); err != nil {
+		logrus.Error("SAdmin.UpdateDoctor.Update.", err)
+		return err
+	}
+
+	return nil
+}
+
+var (
+	ErrDoctorHasAccount      = entity.NewConflictError("doctor is linked to an account, remove the link first")
+	ErrDoctorHasAppointments = entity.NewConflictError("doctor has booked appointments, deactivate it instead")
+)
+
+// DeleteDoctor removes a doctor nobody depends on: no account may be linked to it and none of its
+// appointments may hold a patient or a waitlist. The empty appointments, the working schedule and the
+// queues go with it in the same transaction. The doctor lock keeps appointments from being opened
+// meanwhile, a booking racing the delete makes the transaction conflict and run again.
 func (s *Admin) DeleteDoctor(ctx context.Context, doctorId string) error {
-	if err := repository.NewDoctorRepo(ctx, s.mongoClient).Delete(doctorId); err != nil {
-		logrus.Error("SAdmin.CreateDoctor.Create.", err)
+	err := NewAppointmentService(s.mongoClient, s.repos).inTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repos.Doctor(ctx).LockAppointments(doctorId); err != nil {
+			return err
+		}
+
+		isLinked, err := s.repos.Account(ctx).CheckAccountByDoctor(doctorId)
+		if err != nil {
+			return err
+		}
+		if isLinked {
+			return ErrDoctorHasAccount
+		}
+
+		var appointments []entity.TAppointment
+		if err := s.repos.Appointment(ctx).ReadManyByDoctor(doctorId, &appointments); err != nil {
+			return err
+		}
+		for _, appointment := range appointments {
+			if len(appointment.PatientAccountIDs) > 0 || len(appointment.Waitlist) > 0 {
+				return ErrDoctorHasAppointments
+			}
+		}
+
+		if err := s.repos.Appointment(ctx).DeleteManyByDoctor(doctorId); err != nil {
+			return err
+		}
+		if err := s.repos.Schedule(ctx).DeleteByDoctor(doctorId); err != nil {
+			return err
+		}
+		if err := s.repos.Queue(ctx).DeleteManyByDoctor(doctorId); err != nil {
+			return err
+		}
+
+		return s.repos.Doctor(ctx).Delete(doctorId)
+	})
+	if err != nil {
+		logrus.Error("SAdmin.DeleteDoctor.inTransaction.", err)
 		return err
 	}
 
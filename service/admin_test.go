@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+)
+
+func TestCreateDoctorAccountsConcurrently(t *testing.T) {
+	const callers = 4
+
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	adminService := NewAdminService(nil, repos)
+
+	if err := repos.Doctor(ctx).Create(entity.TDoctor{DoctorID: "doctor", IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- adminService.CreateAccount(ctx, fmt.Sprintf("account-%d", i), entity.TCreateAccountReq{
+				Email:    fmt.Sprintf("doctor-%d@example.com", i),
+				Username: fmt.Sprintf("doctor%d", i),
+				Password: "doctor-password",
+				Role:     entity.DOCTOR,
+				DoctorID: "doctor",
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			created++
+		case ErrDoctorLinked:
+		default:
+			t.Errorf("CreateAccount = %v", err)
+		}
+	}
+
+	if created != 1 {
+		t.Errorf("%d accounts linked to the doctor, want 1", created)
+	}
+}
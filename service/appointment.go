@@ -0,0 +1,662 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrAppointmentFull = entity.NewConflictError("appointment is full")
+	ErrWaitlistAhead   = entity.NewConflictError("the free seats go to the waitlist first, join it instead")
+	ErrDoctorInactive  = entity.NewConflictError("doctor is not taking appointments")
+	ErrAlreadyBooked   = entity.NewConflictError("already booked")
+	ErrNotBooked       = entity.NewConflictError("not booked")
+
+	ErrInvalidStatus           = entity.NewValidationError("unknown status")
+	ErrInvalidStatusTransition = entity.NewConflictError("status can't move there from the current status")
+
+	ErrAppointmentNotFull = entity.NewConflictError("appointment has free seats, book it instead")
+	ErrAlreadyWaitlisted  = entity.NewConflictError("already on the waitlist")
+	ErrNotWaitlisted      = entity.NewNotFoundError("not on the waitlist")
+
+	ErrUseReschedule        = entity.NewValidationError("use reschedule to move a booking")
+	ErrInvalidReschedule    = entity.NewValidationError("reschedule needs to_appointment_id, or doctor_id and start_at of a slot")
+	ErrSameAppointment      = entity.NewValidationError("booking is already on that appointment")
+	ErrRescheduleNoticeOver = entity.NewConflictError("too close to the appointment to reschedule")
+)
+
+// transactionTryCount is how often a failed commit or abort is retried, and how often a transaction
+// losing a write conflict runs, transactionRetryDelay longer each time
+const (
+	transactionTryCount   = 3
+	transactionRetryDelay = 20 * time.Millisecond
+)
+
+// maxPromoteAttempts bounds the retries of a promotion racing other bookings on the same appointment
+const maxPromoteAttempts = 5
+
+// statusTransitions is the visit state machine, the statuses each status may move to.
+// Booking is the only way into REQUESTED, Reschedule the only way into RESCHEDULED, and the last four
+// statuses are final.
+var statusTransitions = map[entity.TAppointmentStatus][]entity.TAppointmentStatus{
+	entity.REQUESTED:   {entity.CONFIRMED, entity.CANCELLED, entity.RESCHEDULED},
+	entity.CONFIRMED:   {entity.CHECKED_IN, entity.NO_SHOW, entity.CANCELLED, entity.RESCHEDULED},
+	entity.CHECKED_IN:  {entity.IN_PROGRESS, entity.CANCELLED},
+	entity.IN_PROGRESS: {entity.COMPLETED},
+	entity.COMPLETED:   {},
+	entity.CANCELLED:   {},
+	entity.NO_SHOW:     {},
+	entity.RESCHEDULED: {},
+}
+
+// statusesBefore lists the statuses that may move to status
+func statusesBefore(status entity.TAppointmentStatus) []entity.TAppointmentStatus {
+	var from []entity.TAppointmentStatus
+	for current, next := range statusTransitions {
+		for _, item := range next {
+			if item == status {
+				from = append(from, current)
+			}
+		}
+	}
+
+	return from
+}
+
+func NewAppointmentService(client *mongo.Client, repos repository.Repositories) *Appointment {
+	return &Appointment{mongoClient: client, repos: repos, mailer: NewMailer()}
+}
+
+type Appointment struct {
+	mongoClient *mongo.Client
+	repos       repository.Repositories
+	mailer      Mailer
+}
+
+func (s *Appointment) CreateAppointment(ctx context.Context, appointmentId string, payload entity.TCreateAppointmentReq) error {
+	// Make sure the doctor exists before opening a session for them
+	if err := s.repos.Doctor(ctx).Read(payload.DoctorID, &entity.TDoctor{}); err != nil {
+		logrus.Error("SAppointment.CreateAppointment.ReadDoctor.", err)
+		return err
+	}
+
+	if (payload.StartAt == nil) != (payload.EndAt == nil) {
+		return ErrInvalidAppointmentTime
+	}
+	if payload.StartAt != nil && !payload.StartAt.Before(*payload.EndAt) {
+		return ErrInvalidAppointmentTime
+	}
+
+	appointment := entity.TAppointment{
+		AppointmentID:     appointmentId,
+		DoctorID:          payload.DoctorID,
+		PatientAccountIDs: []string{},
+		Description:       payload.Description,
+		MaxAppointment:    payload.MaxAppointment,
+		StartAt:           payload.StartAt,
+		EndAt:             payload.EndAt,
+	}
+
+	// A timed appointment must not overlap another one of the doctor. The doctor lock keeps a concurrent
+	// create from inserting between the check and the insert.
+	err := s.inTransaction(ctx, func(ctx context.Context) error {
+		if payload.StartAt != nil {
+			if err := s.repos.Doctor(ctx).LockAppointments(payload.DoctorID); err != nil {
+				logrus.Error("SAppointment.CreateAppointment.LockAppointments.", err)
+				return err
+			}
+
+			isOverlapping, err := s.repos.Appointment(ctx).CheckOverlap(payload.DoctorID, *payload.StartAt, *payload.EndAt)
+			if err != nil {
+				logrus.Error("SAppointment.CreateAppointment.CheckOverlap.", err)
+				return err
+			}
+			if isOverlapping {
+				return ErrAppointmentOverlaps
+			}
+		}
+
+		return s.repos.Appointment(ctx).Create(appointment)
+	})
+	if err != nil {
+		logrus.Error("SAppointment.CreateAppointment.Create.", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Appointment) GetAppointment(ctx context.Context, appointmentId string, result *entity.TAppointment) error {
+	if err := s.repos.Appointment(ctx).Read(appointmentId, result); err != nil {
+		logrus.Error("SAppointment.GetAppointment.Read.", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Appointment) GetManyAppointment(ctx context.Context, filter entity.TGetManyAppointmentReq, result *[]entity.TAppointment) (entity.TListPage, error) {
+	page, err := s.repos.Appointment(ctx).ReadManyByFilter(filter, result)
+	if err != nil {
+		logrus.Error("SAppointment.GetManyAppointment.ReadManyByFilter.", err)
+		return entity.TListPage{}, err
+	}
+
+	return page, nil
+}
+
+func (s *Appointment) GetManyAppointmentByPatient(ctx context.Context, accountId string, result *[]entity.TAppointment) error {
+	if err := s.repos.Appointment(ctx).ReadManyByPatient(accountId, result); err != nil {
+		logrus.Error("SAppointment.GetManyAppointmentByPatient.ReadManyByPatient.", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Appointment) DeleteAppointment(ctx context.Context, appointmentId string) error {
+	if err := s.repos.Appointment(ctx).Delete(appointmentId); err != nil {
+		logrus.Error("SAppointment.DeleteAppointment.Delete.", err)
+		return err
+	}
+
+	return nil
+}
+
+// Book adds accountId to the appointment as REQUESTED, changedBy is the account making the booking
+func (s *Appointment) Book(ctx context.Context, appointmentId, accountId, changedBy string) error {
+	appointmentRepo := s.repos.Appointment(ctx)
+
+	var current entity.TAppointment
+	if err := appointmentRepo.Read(appointmentId, &current); err != nil {
+		logrus.Error("SAppointment.Book.ReadCurrent.", err)
+		return err
+	}
+
+	if err := s.checkDoctorActive(ctx, current.DoctorID); err != nil {
+		return err
+	}
+
+	isBooked, err := appointmentRepo.AddPatient(appointmentId, entity.TStatusChange{
+		AccountID: accountId,
+		ToStatus:  entity.REQUESTED,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now(),
+	})
+	if err != nil {
+		logrus.Error("SAppointment.Book.AddPatient.", err)
+		return err
+	}
+
+	if isBooked {
+		return nil
+	}
+
+	// The conditional update did not match, read the appointment to tell the caller why
+	var appointment entity.TAppointment
+	if err := appointmentRepo.Read(appointmentId, &appointment); err != nil {
+		logrus.Error("SAppointment.Book.Read.", err)
+		return err
+	}
+
+	if containsString(appointment.PatientAccountIDs, accountId) {
+		return ErrAlreadyBooked
+	}
+	if len(appointment.PatientAccountIDs) < int(appointment.MaxAppointment) {
+		return ErrWaitlistAhead
+	}
+
+	return ErrAppointmentFull
+}
+
+func (s *Appointment) Cancel(ctx context.Context, appointmentId, accountId, changedBy string) error {
+	return s.UpdateStatus(ctx, appointmentId, accountId, changedBy, entity.TUpdateStatusReq{Status: entity.CANCELLED})
+}
+
+// UpdateStatus moves a booked patient along the visit state machine and records who did it.
+// Cancelling releases the seat of the patient, it goes to the head of the waitlist in the same transaction.
+func (s *Appointment) UpdateStatus(ctx context.Context, appointmentId, accountId, changedBy string, payload entity.TUpdateStatusReq) error {
+	if _, isKnown := statusTransitions[payload.Status]; !isKnown {
+		return ErrInvalidStatus
+	}
+
+	// Moving away needs the target appointment, only Reschedule knows it
+	if payload.Status == entity.RESCHEDULED {
+		return ErrUseReschedule
+	}
+
+	from := statusesBefore(payload.Status)
+	if len(from) == 0 {
+		return ErrInvalidStatusTransition
+	}
+
+	appointmentRepo := s.repos.Appointment(ctx)
+
+	var appointment entity.TAppointment
+	if err := appointmentRepo.Read(appointmentId, &appointment); err != nil {
+		logrus.Error("SAppointment.UpdateStatus.Read.", err)
+		return err
+	}
+
+	if !containsString(appointment.PatientAccountIDs, accountId) {
+		return ErrNotBooked
+	}
+
+	change := entity.TStatusChange{
+		AccountID:  accountId,
+		FromStatus: appointment.StatusOf(accountId),
+		ToStatus:   payload.Status,
+		ChangedBy:  changedBy,
+		ChangedAt:  time.Now(),
+		Note:       payload.Note,
+	}
+	if !containsStatus(from, change.FromStatus) {
+		return ErrInvalidStatusTransition
+	}
+
+	// The update only applies from the status just read, a concurrent change makes it miss
+	if payload.Status != entity.CANCELLED {
+		isUpdated, err := appointmentRepo.UpdatePatientStatus(appointmentId, []entity.TAppointmentStatus{change.FromStatus}, change)
+		if err != nil {
+			logrus.Error("SAppointment.UpdateStatus.UpdatePatientStatus.", err)
+			return err
+		}
+		if !isUpdated {
+			return ErrInvalidStatusTransition
+		}
+
+		return nil
+	}
+
+	var promoted entity.TAppointment
+	var promotedIds []string
+	err := s.inTransaction(ctx, func(ctx context.Context) error {
+		isRemoved, err := s.repos.Appointment(ctx).RemovePatient(appointmentId, []entity.TAppointmentStatus{change.FromStatus}, change)
+		if err != nil {
+			return err
+		}
+		if !isRemoved {
+			return ErrInvalidStatusTransition
+		}
+
+		promoted, promotedIds, err = s.promoteWaitlist(ctx, appointmentId, changedBy)
+		return err
+	})
+	if err != nil {
+		logrus.Error("SAppointment.UpdateStatus.inTransaction.", err)
+		return err
+	}
+
+	s.notifyPromotions(ctx, promoted, promotedIds)
+
+	return nil
+}
+
+// Reschedule moves the booking of accountId to another appointment in one transaction, keeping its status.
+// The original stays booked when the target is full. Timed bookings can't be moved within the
+// schedule.reschedule_notice of their start, nor onto an appointment starting within it.
+func (s *Appointment) Reschedule(ctx context.Context, fromAppointmentId, toAppointmentId, accountId, changedBy, note string) error {
+	if fromAppointmentId == toAppointmentId {
+		return ErrSameAppointment
+	}
+
+	appointmentRepo := s.repos.Appointment(ctx)
+
+	var from, to entity.TAppointment
+	if err := appointmentRepo.Read(fromAppointmentId, &from); err != nil {
+		logrus.Error("SAppointment.Reschedule.ReadFrom.", err)
+		return err
+	}
+	if err := appointmentRepo.Read(toAppointmentId, &to); err != nil {
+		logrus.Error("SAppointment.Reschedule.ReadTo.", err)
+		return err
+	}
+
+	if !containsString(from.PatientAccountIDs, accountId) {
+		return ErrNotBooked
+	}
+
+	if err := s.checkDoctorActive(ctx, to.DoctorID); err != nil {
+		return err
+	}
+
+	status := from.StatusOf(accountId)
+	if !containsStatus(statusesBefore(entity.RESCHEDULED), status) {
+		return ErrInvalidStatusTransition
+	}
+
+	deadline := time.Now().Add(time.Duration(config.CONFIG.Schedule.RescheduleNotice) * time.Second)
+	if (from.StartAt != nil && from.StartAt.Before(deadline)) || (to.StartAt != nil && to.StartAt.Before(deadline)) {
+		return ErrRescheduleNoticeOver
+	}
+
+	// Checked again by the guarded updates, these only give the usual errors without a transaction
+	if containsString(to.PatientAccountIDs, accountId) {
+		return ErrAlreadyBooked
+	}
+	if len(to.PatientAccountIDs) >= int(to.MaxAppointment) {
+		return ErrAppointmentFull
+	}
+	if len(to.Waitlist) > 0 && to.Waitlist[0].AccountID != accountId {
+		return ErrWaitlistAhead
+	}
+
+	// The patient joins the target before leaving the original, so without a transaction a full target
+	// still leaves them booked where they were. The seat left behind goes to the waitlist of the original
+	// in the same transaction.
+	var promoted entity.TAppointment
+	var promotedIds []string
+	now := time.Now()
+	err := s.inTransaction(ctx, func(ctx context.Context) error {
+		txAppointmentRepo := s.repos.Appointment(ctx)
+
+		isBooked, err := txAppointmentRepo.AddPatient(toAppointmentId, entity.TStatusChange{
+			AccountID:            accountId,
+			ToStatus:             status,
+			ChangedBy:            changedBy,
+			ChangedAt:            now,
+			Note:                 note,
+			RelatedAppointmentID: fromAppointmentId,
+		})
+		if err != nil {
+			return err
+		}
+		if !isBooked {
+			return ErrAppointmentFull
+		}
+
+		isMoved, err := txAppointmentRepo.RemovePatient(fromAppointmentId, []entity.TAppointmentStatus{status}, entity.TStatusChange{
+			AccountID:            accountId,
+			FromStatus:           status,
+			ToStatus:             entity.RESCHEDULED,
+			ChangedBy:            changedBy,
+			ChangedAt:            now,
+			Note:                 note,
+			RelatedAppointmentID: toAppointmentId,
+		})
+		if err != nil {
+			return err
+		}
+		if !isMoved {
+			// The booking changed meanwhile. A transaction rolls the target back, without one it is
+			// taken back by hand.
+			if s.mongoClient == nil {
+				s.undoReschedule(ctx, toAppointmentId, accountId, status, changedBy, fromAppointmentId)
+			}
+			return ErrInvalidStatusTransition
+		}
+
+		promoted, promotedIds, err = s.promoteWaitlist(ctx, fromAppointmentId, changedBy)
+		return err
+	})
+	if err != nil {
+		logrus.Error("SAppointment.Reschedule.inTransaction.", err)
+		return err
+	}
+
+	s.notifyPromotions(ctx, promoted, promotedIds)
+
+	return nil
+}
+
+// undoReschedule takes accountId off the target of a reschedule that could not leave its original,
+// failures are only logged
+func (s *Appointment) undoReschedule(ctx context.Context, toAppointmentId, accountId string, status entity.TAppointmentStatus, changedBy, fromAppointmentId string) {
+	_, err := s.repos.Appointment(ctx).RemovePatient(toAppointmentId, []entity.TAppointmentStatus{status}, entity.TStatusChange{
+		AccountID:            accountId,
+		FromStatus:           status,
+		ToStatus:             entity.CANCELLED,
+		ChangedBy:            changedBy,
+		ChangedAt:            time.Now(),
+		Note:                 "reschedule rolled back",
+		RelatedAppointmentID: fromAppointmentId,
+	})
+	if err != nil {
+		logrus.Error("SAppointment.undoReschedule.RemovePatient.", err)
+	}
+}
+
+// inTransaction runs fn in a Mongo transaction, fn must use the ctx it is given. A transaction that lost
+// a write conflict runs again and then sees what the winner committed. The memory repositories come
+// without a client and have no transactions, fn runs as is there.
+func (s *Appointment) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.mongoClient == nil {
+		return fn(ctx)
+	}
+
+	var err error
+	for attempt := 1; attempt <= transactionTryCount; attempt++ {
+		err = helper.UseMongoTransaction(ctx, s.mongoClient, func(sc *mongo.SessionContext) error {
+			return fn(*sc)
+		}, transactionTryCount)
+		if !isTransientTransactionError(err) {
+			return err
+		}
+
+		time.Sleep(time.Duration(attempt) * transactionRetryDelay)
+	}
+
+	return err
+}
+
+func isTransientTransactionError(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorLabel("TransientTransactionError")
+}
+
+// JoinWaitlist queues accountId on a full appointment
+func (s *Appointment) JoinWaitlist(ctx context.Context, appointmentId, accountId string) error {
+	appointmentRepo := s.repos.Appointment(ctx)
+
+	var current entity.TAppointment
+	if err := appointmentRepo.Read(appointmentId, &current); err != nil {
+		logrus.Error("SAppointment.JoinWaitlist.ReadCurrent.", err)
+		return err
+	}
+
+	if err := s.checkDoctorActive(ctx, current.DoctorID); err != nil {
+		return err
+	}
+
+	isAdded, err := appointmentRepo.AddToWaitlist(appointmentId, entity.TWaitlistEntry{AccountID: accountId, JoinedAt: time.Now()})
+	if err != nil {
+		logrus.Error("SAppointment.JoinWaitlist.AddToWaitlist.", err)
+		return err
+	}
+
+	if isAdded {
+		return nil
+	}
+
+	// The conditional update did not match, read the appointment to tell the caller why
+	var appointment entity.TAppointment
+	if err := appointmentRepo.Read(appointmentId, &appointment); err != nil {
+		logrus.Error("SAppointment.JoinWaitlist.Read.", err)
+		return err
+	}
+
+	if containsString(appointment.PatientAccountIDs, accountId) {
+		return ErrAlreadyBooked
+	}
+	if appointment.WaitlistPosition(accountId) > 0 {
+		return ErrAlreadyWaitlisted
+	}
+
+	return ErrAppointmentNotFull
+}
+
+func (s *Appointment) LeaveWaitlist(ctx context.Context, appointmentId, accountId string) error {
+	appointmentRepo := s.repos.Appointment(ctx)
+
+	isRemoved, err := appointmentRepo.RemoveFromWaitlist(appointmentId, accountId)
+	if err != nil {
+		logrus.Error("SAppointment.LeaveWaitlist.RemoveFromWaitlist.", err)
+		return err
+	}
+
+	if isRemoved {
+		return nil
+	}
+
+	if err := appointmentRepo.Read(appointmentId, &entity.TAppointment{}); err != nil {
+		logrus.Error("SAppointment.LeaveWaitlist.Read.", err)
+		return err
+	}
+
+	return ErrNotWaitlisted
+}
+
+func (s *Appointment) GetWaitlistPosition(ctx context.Context, appointmentId, accountId string) (entity.TWaitlistRes, error) {
+	var appointment entity.TAppointment
+	if err := s.repos.Appointment(ctx).Read(appointmentId, &appointment); err != nil {
+		logrus.Error("SAppointment.GetWaitlistPosition.Read.", err)
+		return entity.TWaitlistRes{}, err
+	}
+
+	position := appointment.WaitlistPosition(accountId)
+	if position == 0 {
+		return entity.TWaitlistRes{}, ErrNotWaitlisted
+	}
+
+	return entity.TWaitlistRes{Position: position, Length: len(appointment.Waitlist)}, nil
+}
+
+// promoteWaitlist books the head of the waitlist while the appointment has free seats. It runs in the
+// transaction that released the seat and must use its ctx. It returns the appointment as last read and the
+// promoted account ids, to notify once the transaction committed.
+func (s *Appointment) promoteWaitlist(ctx context.Context, appointmentId, changedBy string) (entity.TAppointment, []string, error) {
+	appointmentRepo := s.repos.Appointment(ctx)
+
+	var appointment entity.TAppointment
+	var promotedIds []string
+	for attempt := 0; attempt < maxPromoteAttempts; attempt++ {
+		appointment = entity.TAppointment{}
+		if err := appointmentRepo.Read(appointmentId, &appointment); err != nil {
+			logrus.Error("SAppointment.promoteWaitlist.Read.", err)
+			return appointment, nil, err
+		}
+
+		if len(appointment.Waitlist) == 0 || len(appointment.PatientAccountIDs) >= int(appointment.MaxAppointment) {
+			break
+		}
+
+		// Left over from a booking made while waiting, drop it and look at the next one
+		head := appointment.Waitlist[0].AccountID
+		if containsString(appointment.PatientAccountIDs, head) {
+			if _, err := appointmentRepo.RemoveFromWaitlist(appointmentId, head); err != nil {
+				logrus.Error("SAppointment.promoteWaitlist.RemoveFromWaitlist.", err)
+				return appointment, nil, err
+			}
+			continue
+		}
+
+		isPromoted, err := appointmentRepo.PromoteWaitlisted(appointmentId, entity.TStatusChange{
+			AccountID: head,
+			ToStatus:  entity.REQUESTED,
+			ChangedBy: changedBy,
+			ChangedAt: time.Now(),
+			Note:      "promoted from the waitlist",
+		})
+		if err != nil {
+			logrus.Error("SAppointment.promoteWaitlist.PromoteWaitlisted.", err)
+			return appointment, nil, err
+		}
+
+		if isPromoted {
+			promotedIds = append(promotedIds, head)
+		}
+	}
+
+	return appointment, promotedIds, nil
+}
+
+// notifyPromotions mails the patients promoted onto appointment, failures are only logged
+func (s *Appointment) notifyPromotions(ctx context.Context, appointment entity.TAppointment, accountIds []string) {
+	for _, accountId := range accountIds {
+		s.notifyPromotion(ctx, appointment, accountId)
+	}
+}
+
+func (s *Appointment) notifyPromotion(ctx context.Context, appointment entity.TAppointment, accountId string) {
+	var account entity.TAccount
+	if err := s.repos.Account(ctx).Read(accountId, &account); err != nil {
+		logrus.Error("SAppointment.notifyPromotion.Read.", err)
+		return
+	}
+
+	when := ""
+	if appointment.StartAt != nil {
+		startAt := *appointment.StartAt
+		if location, err := ClinicLocation(); err == nil {
+			startAt = startAt.In(location)
+		}
+		when = " on " + startAt.Format("Mon, 02 Jan 2006 15:04 MST")
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nA seat opened up and you have been moved from the waitlist onto appointment %s%s.\n\nCancel it if you can no longer come, so the next patient can have it.\n",
+		account.FirstName, appointment.AppointmentID, when)
+
+	if err := s.mailer.Send(ctx, account.Email, "You got a seat on your appointment", body); err != nil {
+		logrus.Error("SAppointment.notifyPromotion.Send.", err)
+	}
+}
+
+// checkDoctorActive refuses new bookings with a deactivated doctor
+func (s *Appointment) checkDoctorActive(ctx context.Context, doctorId string) error {
+	var doctor entity.TDoctor
+	if err := s.repos.Doctor(ctx).Read(doctorId, &doctor); err != nil {
+		logrus.Error("SAppointment.checkDoctorActive.Read.", err)
+		return err
+	}
+
+	if !doctor.IsActive {
+		return ErrDoctorInactive
+	}
+
+	return nil
+}
+
+// ToPatientView strips other patients' account ids from an appointment
+func (s *Appointment) ToPatientView(appointment entity.TAppointment, accountId string) entity.TAppointmentRes {
+	return entity.TAppointmentRes{
+		AppointmentID:    appointment.AppointmentID,
+		DoctorID:         appointment.DoctorID,
+		Description:      appointment.Description,
+		MaxAppointment:   appointment.MaxAppointment,
+		StartAt:          appointment.StartAt,
+		EndAt:            appointment.EndAt,
+		BookedCount:      len(appointment.PatientAccountIDs),
+		IsBooked:         containsString(appointment.PatientAccountIDs, accountId),
+		Status:           appointment.StatusOf(accountId),
+		WaitlistPosition: appointment.WaitlistPosition(accountId),
+	}
+}
+
+func containsString(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsStatus(list []entity.TAppointmentStatus, target entity.TAppointmentStatus) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+
+	return false
+}
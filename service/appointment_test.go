@@ -0,0 +1,451 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBookConcurrentLastSeats(t *testing.T) {
+	const (
+		capacity = 5
+		booked   = 3
+		callers  = 50
+	)
+
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	appointmentService := &Appointment{repos: repos}
+
+	if err := repos.Doctor(ctx).Create(entity.TDoctor{DoctorID: "doctor", IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Appointment(ctx).Create(entity.TAppointment{
+		AppointmentID:  "appointment",
+		DoctorID:       "doctor",
+		MaxAppointment: capacity,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < booked; i++ {
+		accountId := fmt.Sprintf("booked-%d", i)
+		if err := appointmentService.Book(ctx, "appointment", accountId, accountId); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The watcher reads while the bookings race, no read may ever see more patients than seats
+	done := make(chan struct{})
+	watcherErr := make(chan error, 1)
+	go func() {
+		defer close(watcherErr)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			var appointment entity.TAppointment
+			if err := repos.Appointment(ctx).Read("appointment", &appointment); err != nil {
+				watcherErr <- err
+				return
+			}
+			if len(appointment.PatientAccountIDs) > capacity {
+				watcherErr <- fmt.Errorf("%d patients booked on %d seats", len(appointment.PatientAccountIDs), capacity)
+				return
+			}
+		}
+	}()
+
+	var (
+		wg        sync.WaitGroup
+		start     = make(chan struct{})
+		successes int32
+		fulls     int32
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(accountId string) {
+			defer wg.Done()
+			<-start
+
+			switch err := appointmentService.Book(ctx, "appointment", accountId, accountId); err {
+			case nil:
+				atomic.AddInt32(&successes, 1)
+			case ErrAppointmentFull:
+				atomic.AddInt32(&fulls, 1)
+			default:
+				t.Errorf("Book(%s) = %v", accountId, err)
+			}
+		}(fmt.Sprintf("caller-%d", i))
+	}
+	close(start)
+	wg.Wait()
+	close(done)
+
+	if err := <-watcherErr; err != nil {
+		t.Fatal(err)
+	}
+
+	if successes != capacity-booked {
+		t.Errorf("%d bookings succeeded, want %d", successes, capacity-booked)
+	}
+	if fulls != callers-(capacity-booked) {
+		t.Errorf("%d bookings were refused as full, want %d", fulls, callers-(capacity-booked))
+	}
+
+	var appointment entity.TAppointment
+	if err := repos.Appointment(ctx).Read("appointment", &appointment); err != nil {
+		t.Fatal(err)
+	}
+	if len(appointment.PatientAccountIDs) != capacity {
+		t.Errorf("%d patients booked, want %d", len(appointment.PatientAccountIDs), capacity)
+	}
+	for _, accountId := range appointment.PatientAccountIDs {
+		if appointment.StatusOf(accountId) != entity.REQUESTED {
+			t.Errorf("patient %s is %s, want %s", accountId, appointment.StatusOf(accountId), entity.REQUESTED)
+		}
+	}
+}
+
+func TestCancelPromotesWaitlistBeforeBookings(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	appointmentService := &Appointment{repos: repos, mailer: NewMailer()}
+
+	if err := repos.Doctor(ctx).Create(entity.TDoctor{DoctorID: "doctor", IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Appointment(ctx).Create(entity.TAppointment{
+		AppointmentID:  "appointment",
+		DoctorID:       "doctor",
+		MaxAppointment: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appointmentService.Book(ctx, "appointment", "booked", "booked"); err != nil {
+		t.Fatal(err)
+	}
+	for _, accountId := range []string{"first", "second"} {
+		if err := appointmentService.JoinWaitlist(ctx, "appointment", accountId); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := appointmentService.Cancel(ctx, "appointment", "booked", "booked"); err != nil {
+		t.Fatal(err)
+	}
+
+	var appointment entity.TAppointment
+	if err := repos.Appointment(ctx).Read("appointment", &appointment); err != nil {
+		t.Fatal(err)
+	}
+	if len(appointment.PatientAccountIDs) != 1 || appointment.PatientAccountIDs[0] != "first" {
+		t.Fatalf("booked %v, want the head of the waitlist", appointment.PatientAccountIDs)
+	}
+	if appointment.WaitlistPosition("second") != 1 {
+		t.Errorf("second is at %d on the waitlist, want 1", appointment.WaitlistPosition("second"))
+	}
+
+	// A seat added while patients wait is theirs, not a newcomer's
+	maxAppointment := uint8(2)
+	if err := repos.Appointment(ctx).Update("appointment", entity.TUpdateAppointment{MaxAppointment: &maxAppointment}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appointmentService.Book(ctx, "appointment", "newcomer", "newcomer"); err != ErrWaitlistAhead {
+		t.Errorf("Book past the waitlist = %v, want %v", err, ErrWaitlistAhead)
+	}
+	if err := appointmentService.Book(ctx, "appointment", "second", "second"); err != nil {
+		t.Errorf("Book by the head of the waitlist = %v", err)
+	}
+}
+
+// racingRepositories runs the hook of a repository method once right before it, like a concurrent request
+// landing between the reads of a service and its writes
+type racingRepositories struct {
+	*repository.MemoryRepositories
+	before map[string]func()
+}
+
+func (r *racingRepositories) Appointment(ctx context.Context) repository.AppointmentRepository {
+	return &racingAppointmentRepo{AppointmentRepository: r.MemoryRepositories.Appointment(ctx), repos: r}
+}
+
+func (r *racingRepositories) race(method string) {
+	if hook, isExists := r.before[method]; isExists {
+		delete(r.before, method)
+		hook()
+	}
+}
+
+type racingAppointmentRepo struct {
+	repository.AppointmentRepository
+	repos *racingRepositories
+}
+
+func (r *racingAppointmentRepo) AddPatient(appointmentId string, change entity.TStatusChange) (bool, error) {
+	r.repos.race("AddPatient")
+	return r.AppointmentRepository.AddPatient(appointmentId, change)
+}
+
+func (r *racingAppointmentRepo) RemovePatient(appointmentId string, from []entity.TAppointmentStatus, change entity.TStatusChange) (bool, error) {
+	r.repos.race("RemovePatient")
+	return r.AppointmentRepository.RemovePatient(appointmentId, from, change)
+}
+
+func TestRescheduleWithoutTransactionKeepsOriginal(t *testing.T) {
+	tests := []struct {
+		name         string
+		race         string
+		wantErr      error
+		wantOriginal bool
+	}{
+		{name: "target filled meanwhile", race: "AddPatient", wantErr: ErrAppointmentFull, wantOriginal: true},
+		{name: "original cancelled meanwhile", race: "RemovePatient", wantErr: ErrInvalidStatusTransition, wantOriginal: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			memory := repository.NewMemoryRepositories()
+			repos := &racingRepositories{MemoryRepositories: memory, before: map[string]func(){}}
+			appointmentService := &Appointment{repos: repos, mailer: NewMailer()}
+
+			if err := memory.Doctor(ctx).Create(entity.TDoctor{DoctorID: "doctor", IsActive: true}); err != nil {
+				t.Fatal(err)
+			}
+			for _, appointmentId := range []string{"original", "target"} {
+				if err := memory.Appointment(ctx).Create(entity.TAppointment{AppointmentID: appointmentId, DoctorID: "doctor", MaxAppointment: 1}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := appointmentService.Book(ctx, "original", "patient", "patient"); err != nil {
+				t.Fatal(err)
+			}
+
+			otherService := &Appointment{repos: memory, mailer: NewMailer()}
+			repos.before = map[string]func(){test.race: func() {
+				var err error
+				if test.race == "AddPatient" {
+					err = otherService.Book(ctx, "target", "other", "other")
+				} else {
+					err = otherService.Cancel(ctx, "original", "patient", "patient")
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}}
+
+			if err := appointmentService.Reschedule(ctx, "original", "target", "patient", "patient", ""); err != test.wantErr {
+				t.Fatalf("Reschedule = %v, want %v", err, test.wantErr)
+			}
+
+			var original, target entity.TAppointment
+			if err := memory.Appointment(ctx).Read("original", &original); err != nil {
+				t.Fatal(err)
+			}
+			if err := memory.Appointment(ctx).Read("target", &target); err != nil {
+				t.Fatal(err)
+			}
+
+			if isBooked := containsString(original.PatientAccountIDs, "patient"); isBooked != test.wantOriginal {
+				t.Errorf("booked on the original = %t, want %t", isBooked, test.wantOriginal)
+			}
+			if test.wantOriginal && original.StatusOf("patient") != entity.REQUESTED {
+				t.Errorf("original status %s, want %s", original.StatusOf("patient"), entity.REQUESTED)
+			}
+			if containsString(target.PatientAccountIDs, "patient") {
+				t.Errorf("patient is still booked on the target %v", target.PatientAccountIDs)
+			}
+		})
+	}
+}
+
+func TestGetManyAppointmentPages(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	appointmentService := &Appointment{repos: repos}
+
+	for i, maxAppointment := range []uint8{3, 1, 5, 2, 4} {
+		if err := repos.Appointment(ctx).Create(entity.TAppointment{
+			AppointmentID:  fmt.Sprintf("appointment-%d", i),
+			DoctorID:       "doctor",
+			MaxAppointment: maxAppointment,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		list    entity.TListReq
+		wantIds []string
+	}{
+		{
+			name:    "default sort",
+			list:    entity.TListReq{PageSize: 2},
+			wantIds: []string{"appointment-0", "appointment-1", "appointment-2", "appointment-3", "appointment-4"},
+		},
+		{
+			name:    "descending seats",
+			list:    entity.TListReq{PageSize: 2, SortBy: "max_appointment", SortOrder: "desc"},
+			wantIds: []string{"appointment-2", "appointment-4", "appointment-0", "appointment-3", "appointment-1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ids []string
+			filter := entity.TGetManyAppointmentReq{TListReq: test.list, DoctorID: "doctor"}
+			for {
+				var appointments []entity.TAppointment
+				page, err := appointmentService.GetManyAppointment(ctx, filter, &appointments)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page.Total != int64(len(test.wantIds)) {
+					t.Errorf("total %d, want %d", page.Total, len(test.wantIds))
+				}
+
+				for _, appointment := range appointments {
+					ids = append(ids, appointment.AppointmentID)
+				}
+				if page.NextCursor == "" || len(ids) > len(test.wantIds) {
+					break
+				}
+				filter.Cursor = page.NextCursor
+			}
+
+			if fmt.Sprint(ids) != fmt.Sprint(test.wantIds) {
+				t.Errorf("paged %v, want %v", ids, test.wantIds)
+			}
+		})
+	}
+}
+
+func TestGetManyAppointmentRejectsCursors(t *testing.T) {
+	// cursorOf encodes a cursor the way the repositories do, with any value in it
+	cursorOf := func(cursor bson.M) string {
+		b, err := bson.Marshal(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "not a cursor!"},
+		{name: "not bson", cursor: base64.RawURLEncoding.EncodeToString([]byte("tampered"))},
+		{name: "other sort", cursor: cursorOf(bson.M{"s": "start_at", "o": int64(1)})},
+		{name: "negative offset", cursor: cursorOf(bson.M{"s": "appointment_id", "o": int64(-1)})},
+		{name: "operator value", cursor: cursorOf(bson.M{"s": "appointment_id", "v": bson.M{"$gt": ""}})},
+		{name: "regex value", cursor: cursorOf(bson.M{"s": "appointment_id", "v": primitive.Regex{Pattern: ".*"}})},
+		{name: "array value", cursor: cursorOf(bson.M{"s": "appointment_id", "v": bson.A{"appointment"}})},
+	}
+
+	ctx := context.Background()
+	appointmentService := &Appointment{repos: repository.NewMemoryRepositories()}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := entity.TGetManyAppointmentReq{TListReq: entity.TListReq{Cursor: test.cursor}, DoctorID: "doctor"}
+
+			var appointments []entity.TAppointment
+			if _, err := appointmentService.GetManyAppointment(ctx, filter, &appointments); err != repository.ErrInvalidCursor {
+				t.Errorf("GetManyAppointment = %v, want %v", err, repository.ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusTransitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    []entity.TAppointmentStatus
+		to      entity.TAppointmentStatus
+		wantErr error
+	}{
+		{name: "requested to confirmed", to: entity.CONFIRMED},
+		{name: "requested to cancelled", to: entity.CANCELLED},
+		{name: "confirmed to checked in", path: []entity.TAppointmentStatus{entity.CONFIRMED}, to: entity.CHECKED_IN},
+		{name: "confirmed to no show", path: []entity.TAppointmentStatus{entity.CONFIRMED}, to: entity.NO_SHOW},
+		{name: "checked in to in progress", path: []entity.TAppointmentStatus{entity.CONFIRMED, entity.CHECKED_IN}, to: entity.IN_PROGRESS},
+		{name: "checked in to cancelled", path: []entity.TAppointmentStatus{entity.CONFIRMED, entity.CHECKED_IN}, to: entity.CANCELLED},
+		{name: "in progress to completed", path: []entity.TAppointmentStatus{entity.CONFIRMED, entity.CHECKED_IN, entity.IN_PROGRESS}, to: entity.COMPLETED},
+
+		{name: "requested to checked in", to: entity.CHECKED_IN, wantErr: ErrInvalidStatusTransition},
+		{name: "requested to completed", to: entity.COMPLETED, wantErr: ErrInvalidStatusTransition},
+		{name: "back to requested", path: []entity.TAppointmentStatus{entity.CONFIRMED}, to: entity.REQUESTED, wantErr: ErrInvalidStatusTransition},
+		{name: "checked in to no show", path: []entity.TAppointmentStatus{entity.CONFIRMED, entity.CHECKED_IN}, to: entity.NO_SHOW, wantErr: ErrInvalidStatusTransition},
+		{name: "in progress to cancelled", path: []entity.TAppointmentStatus{entity.CONFIRMED, entity.CHECKED_IN, entity.IN_PROGRESS}, to: entity.CANCELLED, wantErr: ErrInvalidStatusTransition},
+		{name: "completed is final", path: []entity.TAppointmentStatus{entity.CONFIRMED, entity.CHECKED_IN, entity.IN_PROGRESS, entity.COMPLETED}, to: entity.CANCELLED, wantErr: ErrInvalidStatusTransition},
+		{name: "no show is final", path: []entity.TAppointmentStatus{entity.CONFIRMED, entity.NO_SHOW}, to: entity.CONFIRMED, wantErr: ErrInvalidStatusTransition},
+		{name: "cancelled is no longer booked", path: []entity.TAppointmentStatus{entity.CANCELLED}, to: entity.CONFIRMED, wantErr: ErrNotBooked},
+		{name: "rescheduled needs reschedule", to: entity.RESCHEDULED, wantErr: ErrUseReschedule},
+		{name: "unknown status", to: entity.TAppointmentStatus("lost"), wantErr: ErrInvalidStatus},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := repository.NewMemoryRepositories()
+			appointmentService := &Appointment{repos: repos, mailer: NewMailer()}
+
+			if err := repos.Doctor(ctx).Create(entity.TDoctor{DoctorID: "doctor", IsActive: true}); err != nil {
+				t.Fatal(err)
+			}
+			if err := repos.Appointment(ctx).Create(entity.TAppointment{AppointmentID: "appointment", DoctorID: "doctor", MaxAppointment: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := appointmentService.Book(ctx, "appointment", "patient", "patient"); err != nil {
+				t.Fatal(err)
+			}
+			for _, status := range test.path {
+				if err := appointmentService.UpdateStatus(ctx, "appointment", "patient", "doctor", entity.TUpdateStatusReq{Status: status}); err != nil {
+					t.Fatalf("UpdateStatus(%s) = %v", status, err)
+				}
+			}
+
+			err := appointmentService.UpdateStatus(ctx, "appointment", "patient", "doctor", entity.TUpdateStatusReq{Status: test.to})
+			if err != test.wantErr {
+				t.Fatalf("UpdateStatus(%s) = %v, want %v", test.to, err, test.wantErr)
+			}
+
+			var appointment entity.TAppointment
+			if err := repos.Appointment(ctx).Read("appointment", &appointment); err != nil {
+				t.Fatal(err)
+			}
+			isBooked := containsString(appointment.PatientAccountIDs, "patient")
+			switch {
+			case err == nil && test.to == entity.CANCELLED:
+				if isBooked {
+					t.Errorf("the cancelled patient still holds a seat")
+				}
+			case err == nil:
+				if appointment.StatusOf("patient") != test.to {
+					t.Errorf("status %s, want %s", appointment.StatusOf("patient"), test.to)
+				}
+			case isBooked:
+				wantStatus := entity.REQUESTED
+				if len(test.path) > 0 {
+					wantStatus = test.path[len(test.path)-1]
+				}
+				if appointment.StatusOf("patient") != wantStatus {
+					t.Errorf("the refused change left status %s, want %s", appointment.StatusOf("patient"), wantStatus)
+				}
+			}
+		})
+	}
+}
@@ -9,9 +9,11 @@ import (
 
 	"github.com/agustadewa/hospital-backend/config"
 	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
 	"github.com/agustadewa/hospital-backend/repository"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -19,16 +21,31 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func NewAuthService(mongoClient *mongo.Client) *Auth {
-	return &Auth{mongoClient: mongoClient}
+func NewAuthService(mongoClient *mongo.Client, repos repository.Repositories) *Auth {
+	return &Auth{
+		mongoClient: mongoClient,
+		repos:       repos,
+		loginGuard:  NewLoginGuard(repos),
+		mailer:      NewMailer(),
+	}
 }
 
 type Auth struct {
 	mongoClient *mongo.Client
+	repos       repository.Repositories
+	loginGuard  *LoginGuard
+	mailer      Mailer
 }
 
+var (
+	ErrInvalidCredentials  = entity.NewUnauthorizedError("invalid")
+	ErrInvalidRefreshToken = entity.NewUnauthorizedError("invalid refresh token")
+	ErrRefreshTokenReused  = entity.NewUnauthorizedError("refresh token reused, session revoked")
+	ErrInvalidPurposeToken = entity.NewBadRequestError("invalid or expired token")
+)
+
 // CreateAccessToken
-func (s *Auth) CreateAccessToken(AccountID string, ExpiredAt time.Duration) (string, error) {
+func (s *Auth) CreateAccessToken(AccountID, SessionID string, ExpiredAt time.Duration) (string, error) {
 
 	expiredAt := time.Now().Add((time.Second) * ExpiredAt).Unix()
 
@@ -36,11 +53,11 @@ func (s *Auth) CreateAccessToken(AccountID string, ExpiredAt time.Duration) (str
 		"exp": expiredAt,
 		"aut": true,
 		"aid": AccountID,
+		"sid": SessionID,
 		"iat": time.Now().Unix(),
 	}
 
-	to := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	accessToken, err := to.SignedString([]byte(config.JWTSecretKey))
+	accessToken, err := keyRing.Sign(claims)
 	if err != nil {
 		logrus.Error(err.Error())
 		return accessToken, err
@@ -49,27 +66,260 @@ func (s *Auth) CreateAccessToken(AccountID string, ExpiredAt time.Duration) (str
 	return accessToken, nil
 }
 
-// MatchAndGetAccount
-func (s *Auth) MatchAndGetAccount(ctx context.Context, email, password string, result *entity.TAccount) (bool, error) {
+// CreatePurposeToken signs a token that only the endpoint of claims.Purpose accepts, it carries no session.
+// Every token gets a random jti so the single use flows can spend it.
+func (s *Auth) CreatePurposeToken(claims entity.MetaToken, ttl time.Duration) (string, error) {
+	tokenId, err := helper.GenerateRandomToken(16)
+	if err != nil {
+		logrus.Error("SAuth.CreatePurposeToken.GenerateRandomToken.", err)
+		return "", err
+	}
+
+	now := time.Now()
+	mapClaims := jwt.MapClaims{
+		"exp": now.Add(ttl).Unix(),
+		"aid": claims.AccountID,
+		"pur": claims.Purpose,
+		"jti": tokenId,
+		"iat": now.Unix(),
+	}
+	if claims.Email != "" {
+		mapClaims["eml"] = claims.Email
+	}
+
+	token, err := keyRing.Sign(mapClaims)
+	if err != nil {
+		logrus.Error("SAuth.CreatePurposeToken.Sign.", err)
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ParsePurposeToken returns the claims of a valid token issued for purpose
+func (s *Auth) ParsePurposeToken(tokenString, purpose string) (entity.MetaToken, error) {
+	token, err := jwt.Parse(strings.TrimSpace(tokenString), keyRing.Keyfunc)
+	if err != nil || !token.Valid {
+		logrus.Info("SAuth.ParsePurposeToken.Parse.", err)
+		return entity.MetaToken{}, ErrInvalidPurposeToken
+	}
+
+	decoded, err := DecodeToken(token)
+	if err != nil {
+		return entity.MetaToken{}, ErrInvalidPurposeToken
+	}
+
+	if decoded.Claims.Purpose != purpose || decoded.Claims.AccountID == "" {
+		return entity.MetaToken{}, ErrInvalidPurposeToken
+	}
+
+	return decoded.Claims, nil
+}
+
+// CreateSession starts a new refresh token family and returns its first token pair
+func (s *Auth) CreateSession(ctx context.Context, accountId string) (entity.LoginRes, error) {
+	refreshToken, err := helper.GenerateRandomToken(32)
+	if err != nil {
+		logrus.Error("SAuth.CreateSession.GenerateRandomToken.", err)
+		return entity.LoginRes{}, err
+	}
+
+	now := time.Now()
+	session := entity.TSession{
+		SessionID:        primitive.NewObjectID().Hex(),
+		AccountID:        accountId,
+		RefreshTokenHash: helper.HashToken(refreshToken),
+		UsedTokenHashes:  []string{},
+		CreatedAt:        now,
+		RefreshedAt:      now,
+		ExpiredAt:        now.Add(time.Duration(config.CONFIG.RefreshTokenTTL) * time.Second),
+	}
+	if err := s.repos.Session(ctx).Create(session); err != nil {
+		logrus.Error("SAuth.CreateSession.Create.", err)
+		return entity.LoginRes{}, err
+	}
+
+	accessToken, err := s.CreateAccessToken(accountId, session.SessionID, time.Duration(config.CONFIG.AccessTokenTTL))
+	if err != nil {
+		logrus.Error("SAuth.CreateSession.CreateAccessToken.", err)
+		return entity.LoginRes{}, err
+	}
+
+	return entity.LoginRes{
+		Authorization: accessToken,
+		RefreshToken:  refreshToken,
+		ExpiresIn:     config.CONFIG.AccessTokenTTL,
+	}, nil
+}
+
+// Refresh rotates the refresh token. A token that was already rotated away revokes its whole family,
+// because only a stolen copy would be presented twice.
+func (s *Auth) Refresh(ctx context.Context, refreshToken string) (entity.LoginRes, error) {
+	sessionRepo := s.repos.Session(ctx)
+	tokenHash := helper.HashToken(refreshToken)
+
+	var session entity.TSession
+	if err := sessionRepo.ReadByTokenHash(tokenHash, &session); err != nil {
+		if !entity.IsNotFound(err) {
+			return entity.LoginRes{}, err
+		}
+
+		if err := sessionRepo.ReadByUsedTokenHash(tokenHash, &session); err != nil {
+			if !entity.IsNotFound(err) {
+				return entity.LoginRes{}, err
+			}
+			return entity.LoginRes{}, ErrInvalidRefreshToken
+		}
+
+		logrus.Warn("SAuth.Refresh.Reused.", session.SessionID)
+		if err := sessionRepo.Revoke(session.SessionID); err != nil {
+			return entity.LoginRes{}, err
+		}
+		return entity.LoginRes{}, ErrRefreshTokenReused
+	}
+
+	newRefreshToken, err := helper.GenerateRandomToken(32)
+	if err != nil {
+		logrus.Error("SAuth.Refresh.GenerateRandomToken.", err)
+		return entity.LoginRes{}, err
+	}
+
+	isRotated, err := sessionRepo.Rotate(session.SessionID, tokenHash, helper.HashToken(newRefreshToken), time.Now())
+	if err != nil {
+		logrus.Error("SAuth.Refresh.Rotate.", err)
+		return entity.LoginRes{}, err
+	}
+
+	if !isRotated {
+		// Revoked, expired, or rotated by a concurrent request presenting the same token
+		if session.IsRevoked || !session.ExpiredAt.After(time.Now()) {
+			return entity.LoginRes{}, ErrInvalidRefreshToken
+		}
+
+		logrus.Warn("SAuth.Refresh.ConcurrentReuse.", session.SessionID)
+		if err := sessionRepo.Revoke(session.SessionID); err != nil {
+			return entity.LoginRes{}, err
+		}
+		return entity.LoginRes{}, ErrRefreshTokenReused
+	}
+
+	accessToken, err := s.CreateAccessToken(session.AccountID, session.SessionID, time.Duration(config.CONFIG.AccessTokenTTL))
+	if err != nil {
+		logrus.Error("SAuth.Refresh.CreateAccessToken.", err)
+		return entity.LoginRes{}, err
+	}
+
+	return entity.LoginRes{
+		Authorization: accessToken,
+		RefreshToken:  newRefreshToken,
+		ExpiresIn:     config.CONFIG.AccessTokenTTL,
+	}, nil
+}
+
+// Logout revokes the session, its access tokens stop working on the next request
+func (s *Auth) Logout(ctx context.Context, sessionId string) error {
+	if err := s.repos.Session(ctx).Revoke(sessionId); err != nil {
+		logrus.Error("SAuth.Logout.Revoke.", err)
+		return err
+	}
+
+	return nil
+}
+
+// IsSessionActive
+func (s *Auth) IsSessionActive(ctx context.Context, sessionId string) (bool, error) {
+	if sessionId == "" {
+		return false, nil
+	}
+
+	return s.repos.Session(ctx).CheckActive(sessionId, time.Now())
+}
+
+// MatchAndGetAccount checks the credentials behind the login guard. identifier is an email, matched
+// case-insensitively, or a username. Failures count against the client ip and, when the account
+// exists, the account. Locked keys return ErrTooManyAttempts before the password is even compared.
+func (s *Auth) MatchAndGetAccount(ctx context.Context, identifier, password, clientIP string, result *entity.TAccount) (bool, error) {
+	ipKey := IPLoginKey(clientIP)
+	if err := s.loginGuard.Check(ctx, ipKey); err != nil {
+		return false, err
+	}
+
+	accountRepo := s.repos.Account(ctx)
+
 	var account entity.TAccount
-	if err := repository.NewAccountRepo(ctx, s.mongoClient).ReadByEmail(email, &account); err != nil {
-		if err != mongo.ErrNoDocuments {
+	if err := readAccountByIdentifier(accountRepo, strings.TrimSpace(identifier), &account); err != nil {
+		if !entity.IsNotFound(err) {
 			return false, err
 		}
+
+		if err := s.loginGuard.Fail(ctx, ipKey); err != nil {
+			logrus.Error("SAuth.MatchAndGetAccount.Fail.", err)
+		}
 		return false, nil
 	}
 
-	// decode password
-	// ---------------
-	if account.Password != password {
+	accountKey := AccountLoginKey(account.AccountID)
+	if err := s.loginGuard.Check(ctx, accountKey); err != nil {
+		return false, err
+	}
+
+	isMatch, needsRehash := helper.ComparePassword(account.Password, password)
+	if !isMatch {
+		if err := s.loginGuard.Fail(ctx, ipKey, accountKey); err != nil {
+			logrus.Error("SAuth.MatchAndGetAccount.Fail.", err)
+		}
 		return false, nil
 	}
 
+	// With a second factor the counter is reset once the code matched, otherwise a known password
+	// would reset the code guesses on every login
+	if !account.TOTPEnabled && !isTOTPRequired(account) {
+		if err := s.loginGuard.Reset(ctx, accountKey); err != nil {
+			logrus.Error("SAuth.MatchAndGetAccount.Reset.", err)
+		}
+	}
+
+	// Upgrade legacy plaintext or weaker hashes on successful login
+	if needsRehash {
+		hashed, err := helper.HashPassword(password)
+		if err != nil {
+			logrus.Error("SAuth.MatchAndGetAccount.HashPassword.", err)
+		} else if err = accountRepo.UpdatePassword(account.AccountID, hashed); err != nil {
+			logrus.Error("SAuth.MatchAndGetAccount.UpdatePassword.", err)
+		} else {
+			account.Password = hashed
+		}
+	}
+
 	*result = account
 
 	return true, nil
 }
 
+// readAccountByIdentifier tries the email first, usernames can't contain @ so at most one account matches
+func readAccountByIdentifier(accountRepo repository.AccountRepository, identifier string, result *entity.TAccount) error {
+	if identifier == "" {
+		return repository.ErrAccountNotFound
+	}
+
+	err := accountRepo.ReadByEmail(identifier, result)
+	if !entity.IsNotFound(err) {
+		return err
+	}
+
+	return accountRepo.ReadByUsername(identifier, result)
+}
+
+// ResolveRole
+func (s *Auth) ResolveRole(ctx context.Context, accountId string) (entity.TAccountRole, error) {
+	var account entity.TAccount
+	if err := s.repos.Account(ctx).Read(accountId, &account); err != nil {
+		return "", err
+	}
+
+	return account.Role, nil
+}
+
 // --------------------------------
 
 func VerifyTokenHeader(c *gin.Context) (*jwt.Token, error) {
@@ -81,9 +331,7 @@ func VerifyTokenHeader(c *gin.Context) (*jwt.Token, error) {
 
 	accessToken := strings.SplitAfter(tokenHeader, "Bearer")[1]
 
-	token, err := jwt.Parse(strings.Trim(accessToken, " "), func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWTSecretKey), nil
-	})
+	token, err := jwt.Parse(strings.Trim(accessToken, " "), keyRing.Keyfunc)
 
 	if err != nil {
 		logrus.Error(err)
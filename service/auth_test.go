@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// sessionIdOf reads the session id out of an access token
+func sessionIdOf(t *testing.T, accessToken string) string {
+	t.Helper()
+
+	token, err := jwt.Parse(accessToken, keyRing.Keyfunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return decoded.Claims.SessionID
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// present returns the refresh token to send, the session was created with first and rotated once to second
+		present    func(t *testing.T, authService *Auth, first, second entity.LoginRes) string
+		wantErr    error
+		wantActive bool
+	}{
+		{
+			name: "current token rotates",
+			present: func(t *testing.T, authService *Auth, first, second entity.LoginRes) string {
+				return second.RefreshToken
+			},
+			wantActive: true,
+		},
+		{
+			name:       "rotated token revokes the family",
+			present:    func(t *testing.T, authService *Auth, first, second entity.LoginRes) string { return first.RefreshToken },
+			wantErr:    ErrRefreshTokenReused,
+			wantActive: false,
+		},
+		{
+			name:       "unknown token",
+			present:    func(t *testing.T, authService *Auth, first, second entity.LoginRes) string { return "unknown" },
+			wantErr:    ErrInvalidRefreshToken,
+			wantActive: true,
+		},
+		{
+			name: "token of a logged out session",
+			present: func(t *testing.T, authService *Auth, first, second entity.LoginRes) string {
+				if err := authService.Logout(context.Background(), sessionIdOf(t, second.Authorization)); err != nil {
+					t.Fatal(err)
+				}
+				return second.RefreshToken
+			},
+			wantErr:    ErrInvalidRefreshToken,
+			wantActive: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			authService := NewAuthService(nil, repository.NewMemoryRepositories())
+
+			first, err := authService.CreateSession(ctx, "account")
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := authService.Refresh(ctx, first.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if second.RefreshToken == first.RefreshToken {
+				t.Fatal("refresh kept the refresh token")
+			}
+
+			sessionId := sessionIdOf(t, first.Authorization)
+			if sessionIdOf(t, second.Authorization) != sessionId {
+				t.Fatal("refresh started another session")
+			}
+
+			third, err := authService.Refresh(ctx, test.present(t, authService, first, second))
+			if err != test.wantErr {
+				t.Fatalf("Refresh = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && (third.RefreshToken == "" || third.RefreshToken == second.RefreshToken) {
+				t.Errorf("refresh returned refresh token %q", third.RefreshToken)
+			}
+
+			isActive, err := authService.IsSessionActive(ctx, sessionId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isActive != test.wantActive {
+				t.Errorf("session active = %t, want %t", isActive, test.wantActive)
+			}
+
+			// After a reuse the newest token of the family is dead too
+			if test.wantErr == ErrRefreshTokenReused {
+				if _, err := authService.Refresh(ctx, second.RefreshToken); err != ErrInvalidRefreshToken {
+					t.Errorf("Refresh with the newest token = %v, want %v", err, ErrInvalidRefreshToken)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func NewDoctorService(client *mongo.Client, repos repository.Repositories) *Doctor {
+	return &Doctor{mongoClient: client, repos: repos}
+}
+
+// Doctor serves accounts with the DOCTOR role, every call is scoped to the linked TDoctor record
+type Doctor struct {
+	mongoClient *mongo.Client
+	repos       repository.Repositories
+}
+
+func (s *Doctor) GetLinkedDoctorID(ctx context.Context, accountId string) (string, error) {
+	var account entity.TAccount
+	if err := s.repos.Account(ctx).Read(accountId, &account); err != nil {
+		logrus.Error("SDoctor.GetLinkedDoctorID.Read.", err)
+		return "", err
+	}
+
+	if account.Role != entity.DOCTOR || account.DoctorID == "" {
+		return "", ErrDoctorNotLinked
+	}
+
+	return account.DoctorID, nil
+}
+
+func (s *Doctor) GetSchedule(ctx context.Context, doctorId string, result *[]entity.TAppointment) error {
+	if err := s.repos.Appointment(ctx).ReadManyByDoctor(doctorId, result); err != nil {
+		logrus.Error("SDoctor.GetSchedule.ReadManyByDoctor.", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Doctor) GetPatients(ctx context.Context, doctorId string, result *[]entity.TAccount) error {
+	var appointments []entity.TAppointment
+	if err := s.repos.Appointment(ctx).ReadManyByDoctor(doctorId, &appointments); err != nil {
+		logrus.Error("SDoctor.GetPatients.ReadManyByDoctor.", err)
+		return err
+	}
+
+	var accountIds []string
+	for _, appointment := range appointments {
+		for _, accountId := range appointment.PatientAccountIDs {
+			if !containsString(accountIds, accountId) {
+				accountIds = append(accountIds, accountId)
+			}
+		}
+	}
+
+	if len(accountIds) == 0 {
+		*result = []entity.TAccount{}
+		return nil
+	}
+
+	if err := s.repos.Account(ctx).ReadManyByIDs(accountIds, result); err != nil {
+		logrus.Error("SDoctor.GetPatients.ReadManyByIDs.", err)
+		return err
+	}
+
+	return nil
+}
+
+// ErrStatusNotAllowed doctors run the visit, everything before it belongs to reception
+var ErrStatusNotAllowed = entity.NewForbiddenError("doctors can only start or complete a visit")
+
+// UpdateVisitStatus moves a patient of one of the doctor's own appointments to IN_PROGRESS or COMPLETED
+func (s *Doctor) UpdateVisitStatus(ctx context.Context, doctorId, appointmentId, accountId, changedBy string, payload entity.TUpdateStatusReq) error {
+	if payload.Status != entity.IN_PROGRESS && payload.Status != entity.COMPLETED {
+		return ErrStatusNotAllowed
+	}
+
+	var appointment entity.TAppointment
+	if err := s.repos.Appointment(ctx).Read(appointmentId, &appointment); err != nil {
+		logrus.Error("SDoctor.UpdateVisitStatus.Read.", err)
+		return err
+	}
+
+	// Another doctor's appointment is reported as missing
+	if appointment.DoctorID != doctorId {
+		return repository.ErrAppointmentNotFound
+	}
+
+	return NewAppointmentService(s.mongoClient, s.repos).UpdateStatus(ctx, appointmentId, accountId, changedBy, payload)
+}
+
+// IsDoctorPatient reports whether the patient has booked any appointment with the doctor
+func (s *Doctor) IsDoctorPatient(ctx context.Context, doctorId, accountId string) (bool, error) {
+	return s.repos.Appointment(ctx).CheckPatientWithDoctor(doctorId, accountId)
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// legacyKeyID names the HS256 key read from JWT_SECRET, tokens issued before key rotation carry no kid
+const legacyKeyID = "legacy-hs256"
+
+var keyRing *KeyRing
+
+// InitKeyRing loads the signing keys from config, the server must not start when it fails
+func InitKeyRing() error {
+	ring, err := LoadKeyRing(config.CONFIG.JWT, config.JWTSecretKey)
+	if err != nil {
+		return err
+	}
+
+	keyRing = ring
+	return nil
+}
+
+type signingKey struct {
+	keyID     string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyRing signs with the active key and verifies with any known key, picked by the token kid header
+type KeyRing struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+func LoadKeyRing(cfg config.TJWTConfig, secret string) (*KeyRing, error) {
+	ring := &KeyRing{keys: map[string]*signingKey{}}
+
+	for _, keyConfig := range cfg.Keys {
+		key, err := loadSigningKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", keyConfig.KeyID, err)
+		}
+		if _, isExists := ring.keys[key.keyID]; isExists {
+			return nil, fmt.Errorf("jwt key %q: duplicate kid", key.keyID)
+		}
+		ring.keys[key.keyID] = key
+	}
+
+	if secret != "" {
+		ring.keys[legacyKeyID] = &signingKey{
+			keyID:     legacyKeyID,
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(secret),
+			verifyKey: []byte(secret),
+		}
+	}
+
+	activeKeyID := cfg.ActiveKeyID
+	if activeKeyID == "" && secret != "" {
+		logrus.Warn("SKeyRing.LoadKeyRing.NoActiveKid, signing with the legacy JWT_SECRET HS256 key")
+		activeKeyID = legacyKeyID
+	}
+
+	active, isExists := ring.keys[activeKeyID]
+	if !isExists {
+		return nil, errors.New("no usable jwt signing key, set jwt.active_kid or JWT_SECRET")
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("jwt key %q has no private key and can't be the active key", activeKeyID)
+	}
+	ring.active = active
+
+	return ring, nil
+}
+
+func loadSigningKey(keyConfig config.TJWTKeyConfig) (*signingKey, error) {
+	if keyConfig.KeyID == "" {
+		return nil, errors.New("kid is required")
+	}
+
+	key := &signingKey{keyID: keyConfig.KeyID}
+
+	var privatePEM, publicPEM []byte
+	if keyConfig.PrivateKeyFile != "" {
+		b, err := os.ReadFile(keyConfig.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		privatePEM = b
+	}
+	if keyConfig.PublicKeyFile != "" {
+		b, err := os.ReadFile(keyConfig.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicPEM = b
+	}
+	if privatePEM == nil && publicPEM == nil {
+		return nil, errors.New("private_key_file or public_key_file is required")
+	}
+
+	switch keyConfig.Algorithm {
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if privatePEM != nil {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = privateKey
+			key.verifyKey = &privateKey.PublicKey
+		} else {
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = publicKey
+		}
+
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		if privatePEM != nil {
+			privateKey, err := jwt.ParseEdPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = privateKey
+			key.verifyKey = privateKey.(ed25519.PrivateKey).Public()
+		} else {
+			publicKey, err := jwt.ParseEdPublicKeyFromPEM(publicPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = publicKey
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported alg %q, use RS256 or EdDSA", keyConfig.Algorithm)
+	}
+
+	return key, nil
+}
+
+// Sign signs claims with the active key and stamps its kid in the header
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.keyID
+
+	return token.SignedString(k.active.signKey)
+}
+
+// Keyfunc resolves the verification key from the kid header and rejects a mismatching alg
+func (k *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	if keyID == "" {
+		keyID = legacyKeyID
+	}
+
+	key, isExists := k.keys[keyID]
+	if !isExists {
+		return nil, fmt.Errorf("unknown kid %q", keyID)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected alg %q for kid %q", token.Method.Alg(), keyID)
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWKS publishes the asymmetric verification keys, the legacy HS256 secret is never published
+func (k *KeyRing) JWKS() entity.TJWKS {
+	jwks := entity.TJWKS{Keys: []entity.TJWK{}}
+
+	for _, key := range k.keys {
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, entity.TJWK{
+				KeyType:   "RSA",
+				KeyID:     key.keyID,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, entity.TJWK{
+				KeyType:   "OKP",
+				KeyID:     key.keyID,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+
+	return jwks
+}
+
+// GetJWKS
+func GetJWKS() entity.TJWKS {
+	return keyRing.JWKS()
+}
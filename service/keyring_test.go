@@ -0,0 +1,173 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// testKeys holds a signing RS256 key, an EdDSA key kept for verification only and the legacy secret
+type testKeys struct {
+	ring         *KeyRing
+	rsaKey       *rsa.PrivateKey
+	edKey        ed25519.PrivateKey
+	rsaPublic    []byte
+	legacySecret []byte
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicDER, err := x509.MarshalPKIXPublicKey(edPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring, err := LoadKeyRing(config.TJWTConfig{
+		ActiveKeyID: "rsa-2026",
+		Keys: []config.TJWTKeyConfig{
+			{KeyID: "rsa-2026", Algorithm: "RS256", PrivateKeyFile: writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))},
+			{KeyID: "ed-2025", Algorithm: "EdDSA", PublicKeyFile: writePEM(t, dir, "ed.pub.pem", "PUBLIC KEY", edPublicDER)},
+		},
+	}, "legacy-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKeys{
+		ring:         ring,
+		rsaKey:       rsaKey,
+		edKey:        edKey,
+		rsaPublic:    pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublic}),
+		legacySecret: []byte("legacy-secret"),
+	}
+}
+
+func TestKeyRingKeyfunc(t *testing.T) {
+	keys := newTestKeys(t)
+
+	sign := func(method jwt.SigningMethod, keyID string, key interface{}) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"aid": "account"})
+		if keyID != "" {
+			token.Header["kid"] = keyID
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	active, err := keys.ring.Sign(jwt.MapClaims{"aid": "account"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		isValid bool
+	}{
+		{name: "active key", token: active, isValid: true},
+		{name: "retired key kept for verification", token: sign(jwt.SigningMethodEdDSA, "ed-2025", keys.edKey), isValid: true},
+		{name: "legacy token without kid", token: sign(jwt.SigningMethodHS256, "", keys.legacySecret), isValid: true},
+		{name: "unknown kid", token: sign(jwt.SigningMethodRS256, "rsa-1999", keys.rsaKey), isValid: false},
+		{name: "HS256 signed with the RSA public key", token: sign(jwt.SigningMethodHS256, "rsa-2026", keys.rsaPublic), isValid: false},
+		{name: "RS256 under the legacy kid", token: sign(jwt.SigningMethodRS256, legacyKeyID, keys.rsaKey), isValid: false},
+		{name: "RS256 under the EdDSA kid", token: sign(jwt.SigningMethodRS256, "ed-2025", keys.rsaKey), isValid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := jwt.Parse(test.token, keys.ring.Keyfunc)
+			if isValid := err == nil && token.Valid; isValid != test.isValid {
+				t.Errorf("valid = %t (%v), want %t", isValid, err, test.isValid)
+			}
+		})
+	}
+}
+
+func TestKeyRingSignsWithActiveKid(t *testing.T) {
+	keys := newTestKeys(t)
+
+	signed, err := keys.ring.Sign(jwt.MapClaims{"aid": "account"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "rsa-2026" || token.Method.Alg() != "RS256" {
+		t.Errorf("header %v", token.Header)
+	}
+}
+
+func TestKeyRingJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+
+	jwks := keys.ring.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("%d keys published, want the RSA and EdDSA keys without the legacy secret: %+v", len(jwks.Keys), jwks.Keys)
+	}
+
+	ed, rsaKey := jwks.Keys[0], jwks.Keys[1]
+	if ed.KeyID != "ed-2025" || rsaKey.KeyID != "rsa-2026" {
+		t.Fatalf("keys %q and %q, want them sorted by kid", ed.KeyID, rsaKey.KeyID)
+	}
+
+	if ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("EdDSA key %+v", ed)
+	}
+	if x, err := base64.RawURLEncoding.DecodeString(ed.X); err != nil || !ed25519.PublicKey(x).Equal(keys.edKey.Public()) {
+		t.Errorf("EdDSA x %q does not decode to the public key: %v", ed.X, err)
+	}
+
+	if rsaKey.KeyType != "RSA" || rsaKey.Algorithm != "RS256" || rsaKey.Use != "sig" {
+		t.Errorf("RSA key %+v", rsaKey)
+	}
+	n, errN := base64.RawURLEncoding.DecodeString(rsaKey.N)
+	e, errE := base64.RawURLEncoding.DecodeString(rsaKey.E)
+	if errN != nil || errE != nil {
+		t.Fatalf("RSA n %q e %q are not base64url", rsaKey.N, rsaKey.E)
+	}
+	if new(big.Int).SetBytes(n).Cmp(keys.rsaKey.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(keys.rsaKey.E) {
+		t.Errorf("RSA n and e do not match the public key")
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrTooManyAttempts = entity.NewTooManyRequestsError("too many failed attempts, try again later")
+
+var (
+	memoryLoginAttemptStore     *repository.MemoryLoginAttemptStore
+	memoryLoginAttemptStoreOnce sync.Once
+)
+
+// NewLoginGuard picks the store from config, the memory store is shared by every guard in the process
+func NewLoginGuard(repos repository.Repositories) *LoginGuard {
+	var store repository.LoginAttemptStore
+	if config.CONFIG.LoginGuard.Store == "memory" {
+		memoryLoginAttemptStoreOnce.Do(func() {
+			memoryLoginAttemptStore = repository.NewMemoryLoginAttemptStore()
+		})
+		store = memoryLoginAttemptStore
+	} else {
+		store = repos.LoginAttempt()
+	}
+
+	return NewLoginGuardWithStore(store, config.CONFIG.LoginGuard)
+}
+
+func NewLoginGuardWithStore(store repository.LoginAttemptStore, policy config.TLoginGuardConfig) *LoginGuard {
+	return &LoginGuard{store: store, policy: policy, now: time.Now}
+}
+
+// LoginGuard tracks failed logins per key with exponential backoff
+type LoginGuard struct {
+	store  repository.LoginAttemptStore
+	policy config.TLoginGuardConfig
+	now    func() time.Time
+}
+
+func IPLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+func AccountLoginKey(accountId string) string {
+	return "account:" + accountId
+}
+
+// Check returns ErrTooManyAttempts while any of keys is locked
+func (g *LoginGuard) Check(ctx context.Context, keys ...string) error {
+	now := g.now()
+	for _, key := range keys {
+		attempt, err := g.store.Read(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if attempt.LockedUntil.After(now) {
+			return ErrTooManyAttempts
+		}
+	}
+
+	return nil
+}
+
+// Fail records a failure for every key and locks the ones past the threshold
+func (g *LoginGuard) Fail(ctx context.Context, keys ...string) error {
+	now := g.now()
+	window := time.Duration(g.policy.AttemptWindow) * time.Second
+
+	for _, key := range keys {
+		// Old failures outside the window don't count anymore
+		previous, err := g.store.Read(ctx, key)
+		if err != nil {
+			return err
+		}
+		if previous.FailureCount > 0 && previous.LastFailureAt.Add(window).Before(now) && !previous.LockedUntil.After(now) {
+			if err := g.store.Reset(ctx, key); err != nil {
+				return err
+			}
+		}
+
+		attempt, err := g.store.RecordFailure(ctx, key, now)
+		if err != nil {
+			return err
+		}
+
+		if attempt.FailureCount < g.policy.MaxAttempts {
+			continue
+		}
+
+		lockout := g.lockoutFor(attempt.FailureCount)
+		logrus.Warn("SLoginGuard.Fail.Locked.", key, " ", lockout)
+		if err := g.store.Lock(ctx, key, now.Add(lockout)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset clears the counters, used after a successful login and by the admin unlock endpoint
+func (g *LoginGuard) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := g.store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockoutFor doubles the base lockout for every failure past the threshold, capped at MaxLockout
+func (g *LoginGuard) lockoutFor(failureCount int) time.Duration {
+	maxLockout := time.Duration(g.policy.MaxLockout) * time.Second
+	lockout := time.Duration(g.policy.BaseLockout) * time.Second
+
+	for i := g.policy.MaxAttempts; i < failureCount; i++ {
+		lockout *= 2
+		if lockout >= maxLockout {
+			return maxLockout
+		}
+	}
+
+	return lockout
+}
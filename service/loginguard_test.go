@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/repository"
+)
+
+func TestLoginGuardLockoutEscalation(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryLoginAttemptStore()
+	guard := NewLoginGuardWithStore(store, config.TLoginGuardConfig{
+		MaxAttempts:   3,
+		AttemptWindow: 900,
+		BaseLockout:   30,
+		MaxLockout:    100,
+	})
+
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	guard.now = func() time.Time { return now }
+
+	// Every step waits, fails once and expects the key to be locked for wantLockout after it
+	steps := []struct {
+		name        string
+		wait        time.Duration
+		wantLockout time.Duration
+	}{
+		{name: "first failure", wait: 0, wantLockout: 0},
+		{name: "second failure", wait: time.Second, wantLockout: 0},
+		{name: "threshold locks for the base lockout", wait: time.Second, wantLockout: 30 * time.Second},
+		{name: "next failure doubles it", wait: 31 * time.Second, wantLockout: 60 * time.Second},
+		{name: "doubling stops at the max lockout", wait: 61 * time.Second, wantLockout: 100 * time.Second},
+		{name: "max lockout holds", wait: 101 * time.Second, wantLockout: 100 * time.Second},
+		{name: "failures past the window start over", wait: 1001 * time.Second, wantLockout: 0},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.wait)
+
+		if err := guard.Check(ctx, "key"); err != nil {
+			t.Fatalf("%s: Check before failing = %v", step.name, err)
+		}
+		if err := guard.Fail(ctx, "key"); err != nil {
+			t.Fatalf("%s: Fail = %v", step.name, err)
+		}
+
+		attempt, err := store.Read(ctx, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lockout := time.Duration(0)
+		if attempt.LockedUntil.After(now) {
+			lockout = attempt.LockedUntil.Sub(now)
+		}
+		if lockout != step.wantLockout {
+			t.Errorf("%s: locked for %s, want %s", step.name, lockout, step.wantLockout)
+		}
+
+		wantErr := error(nil)
+		if step.wantLockout > 0 {
+			wantErr = ErrTooManyAttempts
+		}
+		if err := guard.Check(ctx, "key", "other"); err != wantErr {
+			t.Errorf("%s: Check = %v, want %v", step.name, err, wantErr)
+		}
+	}
+
+	if err := guard.Fail(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Reset(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Check(ctx, "key"); err != nil {
+		t.Errorf("Check after Reset = %v", err)
+	}
+}
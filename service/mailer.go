@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Mailer sends plain text mails
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// NewMailer picks the implementation from config
+func NewMailer() Mailer {
+	mailConfig := config.CONFIG.Mail
+	if mailConfig.Driver == "smtp" {
+		return NewSMTPMailer(mailConfig, config.MailSMTPPassword)
+	}
+
+	return NewFileMailer(mailConfig.From, mailConfig.FilePath)
+}
+
+func NewSMTPMailer(mailConfig config.TMailConfig, password string) *SMTPMailer {
+	var auth smtp.Auth
+	if mailConfig.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", mailConfig.SMTPUsername, password, mailConfig.SMTPHost)
+	}
+
+	return &SMTPMailer{
+		addr: mailConfig.SMTPHost + ":" + mailConfig.SMTPPort,
+		from: mailConfig.From,
+		auth: auth,
+	}
+}
+
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, buildMail(m.from, to, subject, body)); err != nil {
+		logrus.Error("SSMTPMailer.Send.SendMail.", err)
+		return err
+	}
+
+	return nil
+}
+
+// NewFileMailer appends every mail to path, or logs it when path is empty. Meant for local testing.
+func NewFileMailer(from, path string) *FileMailer {
+	return &FileMailer{from: from, path: path}
+}
+
+type FileMailer struct {
+	mu   sync.Mutex
+	from string
+	path string
+}
+
+func (m *FileMailer) Send(ctx context.Context, to, subject, body string) error {
+	mail := buildMail(m.from, to, subject, body)
+
+	if m.path == "" {
+		logrus.Info("SFileMailer.Send.\n", string(mail))
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		logrus.Error("SFileMailer.Send.OpenFile.", err)
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logrus.Error(err)
+		}
+	}()
+
+	if _, err := file.Write(append(mail, "\r\n\r\n"...)); err != nil {
+		logrus.Error("SFileMailer.Send.Write.", err)
+		return err
+	}
+
+	return nil
+}
+
+// headerSanitizer keeps user supplied values such as the account email from injecting headers
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+func buildMail(from, to, subject, body string) []byte {
+	from, to, subject = headerSanitizer.Replace(from), headerSanitizer.Replace(to), headerSanitizer.Replace(subject)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(body)
+
+	return []byte(b.String())
+}
@@ -2,23 +2,26 @@ package service
 
 import (
 	"context"
+	"strings"
 
 	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
 	"github.com/agustadewa/hospital-backend/repository"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func NewPatientService(client *mongo.Client) *Patient {
-	return &Patient{mongoClient: client}
+func NewPatientService(client *mongo.Client, repos repository.Repositories) *Patient {
+	return &Patient{mongoClient: client, repos: repos}
 }
 
 type Patient struct {
 	mongoClient *mongo.Client
+	repos       repository.Repositories
 }
 
 func (s *Patient) GetAccount(ctx context.Context, id string, result *entity.TAccount) error {
-	accountSvc := repository.NewAccountRepo(ctx, s.mongoClient)
+	accountSvc := s.repos.Account(ctx)
 
 	if err := accountSvc.Read(id, result); err != nil {
 		logrus.Error(err)
@@ -29,20 +32,85 @@ func (s *Patient) GetAccount(ctx context.Context, id string, result *entity.TAcc
 }
 
 func (s *Patient) CreateAccount(ctx context.Context, id string, payload entity.TCreateAccountReq) error {
+	if err := validateUsername(strings.TrimSpace(payload.Username)); err != nil {
+		return err
+	}
+	if err := validatePassword(payload.Password); err != nil {
+		return err
+	}
+
+	password, err := helper.HashPassword(payload.Password)
+	if err != nil {
+		logrus.Error("SPatient.CreateAccount.HashPassword.", err)
+		return err
+	}
+
 	account := entity.TAccount{
 		AccountID: id,
 		Role:      entity.PATIENT,
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Age:       payload.Age,
-		Email:     payload.Email,
-		Username:  payload.Username,
-		Password:  payload.Password,
+		Email:     helper.NormalizeEmail(payload.Email),
+		Username:  strings.TrimSpace(payload.Username),
+		Password:  password,
 	}
-	if err := repository.NewAccountRepo(ctx, s.mongoClient).Create(account); err != nil {
+	if err := s.repos.Account(ctx).Create(account); err != nil {
 		logrus.Error("SPatient.CreateAccount.Create.", err)
+		return accountWriteError(err)
+	}
+
+	return nil
+}
+
+// UpdateProfile updates the patient's own account, a password change requires the current password
+// and revokes every session of the account, the current one included
+func (s *Patient) UpdateProfile(ctx context.Context, id string, payload entity.TUpdateAccountReq) error {
+	accountRepo := s.repos.Account(ctx)
+
+	var current entity.TAccount
+	if err := accountRepo.Read(id, &current); err != nil {
+		logrus.Error("SPatient.UpdateProfile.Read.", err)
 		return err
 	}
 
+	update, err := prepareAccountUpdate(accountRepo, current, payload, true)
+	if err != nil {
+		logrus.Info("SPatient.UpdateProfile.prepareAccountUpdate.", err)
+		return err
+	}
+
+	if isEmptyAccountUpdate(update) {
+		return nil
+	}
+
+	if err := accountRepo.Update(id, update); err != nil {
+		logrus.Error("SPatient.UpdateProfile.Update.", err)
+		return accountWriteError(err)
+	}
+
+	// Like a reset, a new password signs out whoever held the old one
+	if update.Password != nil {
+		if err := s.repos.Session(ctx).RevokeAllByAccount(id); err != nil {
+			logrus.Error("SPatient.UpdateProfile.RevokeAllByAccount.", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckIsPatient makes sure staff acting on behalf of a patient address a PATIENT account
+func (s *Patient) CheckIsPatient(ctx context.Context, id string) error {
+	var account entity.TAccount
+	if err := s.repos.Account(ctx).Read(id, &account); err != nil {
+		logrus.Error("SPatient.CheckIsPatient.Read.", err)
+		return err
+	}
+
+	if account.Role != entity.PATIENT {
+		return ErrNotPatient
+	}
+
 	return nil
 }
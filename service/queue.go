@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	queueDateLayout = "2006-01-02"
+
+	// maxCallAttempts bounds the retries of a call racing another desk on the same queue
+	maxCallAttempts = 5
+)
+
+var (
+	ErrInvalidQueueTicket  = entity.NewValidationError("a ticket needs appointment_id and account_id for a booked patient, or name for a walk-in")
+	ErrNotTodayAppointment = entity.NewValidationError("appointment is not today")
+	ErrAlreadyQueued       = entity.NewConflictError("patient already has a number today")
+	ErrQueueEmpty          = entity.NewConflictError("nobody is waiting")
+	ErrQueueBusy           = entity.NewConflictError("queue changed while calling, try again")
+)
+
+func NewQueueService(client *mongo.Client, repos repository.Repositories) *Queue {
+	return &Queue{mongoClient: client, repos: repos, broker: queueBroker, now: time.Now}
+}
+
+// Queue hands out the numbers of each doctor's day, booked patients and walk-ins share them.
+// Every change is published to the board streams.
+type Queue struct {
+	mongoClient *mongo.Client
+	repos       repository.Repositories
+	broker      *QueueBroker
+	now         func() time.Time
+}
+
+// IssueTicket gives the patient the next number of today's queue of the doctor
+func (s *Queue) IssueTicket(ctx context.Context, payload entity.TIssueQueueReq) (int, error) {
+	name := strings.TrimSpace(payload.Name)
+	isBooked := payload.AppointmentID != "" || payload.AccountID != ""
+	if isBooked && (payload.AppointmentID == "" || payload.AccountID == "" || name != "") {
+		return 0, ErrInvalidQueueTicket
+	}
+	if !isBooked && name == "" {
+		return 0, ErrInvalidQueueTicket
+	}
+
+	if err := s.repos.Doctor(ctx).Read(payload.DoctorID, &entity.TDoctor{}); err != nil {
+		logrus.Error("SQueue.IssueTicket.ReadDoctor.", err)
+		return 0, err
+	}
+
+	date, err := s.today()
+	if err != nil {
+		return 0, err
+	}
+
+	if isBooked {
+		if err := s.checkBookedToday(ctx, payload, date); err != nil {
+			return 0, err
+		}
+	}
+
+	number, isIssued, err := s.repos.Queue(ctx).IssueTicket(payload.DoctorID, date, entity.TQueueTicket{
+		AccountID:     payload.AccountID,
+		AppointmentID: payload.AppointmentID,
+		Name:          name,
+		Status:        entity.QUEUE_WAITING,
+		IssuedAt:      s.now(),
+	})
+	if err != nil {
+		logrus.Error("SQueue.IssueTicket.IssueTicket.", err)
+		return 0, err
+	}
+	if !isIssued {
+		return 0, ErrAlreadyQueued
+	}
+
+	s.publish(ctx, payload.DoctorID)
+
+	return number, nil
+}
+
+// checkBookedToday makes sure the patient is booked with the doctor, on today's appointment when it is timed
+func (s *Queue) checkBookedToday(ctx context.Context, payload entity.TIssueQueueReq, date string) error {
+	var appointment entity.TAppointment
+	if err := s.repos.Appointment(ctx).Read(payload.AppointmentID, &appointment); err != nil {
+		logrus.Error("SQueue.checkBookedToday.Read.", err)
+		return err
+	}
+
+	if appointment.DoctorID != payload.DoctorID {
+		return repository.ErrAppointmentNotFound
+	}
+	if !containsString(appointment.PatientAccountIDs, payload.AccountID) {
+		return ErrNotBooked
+	}
+
+	if appointment.StartAt != nil {
+		location, err := ClinicLocation()
+		if err != nil {
+			logrus.Error("SQueue.checkBookedToday.ClinicLocation.", err)
+			return err
+		}
+		if appointment.StartAt.In(location).Format(queueDateLayout) != date {
+			return ErrNotTodayAppointment
+		}
+	}
+
+	return nil
+}
+
+// CallNext serves the lowest waiting number of today's queue of the doctor and returns its ticket
+func (s *Queue) CallNext(ctx context.Context, doctorId string) (entity.TQueueTicket, error) {
+	date, err := s.today()
+	if err != nil {
+		return entity.TQueueTicket{}, err
+	}
+
+	queueRepo := s.repos.Queue(ctx)
+
+	for attempt := 0; attempt < maxCallAttempts; attempt++ {
+		var queue entity.TQueue
+		if err := queueRepo.Read(doctorId, date, &queue); err != nil {
+			if entity.IsNotFound(err) {
+				return entity.TQueueTicket{}, ErrQueueEmpty
+			}
+			logrus.Error("SQueue.CallNext.Read.", err)
+			return entity.TQueueTicket{}, err
+		}
+
+		next, isWaiting := nextWaiting(queue)
+		if !isWaiting {
+			return entity.TQueueTicket{}, ErrQueueEmpty
+		}
+
+		now := s.now()
+		isCalled, err := queueRepo.CallNext(doctorId, date, queue.CurrentNumber, next.Number, now)
+		if err != nil {
+			logrus.Error("SQueue.CallNext.CallNext.", err)
+			return entity.TQueueTicket{}, err
+		}
+
+		if isCalled {
+			next.Status = entity.QUEUE_CALLED
+			next.CalledAt = &now
+			s.publish(ctx, doctorId)
+			return next, nil
+		}
+	}
+
+	return entity.TQueueTicket{}, ErrQueueBusy
+}
+
+// GetQueue returns today's queue of the doctor with its tickets, an empty one before the first number
+func (s *Queue) GetQueue(ctx context.Context, doctorId string, result *entity.TQueue) error {
+	date, err := s.today()
+	if err != nil {
+		return err
+	}
+
+	if err := s.repos.Queue(ctx).Read(doctorId, date, result); err != nil {
+		if !entity.IsNotFound(err) {
+			logrus.Error("SQueue.GetQueue.Read.", err)
+			return err
+		}
+		*result = entity.TQueue{DoctorID: doctorId, Date: date, Tickets: []entity.TQueueTicket{}}
+	}
+
+	return nil
+}
+
+// GetBoard returns the public view of today's queue of the doctor
+func (s *Queue) GetBoard(ctx context.Context, doctorId string) (entity.TQueueBoard, error) {
+	if err := s.repos.Doctor(ctx).Read(doctorId, &entity.TDoctor{}); err != nil {
+		logrus.Error("SQueue.GetBoard.ReadDoctor.", err)
+		return entity.TQueueBoard{}, err
+	}
+
+	var queue entity.TQueue
+	if err := s.GetQueue(ctx, doctorId, &queue); err != nil {
+		return entity.TQueueBoard{}, err
+	}
+
+	return toQueueBoard(queue), nil
+}
+
+// Subscribe streams the boards of the doctor's queue until the returned function is called
+func (s *Queue) Subscribe(doctorId string) (<-chan entity.TQueueBoard, func()) {
+	return s.broker.Subscribe(doctorId)
+}
+
+// publish sends the board as stored after a change, a failed read only costs the displays one update
+func (s *Queue) publish(ctx context.Context, doctorId string) {
+	var queue entity.TQueue
+	if err := s.GetQueue(ctx, doctorId, &queue); err != nil {
+		logrus.Error("SQueue.publish.GetQueue.", err)
+		return
+	}
+
+	s.broker.Publish(toQueueBoard(queue))
+}
+
+// today is the clinic day queues are kept per
+func (s *Queue) today() (string, error) {
+	location, err := ClinicLocation()
+	if err != nil {
+		logrus.Error("SQueue.today.ClinicLocation.", err)
+		return "", err
+	}
+
+	return s.now().In(location).Format(queueDateLayout), nil
+}
+
+func nextWaiting(queue entity.TQueue) (entity.TQueueTicket, bool) {
+	var next entity.TQueueTicket
+	isWaiting := false
+	for _, ticket := range queue.Tickets {
+		if ticket.Status == entity.QUEUE_WAITING && (!isWaiting || ticket.Number < next.Number) {
+			next, isWaiting = ticket, true
+		}
+	}
+
+	return next, isWaiting
+}
+
+func toQueueBoard(queue entity.TQueue) entity.TQueueBoard {
+	board := entity.TQueueBoard{
+		DoctorID:      queue.DoctorID,
+		Date:          queue.Date,
+		CurrentNumber: queue.CurrentNumber,
+		LastNumber:    queue.LastNumber,
+	}
+	for _, ticket := range queue.Tickets {
+		if ticket.Status == entity.QUEUE_WAITING {
+			board.WaitingCount++
+		}
+	}
+
+	return board
+}
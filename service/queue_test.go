@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+)
+
+func TestQueueIssuesAndCallsInOrder(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+
+	// 23:00 in the clinic is still 16:00 UTC, the clinic day ends first
+	now := clinicTime(t, 2026, time.March, 2, 23, 0)
+	queueService := NewQueueService(nil, repos)
+	queueService.now = func() time.Time { return now }
+
+	if err := repos.Doctor(ctx).Create(entity.TDoctor{DoctorID: "doctor", IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+	// The morning appointment is on the same UTC day as now
+	for appointmentId, startAt := range map[string]time.Time{
+		"tonight":  clinicTime(t, 2026, time.March, 2, 23, 30),
+		"tomorrow": clinicTime(t, 2026, time.March, 3, 6, 0),
+	} {
+		startAt, endAt := startAt, startAt.Add(30*time.Minute)
+		if err := repos.Appointment(ctx).Create(entity.TAppointment{
+			AppointmentID:     appointmentId,
+			DoctorID:          "doctor",
+			PatientAccountIDs: []string{"patient", "early"},
+			MaxAppointment:    2,
+			StartAt:           &startAt,
+			EndAt:             &endAt,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issues := []struct {
+		name       string
+		payload    entity.TIssueQueueReq
+		wantNumber int
+		wantErr    error
+	}{
+		{name: "walk-in", payload: entity.TIssueQueueReq{Name: "Walk In"}, wantNumber: 1},
+		{name: "booked tonight", payload: entity.TIssueQueueReq{AppointmentID: "tonight", AccountID: "patient"}, wantNumber: 2},
+		{name: "booked twice", payload: entity.TIssueQueueReq{AppointmentID: "tonight", AccountID: "patient"}, wantErr: ErrAlreadyQueued},
+		{name: "booked tomorrow in the clinic", payload: entity.TIssueQueueReq{AppointmentID: "tomorrow", AccountID: "early"}, wantErr: ErrNotTodayAppointment},
+		{name: "not booked", payload: entity.TIssueQueueReq{AppointmentID: "tonight", AccountID: "other"}, wantErr: ErrNotBooked},
+		{name: "name and account", payload: entity.TIssueQueueReq{AppointmentID: "tonight", AccountID: "patient", Name: "Patient"}, wantErr: ErrInvalidQueueTicket},
+		{name: "second walk-in", payload: entity.TIssueQueueReq{Name: "Walk In"}, wantNumber: 3},
+	}
+
+	for _, issue := range issues {
+		issue.payload.DoctorID = "doctor"
+		number, err := queueService.IssueTicket(ctx, issue.payload)
+		if err != issue.wantErr || number != issue.wantNumber {
+			t.Errorf("%s: IssueTicket = %d, %v, want %d, %v", issue.name, number, err, issue.wantNumber, issue.wantErr)
+		}
+	}
+
+	for _, wantNumber := range []int{1, 2, 3} {
+		ticket, err := queueService.CallNext(ctx, "doctor")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ticket.Number != wantNumber || ticket.Status != entity.QUEUE_CALLED {
+			t.Errorf("called %d (%s), want %d", ticket.Number, ticket.Status, wantNumber)
+		}
+	}
+	if _, err := queueService.CallNext(ctx, "doctor"); err != ErrQueueEmpty {
+		t.Errorf("CallNext on an empty queue = %v, want %v", err, ErrQueueEmpty)
+	}
+
+	// Past midnight in the clinic the queue starts over, and the morning appointment is today's
+	now = clinicTime(t, 2026, time.March, 3, 0, 30)
+	if _, err := queueService.CallNext(ctx, "doctor"); err != ErrQueueEmpty {
+		t.Errorf("CallNext on a new day = %v, want %v", err, ErrQueueEmpty)
+	}
+	if _, err := queueService.IssueTicket(ctx, entity.TIssueQueueReq{DoctorID: "doctor", AppointmentID: "tonight", AccountID: "patient"}); err != ErrNotTodayAppointment {
+		t.Errorf("IssueTicket for yesterday = %v, want %v", err, ErrNotTodayAppointment)
+	}
+	if number, err := queueService.IssueTicket(ctx, entity.TIssueQueueReq{DoctorID: "doctor", AppointmentID: "tomorrow", AccountID: "early"}); err != nil || number != 1 {
+		t.Errorf("IssueTicket on a new day = %d, %v, want 1", number, err)
+	}
+}
+
+func TestQueueConcurrentDesks(t *testing.T) {
+	const callers = 20
+
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	queueService := NewQueueService(nil, repos)
+
+	if err := repos.Doctor(ctx).Create(entity.TDoctor{DoctorID: "doctor", IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// run starts callers at once and returns the numbers they got
+	run := func(do func(i int) (int, error)) []int {
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			start   = make(chan struct{})
+			numbers []int
+		)
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+
+				number, err := do(i)
+				if err != nil {
+					t.Errorf("caller %d: %v", i, err)
+					return
+				}
+
+				mu.Lock()
+				numbers = append(numbers, number)
+				mu.Unlock()
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		sort.Ints(numbers)
+		return numbers
+	}
+
+	want := make([]int, 0, callers)
+	for i := 1; i <= callers; i++ {
+		want = append(want, i)
+	}
+
+	issued := run(func(i int) (int, error) {
+		return queueService.IssueTicket(ctx, entity.TIssueQueueReq{DoctorID: "doctor", Name: fmt.Sprintf("walk-in %d", i)})
+	})
+	if fmt.Sprint(issued) != fmt.Sprint(want) {
+		t.Errorf("issued %v, want %v", issued, want)
+	}
+
+	// A desk losing the race retries, every number is called exactly once
+	called := run(func(i int) (int, error) {
+		for {
+			ticket, err := queueService.CallNext(ctx, "doctor")
+			if err == ErrQueueBusy {
+				continue
+			}
+			return ticket.Number, err
+		}
+	})
+	if fmt.Sprint(called) != fmt.Sprint(want) {
+		t.Errorf("called %v, want %v", called, want)
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/agustadewa/hospital-backend/entity"
+)
+
+// queueBroker fans queue changes out to the board streams of this process. Every instance has its own,
+// a display only sees changes made through the instance it is connected to.
+var queueBroker = NewQueueBroker()
+
+func NewQueueBroker() *QueueBroker {
+	return &QueueBroker{subscribers: map[string]map[chan entity.TQueueBoard]struct{}{}}
+}
+
+// QueueBroker keeps the subscribers of every doctor's queue. A display only needs the latest board,
+// so a slow subscriber loses the boards it hasn't read instead of blocking the publisher.
+type QueueBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan entity.TQueueBoard]struct{}
+}
+
+// Subscribe returns the boards published for doctorId and the function that ends the subscription
+func (b *QueueBroker) Subscribe(doctorId string) (<-chan entity.TQueueBoard, func()) {
+	updates := make(chan entity.TQueueBoard, 1)
+
+	b.mu.Lock()
+	if b.subscribers[doctorId] == nil {
+		b.subscribers[doctorId] = map[chan entity.TQueueBoard]struct{}{}
+	}
+	b.subscribers[doctorId][updates] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers[doctorId], updates)
+		if len(b.subscribers[doctorId]) == 0 {
+			delete(b.subscribers, doctorId)
+		}
+	}
+
+	return updates, unsubscribe
+}
+
+func (b *QueueBroker) Publish(board entity.TQueueBoard) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for updates := range b.subscribers[board.DoctorID] {
+		// Replace the unread board, the buffer holds one and only the publisher writes
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- board
+	}
+}
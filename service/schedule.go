@@ -0,0 +1,421 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	minSlotMinutes = 5
+	maxSlotMinutes = 480
+	clockLayout    = "15:04"
+)
+
+var (
+	ErrInvalidSlotMinutes     = entity.NewValidationError("slot_minutes must be between 5 and 480")
+	ErrInvalidMaxPerSlot      = entity.NewValidationError("max_per_slot must be at least 1")
+	ErrInvalidWorkingHours    = entity.NewValidationError("working hours need a weekday from 0 to 6 and start_time before end_time as HH:MM, without overlaps")
+	ErrInvalidException       = entity.NewValidationError("schedule exceptions need start_at before end_at")
+	ErrInvalidSlotRange       = entity.NewValidationError("to must be after from and within max_slot_range_days")
+	ErrInvalidAppointmentTime = entity.NewValidationError("start_at and end_at go together and start_at must be before end_at")
+	ErrSlotNotAvailable       = entity.NewConflictError("slot is not available")
+	ErrAppointmentOverlaps    = entity.NewConflictError("overlaps another appointment of the doctor")
+)
+
+var (
+	clinicLocation     *time.Location
+	clinicLocationErr  error
+	clinicLocationOnce sync.Once
+)
+
+// ClinicLocation is the timezone working hours are written in
+func ClinicLocation() (*time.Location, error) {
+	clinicLocationOnce.Do(func() {
+		clinicLocation, clinicLocationErr = time.LoadLocation(config.CONFIG.Schedule.Timezone)
+	})
+
+	return clinicLocation, clinicLocationErr
+}
+
+func NewScheduleService(client *mongo.Client, repos repository.Repositories) *Schedule {
+	return &Schedule{
+		mongoClient: client,
+		repos:       repos,
+		appointment: NewAppointmentService(client, repos),
+		now:         time.Now,
+	}
+}
+
+// Schedule turns the weekly working hours of doctors into bookable slots. A slot becomes an
+// appointment the first time it is booked, later bookings join that appointment.
+type Schedule struct {
+	mongoClient *mongo.Client
+	repos       repository.Repositories
+	appointment *Appointment
+	now         func() time.Time
+}
+
+func (s *Schedule) SetSchedule(ctx context.Context, doctorId string, payload entity.TSetScheduleReq) error {
+	if err := validateSchedule(payload); err != nil {
+		return err
+	}
+
+	if err := s.repos.Doctor(ctx).Read(doctorId, &entity.TDoctor{}); err != nil {
+		logrus.Error("SSchedule.SetSchedule.ReadDoctor.", err)
+		return err
+	}
+
+	exceptions := payload.Exceptions
+	if exceptions == nil {
+		exceptions = []entity.TScheduleException{}
+	}
+
+	schedule := entity.TWorkingSchedule{
+		DoctorID:    doctorId,
+		SlotMinutes: payload.SlotMinutes,
+		MaxPerSlot:  payload.MaxPerSlot,
+		WeeklyHours: payload.WeeklyHours,
+		Exceptions:  exceptions,
+		UpdatedAt:   s.now(),
+	}
+	if err := s.repos.Schedule(ctx).Upsert(schedule); err != nil {
+		logrus.Error("SSchedule.SetSchedule.Upsert.", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Schedule) GetSchedule(ctx context.Context, doctorId string, result *entity.TWorkingSchedule) error {
+	if err := s.repos.Schedule(ctx).ReadByDoctor(doctorId, result); err != nil {
+		logrus.Error("SSchedule.GetSchedule.ReadByDoctor.", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetSlots returns the free future slots of a doctor starting in [From, To), a deactivated doctor has none
+func (s *Schedule) GetSlots(ctx context.Context, payload entity.TGetSlotsReq) ([]entity.TSlot, error) {
+	maxRange := time.Duration(config.CONFIG.Schedule.MaxSlotRangeDays) * 24 * time.Hour
+	if payload.From.IsZero() || !payload.To.After(payload.From) || payload.To.Sub(payload.From) > maxRange {
+		return nil, ErrInvalidSlotRange
+	}
+
+	if err := s.appointment.checkDoctorActive(ctx, payload.DoctorID); err != nil {
+		return nil, err
+	}
+
+	var schedule entity.TWorkingSchedule
+	if err := s.GetSchedule(ctx, payload.DoctorID, &schedule); err != nil {
+		return nil, err
+	}
+
+	location, err := ClinicLocation()
+	if err != nil {
+		logrus.Error("SSchedule.GetSlots.ClinicLocation.", err)
+		return nil, err
+	}
+
+	slots := generateSlots(schedule, payload.From, payload.To, s.now(), location)
+	if len(slots) == 0 {
+		return []entity.TSlot{}, nil
+	}
+
+	// Appointments of the last slot may end after To
+	var appointments []entity.TAppointment
+	if err := s.repos.Appointment(ctx).ReadManyByDoctorRange(payload.DoctorID, payload.From, slots[len(slots)-1].EndAt, &appointments); err != nil {
+		logrus.Error("SSchedule.GetSlots.ReadManyByDoctorRange.", err)
+		return nil, err
+	}
+
+	free := []entity.TSlot{}
+	for _, slot := range slots {
+		if applyAppointments(&slot, appointments) {
+			free = append(free, slot)
+		}
+	}
+
+	return free, nil
+}
+
+// BookSlot books accountId on the slot starting at StartAt. The first booking creates the appointment
+// of the slot with appointmentId, it is unused when the slot already has one.
+func (s *Schedule) BookSlot(ctx context.Context, appointmentId, accountId, changedBy string, payload entity.TBookSlotReq) (string, error) {
+	slotAppointmentId, err := s.slotAppointment(ctx, appointmentId, payload.DoctorID, payload.StartAt)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.appointment.Book(ctx, slotAppointmentId, accountId, changedBy); err != nil {
+		s.discardSlotAppointment(ctx, appointmentId, slotAppointmentId)
+		return "", err
+	}
+
+	return slotAppointmentId, nil
+}
+
+// Reschedule moves the booking of accountId on fromAppointmentId to an appointment or a slot and returns
+// the appointment it landed on. appointmentId opens the slot like in BookSlot.
+func (s *Schedule) Reschedule(ctx context.Context, fromAppointmentId, appointmentId, accountId, changedBy string, payload entity.TRescheduleReq) (string, error) {
+	isSlot := payload.DoctorID != "" || payload.StartAt != nil
+	if (payload.ToAppointmentID != "" && isSlot) || (payload.ToAppointmentID == "" && (payload.DoctorID == "" || payload.StartAt == nil)) {
+		return "", ErrInvalidReschedule
+	}
+
+	toAppointmentId := payload.ToAppointmentID
+	if isSlot {
+		var err error
+		if toAppointmentId, err = s.slotAppointment(ctx, appointmentId, payload.DoctorID, *payload.StartAt); err != nil {
+			return "", err
+		}
+	}
+
+	if err := s.appointment.Reschedule(ctx, fromAppointmentId, toAppointmentId, accountId, changedBy, payload.Note); err != nil {
+		if isSlot {
+			s.discardSlotAppointment(ctx, appointmentId, toAppointmentId)
+		}
+		return "", err
+	}
+
+	return toAppointmentId, nil
+}
+
+// discardSlotAppointment removes the slot appointment a failed booking opened, so no empty appointment
+// is left behind. Another booking may have joined it meanwhile, then it stays. Failures are only logged.
+func (s *Schedule) discardSlotAppointment(ctx context.Context, appointmentId, slotAppointmentId string) {
+	if slotAppointmentId != appointmentId {
+		return
+	}
+
+	if _, err := s.repos.Appointment(ctx).DeleteUnused(appointmentId); err != nil {
+		logrus.Error("SSchedule.discardSlotAppointment.DeleteUnused.", err)
+	}
+}
+
+// slotAppointment returns the id of the appointment of the future slot of doctorId starting at startAt,
+// opening it with appointmentId on the first booking. A deactivated doctor opens no slot.
+func (s *Schedule) slotAppointment(ctx context.Context, appointmentId, doctorId string, startAt time.Time) (string, error) {
+	if err := s.appointment.checkDoctorActive(ctx, doctorId); err != nil {
+		return "", err
+	}
+
+	var schedule entity.TWorkingSchedule
+	if err := s.GetSchedule(ctx, doctorId, &schedule); err != nil {
+		return "", err
+	}
+
+	location, err := ClinicLocation()
+	if err != nil {
+		logrus.Error("SSchedule.slotAppointment.ClinicLocation.", err)
+		return "", err
+	}
+
+	slots := generateSlots(schedule, startAt, startAt.Add(time.Minute), s.now(), location)
+	if len(slots) == 0 || !slots[0].StartAt.Equal(startAt) {
+		return "", ErrSlotNotAvailable
+	}
+	slot := slots[0]
+
+	var appointment entity.TAppointment
+	err = s.repos.Appointment(ctx).ReadBySlot(slot.DoctorID, slot.StartAt, &appointment)
+	if entity.IsNotFound(err) {
+		appointment, err = s.createSlotAppointment(ctx, appointmentId, slot)
+	}
+	if err != nil {
+		logrus.Error("SSchedule.slotAppointment.ReadBySlot.", err)
+		return "", err
+	}
+
+	// The slot length changed since the appointment was made, it is not this slot anymore
+	if appointment.EndAt == nil || !appointment.EndAt.Equal(slot.EndAt) {
+		return "", ErrSlotNotAvailable
+	}
+
+	return appointment.AppointmentID, nil
+}
+
+// createSlotAppointment opens the appointment of a slot. Two first bookings can race here, the doctor
+// lock makes the loser run again and join the appointment of the winner. The unique doctor and start
+// index still catches a duplicate that got past, the memory repositories have no lock.
+func (s *Schedule) createSlotAppointment(ctx context.Context, appointmentId string, slot entity.TSlot) (entity.TAppointment, error) {
+	var appointment entity.TAppointment
+	err := s.appointment.inTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repos.Doctor(ctx).LockAppointments(slot.DoctorID); err != nil {
+			return err
+		}
+
+		appointmentRepo := s.repos.Appointment(ctx)
+
+		err := appointmentRepo.ReadBySlot(slot.DoctorID, slot.StartAt, &appointment)
+		if !entity.IsNotFound(err) {
+			return err
+		}
+
+		isOverlapping, err := appointmentRepo.CheckOverlap(slot.DoctorID, slot.StartAt, slot.EndAt)
+		if err != nil {
+			return err
+		}
+		if isOverlapping {
+			return ErrSlotNotAvailable
+		}
+
+		startAt, endAt := slot.StartAt, slot.EndAt
+		appointment = entity.TAppointment{
+			AppointmentID:     appointmentId,
+			DoctorID:          slot.DoctorID,
+			PatientAccountIDs: []string{},
+			MaxAppointment:    slot.Capacity,
+			StartAt:           &startAt,
+			EndAt:             &endAt,
+		}
+
+		return appointmentRepo.Create(appointment)
+	})
+	if err == repository.ErrDuplicateSlot {
+		err = s.repos.Appointment(ctx).ReadBySlot(slot.DoctorID, slot.StartAt, &appointment)
+	}
+	if err != nil {
+		return entity.TAppointment{}, err
+	}
+
+	return appointment, nil
+}
+
+// applyAppointments fills the bookings of slot from its appointment and reports whether it still has a seat.
+// A slot overlapped by an appointment that isn't its own, made before the schedule changed, is taken.
+func applyAppointments(slot *entity.TSlot, appointments []entity.TAppointment) bool {
+	for _, appointment := range appointments {
+		if appointment.StartAt == nil || appointment.EndAt == nil {
+			continue
+		}
+		if !appointment.StartAt.Before(slot.EndAt) || !appointment.EndAt.After(slot.StartAt) {
+			continue
+		}
+
+		if !appointment.StartAt.Equal(slot.StartAt) || !appointment.EndAt.Equal(slot.EndAt) {
+			return false
+		}
+
+		slot.AppointmentID = appointment.AppointmentID
+		slot.Capacity = appointment.MaxAppointment
+		slot.BookedCount = len(appointment.PatientAccountIDs)
+	}
+
+	return slot.BookedCount < int(slot.Capacity)
+}
+
+// generateSlots lays the weekly hours over every day of [from, to) in location and keeps the slots
+// that start in the range and after now, outside the exceptions
+func generateSlots(schedule entity.TWorkingSchedule, from, to, now time.Time, location *time.Location) []entity.TSlot {
+	slotLength := time.Duration(schedule.SlotMinutes) * time.Minute
+	if slotLength <= 0 {
+		return nil
+	}
+
+	slots := []entity.TSlot{}
+	first := from.In(location)
+	for day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, location); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, hours := range schedule.WeeklyHours {
+			if hours.Weekday != day.Weekday() {
+				continue
+			}
+
+			start, end, err := workingHoursOn(day, hours, location)
+			if err != nil {
+				continue
+			}
+
+			for startAt := start; !startAt.Add(slotLength).After(end); startAt = startAt.Add(slotLength) {
+				endAt := startAt.Add(slotLength)
+				if startAt.Before(from) || !startAt.Before(to) || !startAt.After(now) || isClosed(schedule.Exceptions, startAt, endAt) {
+					continue
+				}
+
+				slots = append(slots, entity.TSlot{
+					DoctorID: schedule.DoctorID,
+					StartAt:  startAt,
+					EndAt:    endAt,
+					Capacity: schedule.MaxPerSlot,
+				})
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].StartAt.Before(slots[j].StartAt) })
+
+	return slots
+}
+
+func workingHoursOn(day time.Time, hours entity.TWorkingHours, location *time.Location) (time.Time, time.Time, error) {
+	startClock, err := time.Parse(clockLayout, hours.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	endClock, err := time.Parse(clockLayout, hours.EndTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), startClock.Hour(), startClock.Minute(), 0, 0, location)
+	end := time.Date(day.Year(), day.Month(), day.Day(), endClock.Hour(), endClock.Minute(), 0, 0, location)
+
+	return start, end, nil
+}
+
+func isClosed(exceptions []entity.TScheduleException, startAt, endAt time.Time) bool {
+	for _, exception := range exceptions {
+		if exception.StartAt.Before(endAt) && exception.EndAt.After(startAt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateSchedule(payload entity.TSetScheduleReq) error {
+	if payload.SlotMinutes < minSlotMinutes || payload.SlotMinutes > maxSlotMinutes {
+		return ErrInvalidSlotMinutes
+	}
+
+	if payload.MaxPerSlot < 1 {
+		return ErrInvalidMaxPerSlot
+	}
+
+	// Blocks of a weekday must not overlap, their slots would
+	byWeekday := map[time.Weekday][][2]time.Time{}
+	for _, hours := range payload.WeeklyHours {
+		if hours.Weekday < time.Sunday || hours.Weekday > time.Saturday {
+			return ErrInvalidWorkingHours
+		}
+
+		start, errStart := time.Parse(clockLayout, hours.StartTime)
+		end, errEnd := time.Parse(clockLayout, hours.EndTime)
+		if errStart != nil || errEnd != nil || !start.Before(end) {
+			return ErrInvalidWorkingHours
+		}
+
+		for _, other := range byWeekday[hours.Weekday] {
+			if start.Before(other[1]) && end.After(other[0]) {
+				return ErrInvalidWorkingHours
+			}
+		}
+		byWeekday[hours.Weekday] = append(byWeekday[hours.Weekday], [2]time.Time{start, end})
+	}
+
+	for _, exception := range payload.Exceptions {
+		if !exception.StartAt.Before(exception.EndAt) {
+			return ErrInvalidException
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+)
+
+// newTestSchedule stores an active doctor working every day from 08:00 to 12:00 clinic time in 30 minute
+// slots of capacity seats, the clock of the service is now
+func newTestSchedule(t *testing.T, repos repository.Repositories, capacity uint8, now time.Time) *Schedule {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := repos.Doctor(ctx).Create(entity.TDoctor{DoctorID: "doctor", IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var weeklyHours []entity.TWorkingHours
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		weeklyHours = append(weeklyHours, entity.TWorkingHours{Weekday: weekday, StartTime: "08:00", EndTime: "12:00"})
+	}
+
+	scheduleService := NewScheduleService(nil, repos)
+	scheduleService.now = func() time.Time { return now }
+	if err := scheduleService.SetSchedule(ctx, "doctor", entity.TSetScheduleReq{
+		SlotMinutes: 30,
+		MaxPerSlot:  capacity,
+		WeeklyHours: weeklyHours,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return scheduleService
+}
+
+// clinicTime is the wall clock time in the clinic timezone
+func clinicTime(t *testing.T, year int, month time.Month, day, hour, min int) time.Time {
+	t.Helper()
+
+	location, err := ClinicLocation()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return time.Date(year, month, day, hour, min, 0, 0, location)
+}
+
+func TestRescheduleToSlotLeavesNoOrphan(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	scheduleService := newTestSchedule(t, repos, 1, time.Now())
+
+	if err := repos.Appointment(ctx).Create(entity.TAppointment{AppointmentID: "original", DoctorID: "doctor", MaxAppointment: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	startAt := time.Now().AddDate(0, 0, 2)
+	slots, err := scheduleService.GetSlots(ctx, entity.TGetSlotsReq{DoctorID: "doctor", From: startAt, To: startAt.AddDate(0, 0, 1)})
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("GetSlots = %v, %v", slots, err)
+	}
+
+	// Nobody is booked on the original, the move fails after the slot was opened
+	_, err = scheduleService.Reschedule(ctx, "original", "opened", "patient", "patient", entity.TRescheduleReq{DoctorID: "doctor", StartAt: &slots[0].StartAt})
+	if err != ErrNotBooked {
+		t.Fatalf("Reschedule = %v, want %v", err, ErrNotBooked)
+	}
+
+	err = repos.Appointment(ctx).Read("opened", &entity.TAppointment{})
+	if !entity.IsNotFound(err) {
+		t.Errorf("the slot appointment opened by the failed reschedule is still there: %v", err)
+	}
+}
+
+func TestInactiveDoctorTakesNoBookings(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	scheduleService := newTestSchedule(t, repos, 2, time.Now())
+
+	startAt := time.Now().AddDate(0, 0, 2)
+	slots, err := scheduleService.GetSlots(ctx, entity.TGetSlotsReq{DoctorID: "doctor", From: startAt, To: startAt.AddDate(0, 0, 1)})
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("GetSlots = %v, %v", slots, err)
+	}
+	appointmentId, err := scheduleService.BookSlot(ctx, "opened", "booked", "booked", entity.TBookSlotReq{DoctorID: "doctor", StartAt: slots[0].StartAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isActive := false
+	if err := repos.Doctor(ctx).Update("doctor", entity.TUpdateDoctor{IsActive: &isActive}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "book", call: func() error {
+			return scheduleService.appointment.Book(ctx, appointmentId, "patient", "patient")
+		}},
+		{name: "get slots", call: func() error {
+			_, err := scheduleService.GetSlots(ctx, entity.TGetSlotsReq{DoctorID: "doctor", From: startAt, To: startAt.AddDate(0, 0, 1)})
+			return err
+		}},
+		{name: "book slot", call: func() error {
+			_, err := scheduleService.BookSlot(ctx, "another", "patient", "patient", entity.TBookSlotReq{DoctorID: "doctor", StartAt: slots[1].StartAt})
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(); err != ErrDoctorInactive {
+				t.Errorf("got %v, want %v", err, ErrDoctorInactive)
+			}
+		})
+	}
+
+	if err := repos.Appointment(ctx).Read("another", &entity.TAppointment{}); !entity.IsNotFound(err) {
+		t.Errorf("a slot of the inactive doctor was opened: %v", err)
+	}
+}
+
+func TestGenerateSlotsInClinicTime(t *testing.T) {
+	location, err := ClinicLocation()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2026-03-02 is a Monday, the clinic is at UTC+7
+	monday := func(hour, min int) time.Time { return clinicTime(t, 2026, time.March, 2, hour, min) }
+	schedule := entity.TWorkingSchedule{
+		DoctorID:    "doctor",
+		SlotMinutes: 60,
+		MaxPerSlot:  2,
+		WeeklyHours: []entity.TWorkingHours{{Weekday: time.Monday, StartTime: "08:00", EndTime: "12:00"}},
+	}
+
+	tests := []struct {
+		name       string
+		from, to   time.Time
+		now        time.Time
+		exceptions []entity.TScheduleException
+		wantStarts []time.Time
+	}{
+		{
+			name:       "range starting on the utc sunday",
+			from:       time.Date(2026, time.March, 1, 20, 0, 0, 0, time.UTC),
+			to:         time.Date(2026, time.March, 2, 6, 0, 0, 0, time.UTC),
+			wantStarts: []time.Time{monday(8, 0), monday(9, 0), monday(10, 0), monday(11, 0)},
+		},
+		{
+			name:       "utc monday ends on the clinic tuesday",
+			from:       time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC),
+			to:         time.Date(2026, time.March, 3, 0, 0, 0, 0, time.UTC),
+			wantStarts: []time.Time{monday(8, 0), monday(9, 0), monday(10, 0), monday(11, 0)},
+		},
+		{
+			name:       "range cut before the hours end",
+			from:       monday(0, 0),
+			to:         monday(10, 0),
+			wantStarts: []time.Time{monday(8, 0), monday(9, 0)},
+		},
+		{
+			name:       "slots started before now are gone",
+			from:       monday(0, 0),
+			to:         monday(23, 0),
+			now:        monday(9, 30),
+			wantStarts: []time.Time{monday(10, 0), monday(11, 0)},
+		},
+		{
+			name:       "exception closes the slots it touches",
+			from:       monday(0, 0),
+			to:         monday(23, 0),
+			exceptions: []entity.TScheduleException{{StartAt: monday(9, 30), EndAt: monday(10, 30)}},
+			wantStarts: []time.Time{monday(8, 0), monday(11, 0)},
+		},
+		{
+			name:       "utc monday outside the clinic hours",
+			from:       time.Date(2026, time.March, 2, 5, 0, 0, 0, time.UTC),
+			to:         time.Date(2026, time.March, 2, 23, 0, 0, 0, time.UTC),
+			wantStarts: []time.Time{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule.Exceptions = test.exceptions
+			now := test.now
+			if now.IsZero() {
+				now = monday(0, 0)
+			}
+
+			slots := generateSlots(schedule, test.from, test.to, now, location)
+			if len(slots) != len(test.wantStarts) {
+				t.Fatalf("%d slots %v, want %d", len(slots), slots, len(test.wantStarts))
+			}
+			for i, slot := range slots {
+				if !slot.StartAt.Equal(test.wantStarts[i]) || slot.EndAt.Sub(slot.StartAt) != time.Hour {
+					t.Errorf("slot %d runs %s to %s, want to start at %s", i, slot.StartAt, slot.EndAt, test.wantStarts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateAppointmentRejectsOverlaps(t *testing.T) {
+	// The doctor already sees patients from 09:00 to 10:00 clinic time, 02:00 to 03:00 UTC
+	utc := func(hour, min int) *time.Time {
+		at := time.Date(2026, time.March, 2, hour, min, 0, 0, time.UTC)
+		return &at
+	}
+
+	tests := []struct {
+		name           string
+		doctorId       string
+		startAt, endAt *time.Time
+		wantErr        error
+	}{
+		{name: "ends when it starts", doctorId: "doctor", startAt: utc(1, 0), endAt: utc(2, 0), wantErr: nil},
+		{name: "starts when it ends", doctorId: "doctor", startAt: utc(3, 0), endAt: utc(4, 0), wantErr: nil},
+		{name: "same hour", doctorId: "doctor", startAt: utc(2, 0), endAt: utc(3, 0), wantErr: ErrAppointmentOverlaps},
+		{name: "overlaps the end", doctorId: "doctor", startAt: utc(2, 30), endAt: utc(3, 30), wantErr: ErrAppointmentOverlaps},
+		{name: "inside it", doctorId: "doctor", startAt: utc(2, 15), endAt: utc(2, 45), wantErr: ErrAppointmentOverlaps},
+		{name: "other doctor", doctorId: "other", startAt: utc(2, 0), endAt: utc(3, 0), wantErr: nil},
+		{name: "untimed", doctorId: "doctor", wantErr: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := repository.NewMemoryRepositories()
+			appointmentService := &Appointment{repos: repos}
+
+			for _, doctorId := range []string{"doctor", "other"} {
+				if err := repos.Doctor(ctx).Create(entity.TDoctor{DoctorID: doctorId, IsActive: true}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			startAt, endAt := clinicTime(t, 2026, time.March, 2, 9, 0), clinicTime(t, 2026, time.March, 2, 10, 0)
+			if err := appointmentService.CreateAppointment(ctx, "booked", entity.TCreateAppointmentReq{
+				DoctorID:       "doctor",
+				MaxAppointment: 1,
+				StartAt:        &startAt,
+				EndAt:          &endAt,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := appointmentService.CreateAppointment(ctx, "new", entity.TCreateAppointmentReq{
+				DoctorID:       test.doctorId,
+				MaxAppointment: 1,
+				StartAt:        test.startAt,
+				EndAt:          test.endAt,
+			})
+			if err != test.wantErr {
+				t.Errorf("CreateAppointment = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
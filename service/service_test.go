@@ -0,0 +1,23 @@
+package service
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+
+	config.JWTSecretKey = "test-secret"
+	config.CONFIG.Schedule.Timezone = "Asia/Jakarta"
+	config.CONFIG.Schedule.RescheduleNotice = 7200
+	if err := InitKeyRing(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
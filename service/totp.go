@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/sirupsen/logrus"
+)
+
+// PurposeMFA marks the short lived token handed out between the password and the second factor
+const PurposeMFA = "mfa"
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTOTPAlreadyEnabled = entity.NewConflictError("totp already enabled")
+	ErrTOTPNotEnabled     = entity.NewConflictError("totp not enabled")
+	ErrTOTPNotPending     = entity.NewConflictError("no pending totp enrollment")
+	ErrTOTPRequired       = entity.NewForbiddenError("totp is required for this account")
+	ErrInvalidTOTPCode    = entity.NewValidationError("invalid totp code")
+	ErrInvalidMFAToken    = entity.NewUnauthorizedError("invalid mfa token")
+)
+
+func isTOTPRequired(account entity.TAccount) bool {
+	return account.Role == entity.ADMINISTRATOR && config.CONFIG.TOTP.RequiredForAdmin
+}
+
+// BeginLogin runs after the password matched. Accounts with TOTP get an mfa token instead of a session,
+// admins without TOTP get one too when it is mandatory, so they can enroll before their first session.
+func (s *Auth) BeginLogin(ctx context.Context, account entity.TAccount) (entity.LoginRes, error) {
+	if !account.TOTPEnabled && !isTOTPRequired(account) {
+		return s.CreateSession(ctx, account.AccountID)
+	}
+
+	mfaToken, err := s.CreatePurposeToken(entity.MetaToken{AccountID: account.AccountID, Purpose: PurposeMFA}, mfaTokenTTL)
+	if err != nil {
+		return entity.LoginRes{}, err
+	}
+
+	if !account.TOTPEnabled {
+		return entity.LoginRes{MFAEnrollRequired: true, MFAToken: mfaToken}, nil
+	}
+
+	return entity.LoginRes{MFARequired: true, MFAToken: mfaToken}, nil
+}
+
+// BeginTOTPEnrollment stores a pending secret, it only becomes active once a code from it is confirmed
+func (s *Auth) BeginTOTPEnrollment(ctx context.Context, accountId string) (entity.TOTPEnrollRes, error) {
+	accountRepo := s.repos.Account(ctx)
+
+	var account entity.TAccount
+	if err := accountRepo.Read(accountId, &account); err != nil {
+		return entity.TOTPEnrollRes{}, err
+	}
+
+	if account.TOTPEnabled {
+		return entity.TOTPEnrollRes{}, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := helper.GenerateTOTPSecret()
+	if err != nil {
+		logrus.Error("SAuth.BeginTOTPEnrollment.GenerateTOTPSecret.", err)
+		return entity.TOTPEnrollRes{}, err
+	}
+
+	if err := accountRepo.SetTOTPPendingSecret(accountId, secret); err != nil {
+		logrus.Error("SAuth.BeginTOTPEnrollment.SetTOTPPendingSecret.", err)
+		return entity.TOTPEnrollRes{}, err
+	}
+
+	return entity.TOTPEnrollRes{
+		Secret:          secret,
+		ProvisioningURI: helper.TOTPProvisioningURI(config.CONFIG.TOTP.Issuer, account.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables TOTP with the pending secret and returns the recovery codes, they are shown only once
+func (s *Auth) ConfirmTOTPEnrollment(ctx context.Context, accountId, code string) ([]string, error) {
+	accountRepo := s.repos.Account(ctx)
+
+	var account entity.TAccount
+	if err := accountRepo.Read(accountId, &account); err != nil {
+		return nil, err
+	}
+
+	if account.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if account.TOTPPendingSecret == "" {
+		return nil, ErrTOTPNotPending
+	}
+
+	step, isValid := helper.VerifyTOTP(account.TOTPPendingSecret, code, time.Now(), 0)
+	if !isValid {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	recoveryCodeHashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		recoveryCode, err := helper.GenerateRandomToken(10)
+		if err != nil {
+			logrus.Error("SAuth.ConfirmTOTPEnrollment.GenerateRandomToken.", err)
+			return nil, err
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		recoveryCodeHashes = append(recoveryCodeHashes, helper.HashToken(recoveryCode))
+	}
+
+	isEnabled, err := accountRepo.EnableTOTP(accountId, account.TOTPPendingSecret, step, recoveryCodeHashes)
+	if err != nil {
+		logrus.Error("SAuth.ConfirmTOTPEnrollment.EnableTOTP.", err)
+		return nil, err
+	}
+	if !isEnabled {
+		// The pending secret was replaced by a concurrent enrollment
+		return nil, ErrTOTPNotPending
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP needs both the password and a current code, mandatory TOTP can't be turned off
+func (s *Auth) DisableTOTP(ctx context.Context, accountId string, payload entity.TOTPDisableReq) error {
+	accountRepo := s.repos.Account(ctx)
+
+	var account entity.TAccount
+	if err := accountRepo.Read(accountId, &account); err != nil {
+		return err
+	}
+
+	if !account.TOTPEnabled {
+		return ErrTOTPNotEnabled
+	}
+	if isTOTPRequired(account) {
+		return ErrTOTPRequired
+	}
+
+	if isMatch, _ := helper.ComparePassword(account.Password, payload.Password); !isMatch {
+		return ErrInvalidPassword
+	}
+
+	if err := s.VerifySecondFactor(ctx, account, payload.Code); err != nil {
+		return err
+	}
+
+	if err := accountRepo.DisableTOTP(accountId); err != nil {
+		logrus.Error("SAuth.DisableTOTP.DisableTOTP.", err)
+		return err
+	}
+
+	return nil
+}
+
+// VerifySecondFactor accepts a TOTP code or an unused recovery code. Failures count against the
+// account in the login guard, so codes can't be brute forced within the mfa token lifetime.
+func (s *Auth) VerifySecondFactor(ctx context.Context, account entity.TAccount, code string) error {
+	accountKey := AccountLoginKey(account.AccountID)
+	if err := s.loginGuard.Check(ctx, accountKey); err != nil {
+		return err
+	}
+
+	isValid, err := s.checkSecondFactor(ctx, account, code)
+	if err != nil {
+		return err
+	}
+
+	if !isValid {
+		if err := s.loginGuard.Fail(ctx, accountKey); err != nil {
+			logrus.Error("SAuth.VerifySecondFactor.Fail.", err)
+		}
+		return ErrInvalidTOTPCode
+	}
+
+	return nil
+}
+
+func (s *Auth) checkSecondFactor(ctx context.Context, account entity.TAccount, code string) (bool, error) {
+	accountRepo := s.repos.Account(ctx)
+	code = strings.TrimSpace(code)
+
+	if step, isValid := helper.VerifyTOTP(account.TOTPSecret, code, time.Now(), account.TOTPLastStep); isValid {
+		// Claiming the step atomically keeps two requests from spending the same code
+		return accountRepo.UseTOTPStep(account.AccountID, step)
+	}
+
+	return accountRepo.UseRecoveryCode(account.AccountID, helper.HashToken(code))
+}
+
+// BeginTOTPLoginEnrollment starts the enrollment of an admin whose login is blocked on mandatory TOTP
+func (s *Auth) BeginTOTPLoginEnrollment(ctx context.Context, mfaToken string) (entity.TOTPEnrollRes, error) {
+	claims, err := s.ParsePurposeToken(mfaToken, PurposeMFA)
+	if err != nil {
+		return entity.TOTPEnrollRes{}, ErrInvalidMFAToken
+	}
+
+	result, err := s.BeginTOTPEnrollment(ctx, claims.AccountID)
+	if entity.IsNotFound(err) {
+		return entity.TOTPEnrollRes{}, ErrInvalidMFAToken
+	}
+
+	return result, err
+}
+
+// CompleteTOTPLogin finishes the two-step login. A pending mandatory enrollment is confirmed by the
+// same code, the response then also carries the new recovery codes.
+func (s *Auth) CompleteTOTPLogin(ctx context.Context, mfaToken, code string) (entity.LoginRes, error) {
+	claims, err := s.ParsePurposeToken(mfaToken, PurposeMFA)
+	if err != nil {
+		return entity.LoginRes{}, ErrInvalidMFAToken
+	}
+	accountId := claims.AccountID
+
+	var account entity.TAccount
+	if err := s.repos.Account(ctx).Read(accountId, &account); err != nil {
+		if entity.IsNotFound(err) {
+			return entity.LoginRes{}, ErrInvalidMFAToken
+		}
+		return entity.LoginRes{}, err
+	}
+
+	var recoveryCodes []string
+	if account.TOTPEnabled {
+		if err := s.VerifySecondFactor(ctx, account, code); err != nil {
+			return entity.LoginRes{}, err
+		}
+	} else {
+		if !isTOTPRequired(account) {
+			return entity.LoginRes{}, ErrTOTPNotEnabled
+		}
+
+		if err := s.loginGuard.Check(ctx, AccountLoginKey(accountId)); err != nil {
+			return entity.LoginRes{}, err
+		}
+
+		recoveryCodes, err = s.ConfirmTOTPEnrollment(ctx, accountId, code)
+		if err != nil {
+			if err == ErrInvalidTOTPCode {
+				if err := s.loginGuard.Fail(ctx, AccountLoginKey(accountId)); err != nil {
+					logrus.Error("SAuth.CompleteTOTPLogin.Fail.", err)
+				}
+			}
+			return entity.LoginRes{}, err
+		}
+	}
+
+	if err := s.loginGuard.Reset(ctx, AccountLoginKey(accountId)); err != nil {
+		logrus.Error("SAuth.CompleteTOTPLogin.Reset.", err)
+	}
+
+	result, err := s.CreateSession(ctx, accountId)
+	if err != nil {
+		return entity.LoginRes{}, err
+	}
+	result.RecoveryCodes = recoveryCodes
+
+	return result, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+)
+
+// currentTOTPCode is the code of secret for the current step
+func currentTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	code, err := helper.TOTPCode(secret, helper.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	authService := NewAuthService(nil, repos)
+
+	secret, err := helper.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Account(ctx).Create(entity.TAccount{
+		AccountID:          "patient",
+		Role:               entity.PATIENT,
+		Email:              "patient@example.com",
+		Username:           "patient",
+		TOTPEnabled:        true,
+		TOTPSecret:         secret,
+		RecoveryCodeHashes: []string{helper.HashToken("first-recovery"), helper.HashToken("second-recovery")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	code := currentTOTPCode(t, secret)
+
+	// The steps run in order against the same account
+	steps := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{name: "current code", code: code, wantErr: nil},
+		{name: "replayed code", code: code, wantErr: ErrInvalidTOTPCode},
+		{name: "recovery code", code: "first-recovery", wantErr: nil},
+		{name: "spent recovery code", code: "first-recovery", wantErr: ErrInvalidTOTPCode},
+		{name: "unknown code", code: "000000000", wantErr: ErrInvalidTOTPCode},
+		{name: "other recovery code", code: " second-recovery ", wantErr: nil},
+	}
+
+	for _, step := range steps {
+		var account entity.TAccount
+		if err := repos.Account(ctx).Read("patient", &account); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := authService.VerifySecondFactor(ctx, account, step.code); err != step.wantErr {
+			t.Errorf("%s: VerifySecondFactor = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	var account entity.TAccount
+	if err := repos.Account(ctx).Read("patient", &account); err != nil {
+		t.Fatal(err)
+	}
+	if len(account.RecoveryCodeHashes) != 0 {
+		t.Errorf("%d recovery codes left, want 0", len(account.RecoveryCodeHashes))
+	}
+}
+
+func TestBeginLoginRequiresAdminEnrollment(t *testing.T) {
+	requiredForAdmin := config.CONFIG.TOTP.RequiredForAdmin
+	defer func() { config.CONFIG.TOTP.RequiredForAdmin = requiredForAdmin }()
+
+	tests := []struct {
+		name             string
+		role             entity.TAccountRole
+		requiredForAdmin bool
+		wantEnroll       bool
+	}{
+		{name: "admin when mandatory", role: entity.ADMINISTRATOR, requiredForAdmin: true, wantEnroll: true},
+		{name: "admin when optional", role: entity.ADMINISTRATOR, requiredForAdmin: false, wantEnroll: false},
+		{name: "patient when mandatory", role: entity.PATIENT, requiredForAdmin: true, wantEnroll: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.CONFIG.TOTP.RequiredForAdmin = test.requiredForAdmin
+
+			ctx := context.Background()
+			authService := NewAuthService(nil, repository.NewMemoryRepositories())
+
+			login, err := authService.BeginLogin(ctx, entity.TAccount{AccountID: "account", Role: test.role})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if login.MFAEnrollRequired != test.wantEnroll {
+				t.Errorf("MFAEnrollRequired = %t, want %t", login.MFAEnrollRequired, test.wantEnroll)
+			}
+			if isSession := login.Authorization != ""; isSession == test.wantEnroll {
+				t.Errorf("opened a session = %t, want %t", isSession, !test.wantEnroll)
+			}
+		})
+	}
+}
+
+func TestMandatoryAdminEnrollment(t *testing.T) {
+	requiredForAdmin := config.CONFIG.TOTP.RequiredForAdmin
+	config.CONFIG.TOTP.RequiredForAdmin = true
+	defer func() { config.CONFIG.TOTP.RequiredForAdmin = requiredForAdmin }()
+
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	authService := NewAuthService(nil, repos)
+
+	password, err := helper.HashPassword("admin-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := entity.TAccount{
+		AccountID: "admin",
+		Role:      entity.ADMINISTRATOR,
+		Email:     "admin@example.com",
+		Username:  "admin",
+		Password:  password,
+	}
+	if err := repos.Account(ctx).Create(admin); err != nil {
+		t.Fatal(err)
+	}
+
+	login, err := authService.BeginLogin(ctx, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !login.MFAEnrollRequired || login.MFAToken == "" {
+		t.Fatalf("login %+v, want an enrollment", login)
+	}
+
+	enrollment, err := authService.BeginTOTPLoginEnrollment(ctx, login.MFAToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := authService.CompleteTOTPLogin(ctx, login.MFAToken, "000000000"); err != ErrInvalidTOTPCode {
+		t.Errorf("CompleteTOTPLogin with a wrong code = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+
+	code := currentTOTPCode(t, enrollment.Secret)
+	session, err := authService.CompleteTOTPLogin(ctx, login.MFAToken, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Authorization == "" || len(session.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("session with %d recovery codes, want a session with %d", len(session.RecoveryCodes), recoveryCodeCount)
+	}
+
+	// The enrollment spent the step of its code
+	if _, err := authService.CompleteTOTPLogin(ctx, login.MFAToken, code); err != ErrInvalidTOTPCode {
+		t.Errorf("CompleteTOTPLogin replaying the enrollment code = %v, want %v", err, ErrInvalidTOTPCode)
+	}
+
+	if err := repos.Account(ctx).Read("admin", &admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := authService.DisableTOTP(ctx, "admin", entity.TOTPDisableReq{Password: "admin-password", Code: session.RecoveryCodes[0]}); err != ErrTOTPRequired {
+		t.Errorf("DisableTOTP = %v, want %v", err, ErrTOTPRequired)
+	}
+
+	login, err = authService.BeginLogin(ctx, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !login.MFARequired || login.MFAEnrollRequired {
+		t.Errorf("login %+v, want a second factor", login)
+	}
+}
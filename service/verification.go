@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/config"
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+var ErrEmailAlreadyVerified = entity.NewConflictError("email already verified")
+
+// SendVerificationEmail mails a link that verifies the current email of the account
+func (s *Auth) SendVerificationEmail(ctx context.Context, accountId string) error {
+	var account entity.TAccount
+	if err := s.repos.Account(ctx).Read(accountId, &account); err != nil {
+		return err
+	}
+
+	if account.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.CreatePurposeToken(entity.MetaToken{
+		AccountID: account.AccountID,
+		Purpose:   PurposeVerifyEmail,
+		Email:     account.Email,
+	}, time.Duration(config.CONFIG.VerifyEmailTTL)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below.\n\n%s\n\nThe link expires in %s.\n",
+		account.FirstName, appLink("/verify-email", token), ttlText(config.CONFIG.VerifyEmailTTL))
+
+	if err := s.mailer.Send(ctx, account.Email, "Verify your email address", body); err != nil {
+		logrus.Error("SAuth.SendVerificationEmail.Send.", err)
+		return err
+	}
+
+	return nil
+}
+
+// VerifyEmail spends the token and marks the email it was issued for as verified
+func (s *Auth) VerifyEmail(ctx context.Context, token string) error {
+	claims, err := s.ParsePurposeToken(token, PurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	if err := s.useToken(ctx, claims); err != nil {
+		return err
+	}
+
+	isVerified, err := s.repos.Account(ctx).MarkEmailVerified(claims.AccountID, claims.Email)
+	if err != nil {
+		logrus.Error("SAuth.VerifyEmail.MarkEmailVerified.", err)
+		return err
+	}
+	if !isVerified {
+		// The account changed its email since the link was sent
+		return ErrInvalidPurposeToken
+	}
+
+	return nil
+}
+
+// ForgotPassword mails a reset link when the email belongs to an account. Unknown emails are not an error,
+// the response must not tell whether an account exists.
+func (s *Auth) ForgotPassword(ctx context.Context, email string) error {
+	var account entity.TAccount
+	if err := s.repos.Account(ctx).ReadByEmail(strings.TrimSpace(email), &account); err != nil {
+		if entity.IsNotFound(err) {
+			logrus.Info("SAuth.ForgotPassword.UnknownEmail")
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.CreatePurposeToken(entity.MetaToken{
+		AccountID: account.AccountID,
+		Purpose:   PurposeResetPassword,
+	}, time.Duration(config.CONFIG.ResetPasswordTTL)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. Open the link below to choose a new one.\n\n%s\n\nThe link expires in %s. If it wasn't you, ignore this email.\n",
+		account.FirstName, appLink("/reset-password", token), ttlText(config.CONFIG.ResetPasswordTTL))
+
+	if err := s.mailer.Send(ctx, account.Email, "Reset your password", body); err != nil {
+		logrus.Error("SAuth.ForgotPassword.Send.", err)
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword spends the token and sets the new password. Every session of the account is revoked
+// and its login lockout cleared, whoever held the old password is signed out.
+func (s *Auth) ResetPassword(ctx context.Context, token, password string) error {
+	claims, err := s.ParsePurposeToken(token, PurposeResetPassword)
+	if err != nil {
+		return err
+	}
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	accountRepo := s.repos.Account(ctx)
+	if err := accountRepo.Read(claims.AccountID, &entity.TAccount{}); err != nil {
+		if entity.IsNotFound(err) {
+			return ErrInvalidPurposeToken
+		}
+		return err
+	}
+
+	if err := s.useToken(ctx, claims); err != nil {
+		return err
+	}
+
+	hashed, err := helper.HashPassword(password)
+	if err != nil {
+		logrus.Error("SAuth.ResetPassword.HashPassword.", err)
+		return err
+	}
+
+	if err := accountRepo.UpdatePassword(claims.AccountID, hashed); err != nil {
+		logrus.Error("SAuth.ResetPassword.UpdatePassword.", err)
+		return err
+	}
+
+	if err := s.repos.Session(ctx).RevokeAllByAccount(claims.AccountID); err != nil {
+		logrus.Error("SAuth.ResetPassword.RevokeAllByAccount.", err)
+		return err
+	}
+
+	if err := s.loginGuard.Reset(ctx, AccountLoginKey(claims.AccountID)); err != nil {
+		logrus.Error("SAuth.ResetPassword.Reset.", err)
+	}
+
+	return nil
+}
+
+// useToken records the jti, a token presented a second time is refused
+func (s *Auth) useToken(ctx context.Context, claims entity.MetaToken) error {
+	if claims.TokenID == "" {
+		return ErrInvalidPurposeToken
+	}
+
+	isUsed, err := s.repos.UsedToken(ctx).Use(entity.TUsedToken{
+		TokenID:   claims.TokenID,
+		Purpose:   claims.Purpose,
+		AccountID: claims.AccountID,
+		UsedAt:    time.Now(),
+		ExpiredAt: time.Unix(claims.ExpiredAt, 0),
+	})
+	if err != nil {
+		logrus.Error("SAuth.useToken.Use.", err)
+		return err
+	}
+	if !isUsed {
+		return ErrInvalidPurposeToken
+	}
+
+	return nil
+}
+
+func appLink(path, token string) string {
+	return strings.TrimRight(config.CONFIG.Mail.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func ttlText(seconds int64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
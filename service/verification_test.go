@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/helper"
+	"github.com/agustadewa/hospital-backend/repository"
+)
+
+// capturingMailer keeps the body of every mail instead of sending it
+type capturingMailer struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (m *capturingMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+// lastToken reads the token out of the link of the last mail
+func (m *capturingMailer) lastToken(t *testing.T) string {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.bodies) == 0 {
+		t.Fatal("no mail was sent")
+	}
+
+	body := m.bodies[len(m.bodies)-1]
+	start := strings.Index(body, "?token=")
+	if start < 0 {
+		t.Fatalf("no link in %q", body)
+	}
+	escaped := body[start+len("?token="):]
+	escaped = escaped[:strings.IndexAny(escaped, "\n ")]
+
+	token, err := url.QueryUnescape(escaped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func newVerificationTest(t *testing.T) (*Auth, *repository.MemoryRepositories, *capturingMailer) {
+	t.Helper()
+
+	repos := repository.NewMemoryRepositories()
+	mailer := &capturingMailer{}
+	authService := NewAuthService(nil, repos)
+	authService.mailer = mailer
+
+	password, err := helper.HashPassword("first-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Account(context.Background()).Create(entity.TAccount{
+		AccountID: "patient",
+		Role:      entity.PATIENT,
+		Email:     "patient@example.com",
+		Username:  "patient",
+		Password:  password,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return authService, repos, mailer
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		// before runs between the mail and the verification
+		before       func(t *testing.T, authService *Auth, repos *repository.MemoryRepositories, token string)
+		wantErr      error
+		wantVerified bool
+	}{
+		{
+			name:         "fresh token",
+			before:       func(t *testing.T, authService *Auth, repos *repository.MemoryRepositories, token string) {},
+			wantVerified: true,
+		},
+		{
+			name: "spent token",
+			before: func(t *testing.T, authService *Auth, repos *repository.MemoryRepositories, token string) {
+				if err := authService.VerifyEmail(context.Background(), token); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:      ErrInvalidPurposeToken,
+			wantVerified: true,
+		},
+		{
+			name: "email changed since the mail",
+			before: func(t *testing.T, authService *Auth, repos *repository.MemoryRepositories, token string) {
+				email := "changed@example.com"
+				if err := repos.Account(context.Background()).Update("patient", entity.TUpdateAccount{Email: &email}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:      ErrInvalidPurposeToken,
+			wantVerified: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			authService, repos, mailer := newVerificationTest(t)
+
+			if err := authService.SendVerificationEmail(ctx, "patient"); err != nil {
+				t.Fatal(err)
+			}
+			token := mailer.lastToken(t)
+			test.before(t, authService, repos, token)
+
+			if err := authService.VerifyEmail(ctx, token); err != test.wantErr {
+				t.Fatalf("VerifyEmail = %v, want %v", err, test.wantErr)
+			}
+
+			var account entity.TAccount
+			if err := repos.Account(ctx).Read("patient", &account); err != nil {
+				t.Fatal(err)
+			}
+			if account.EmailVerified != test.wantVerified {
+				t.Errorf("email verified = %t, want %t", account.EmailVerified, test.wantVerified)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	authService, repos, mailer := newVerificationTest(t)
+
+	session, err := authService.CreateSession(ctx, "patient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := authService.SendVerificationEmail(ctx, "patient"); err != nil {
+		t.Fatal(err)
+	}
+	verifyToken := mailer.lastToken(t)
+
+	if err := authService.ForgotPassword(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("ForgotPassword of an unknown email = %v", err)
+	}
+	if err := authService.ForgotPassword(ctx, "patient@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := mailer.lastToken(t)
+
+	// The steps run in order with the same token
+	steps := []struct {
+		name     string
+		token    string
+		password string
+		wantErr  error
+	}{
+		{name: "verify token", token: verifyToken, password: "second-password", wantErr: ErrInvalidPurposeToken},
+		{name: "fresh token", token: token, password: "second-password", wantErr: nil},
+		{name: "spent token", token: token, password: "third-password", wantErr: ErrInvalidPurposeToken},
+	}
+
+	for _, step := range steps {
+		if err := authService.ResetPassword(ctx, step.token, step.password); err != step.wantErr {
+			t.Errorf("%s: ResetPassword = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	var account entity.TAccount
+	if err := repos.Account(ctx).Read("patient", &account); err != nil {
+		t.Fatal(err)
+	}
+	if isMatch, _ := helper.ComparePassword(account.Password, "second-password"); !isMatch {
+		t.Errorf("the password is not the one of the first reset")
+	}
+
+	if _, err := authService.Refresh(ctx, session.RefreshToken); err == nil {
+		t.Errorf("the session opened before the reset still refreshes")
+	}
+}
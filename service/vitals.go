@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/agustadewa/hospital-backend/entity"
+	"github.com/agustadewa/hospital-backend/repository"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func NewVitalsService(client *mongo.Client, repos repository.Repositories) *Vitals {
+	return &Vitals{mongoClient: client, repos: repos}
+}
+
+type Vitals struct {
+	mongoClient *mongo.Client
+	repos       repository.Repositories
+}
+
+func (s *Vitals) RecordVitals(ctx context.Context, vitalsId, recordedBy string, payload entity.TCreateVitalsReq) error {
+	var patient entity.TAccount
+	if err := s.repos.Account(ctx).Read(payload.PatientAccountID, &patient); err != nil {
+		logrus.Error("SVitals.RecordVitals.ReadPatient.", err)
+		return err
+	}
+
+	if patient.Role != entity.PATIENT {
+		return ErrNotPatient
+	}
+
+	vitals := entity.TVitals{
+		VitalsID:         vitalsId,
+		PatientAccountID: payload.PatientAccountID,
+		AppointmentID:    payload.AppointmentID,
+		RecordedBy:       recordedBy,
+		RecordedAt:       time.Now(),
+		BodyTemperature:  payload.BodyTemperature,
+		HeartRate:        payload.HeartRate,
+		RespiratoryRate:  payload.RespiratoryRate,
+		SystolicBP:       payload.SystolicBP,
+		DiastolicBP:      payload.DiastolicBP,
+		OxygenSaturation: payload.OxygenSaturation,
+		Weight:           payload.Weight,
+		Height:           payload.Height,
+		Note:             payload.Note,
+	}
+	if err := s.repos.Vitals(ctx).Create(vitals); err != nil {
+		logrus.Error("SVitals.RecordVitals.Create.", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Vitals) GetVitalsByPatient(ctx context.Context, accountId string, result *[]entity.TVitals) error {
+	if err := s.repos.Vitals(ctx).ReadManyByPatient(accountId, result); err != nil {
+		logrus.Error("SVitals.GetVitalsByPatient.ReadManyByPatient.", err)
+		return err
+	}
+
+	return nil
+}